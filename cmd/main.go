@@ -2,47 +2,253 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"merch-shop/internal/database"
+	"merch-shop/internal/config"
 	"merch-shop/internal/handlers"
+	"merch-shop/internal/jobs"
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
 	"merch-shop/internal/middleware"
-	"merch-shop/internal/repository"
+	"merch-shop/internal/ratelimit"
+	"merch-shop/internal/service"
+	"merch-shop/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+	envErr := godotenv.Load()
+
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if _, err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		log.Fatalf("Error configuring logging: %v", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found, using system environment variables")
+	}
+
+	service.WelcomeCoins = cfg.Coins.WelcomeCoins
+	service.CoinLifetimeMonths = cfg.Coins.LifetimeMonths
+	service.RegistrationMode = cfg.Auth.RegistrationMode
+	service.LoginLockout = service.LockoutPolicy{
+		Threshold: cfg.Auth.LockoutThreshold,
+		BaseDelay: cfg.Auth.LockoutBaseDelay,
+		MaxDelay:  cfg.Auth.LockoutMaxDelay,
+	}
+	service.Offboarding = service.OffboardingPolicy{
+		Settlement:  cfg.Coins.OffboardingSettlement,
+		Recipient:   cfg.Coins.OffboardingRecipient,
+		ShopAccount: cfg.Coins.OffboardingShopAccount,
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("Error printing configuration", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Error configuring tracing", err)
 	}
 
-	db, err := database.Connect()
+	store, err := openStorage(cfg)
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		fatal("Error opening storage", err)
+	}
+	repo := store.repo
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "reconcile":
+			code := runReconcile(repo, args[1:])
+			store.Close()
+			shutdownTracing(context.Background())
+			os.Exit(code)
+		case "migrate":
+			code := runMigrate(store, args[1:])
+			store.Close()
+			shutdownTracing(context.Background())
+			os.Exit(code)
+		default:
+			slog.Error("Unknown command", "command", args[0])
+			os.Exit(2)
+		}
 	}
-	defer db.Close()
 
-	repo := repository.NewPostgresRepository(db)
+	if cfg.MigrateOnStartup() {
+		if err := store.autoMigrate(context.Background()); err != nil {
+			fatal("Error applying migrations", err)
+		}
+	}
+	if err := service.EnsureShopAccount(context.Background(), repo); err != nil {
+		fatal("Error creating shop account", err)
+	}
 
-	router := gin.Default()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// Фоновые задачи останавливаются только после того, как серверы дообслужат
+	// начатые запросы, и main дожидается их перед закрытием хранилища.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
 
-	router.POST("/api/auth", handlers.AuthHandler(repo))
+	if cfg.Jobs.ReconcileInterval > 0 {
+		jobs.Every(jobsCtx, cfg.Jobs.ReconcileInterval, jobs.Reconcile(repo))
+	}
+	jobs.Daily(jobsCtx, cfg.Coins.ExpiryHour, jobs.ExpireCoins(repo))
+
+	leaderboards := service.NewLeaderboardCache(repo)
+	if err := leaderboards.Refresh(jobsCtx); err != nil {
+		slog.Error("Error building leaderboards", "error", err)
+	}
+	jobs.Every(jobsCtx, cfg.Jobs.LeaderboardRefreshInterval, jobs.RefreshLeaderboards(leaderboards))
+
+	if store.db != nil {
+		if err := metrics.RegisterDB(store.db, store.dialect); err != nil {
+			fatal("Error registering database metrics", err)
+		}
+	}
+	updateCirculation := jobs.UpdateCirculation(repo)
+	updateCirculation(jobsCtx)
+	jobs.Every(jobsCtx, cfg.Jobs.CirculationInterval, updateCirculation)
+
+	readinessChecks, err := store.readinessChecks()
+	if err != nil {
+		fatal("Error configuring readiness checks", err)
+	}
+	readinessChecks = append(readinessChecks, handlers.ShutdownCheck(ctx))
+
+	var limits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		pgLimits := ratelimit.NewPostgresStore(store.db)
+		idle := max(cfg.RateLimit.Public.Period, cfg.RateLimit.User.Period, cfg.RateLimit.Mutating.Period)
+		jobs.Every(jobsCtx, time.Hour, jobs.DeleteIdleRateLimits(pgLimits, idle))
+		limits = pgLimits
+	}
+	publicLimit := middleware.RateLimit(limits, "public", ratelimit.Limit(cfg.RateLimit.Public), middleware.ByIP)
+	userLimit := middleware.RateLimit(limits, "user", ratelimit.Limit(cfg.RateLimit.User), middleware.ByUser)
+	mutating := middleware.RateLimit(limits, "mutating", ratelimit.Limit(cfg.RateLimit.Mutating), middleware.ByUser)
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(splitList(cfg.HTTP.TrustedProxies)); err != nil {
+		fatal("Error configuring trusted proxies", err)
+	}
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		switch r.URL.Path {
+		case "/metrics", "/debug/vars", "/healthz", "/readyz":
+			return false
+		}
+		return true
+	})))
+	router.Use(middleware.RequestID(), middleware.AccessLog(), middleware.Metrics(), middleware.Recovery(), middleware.ErrorMiddleware())
+
+	router.GET("/healthz", handlers.HealthHandler())
+	router.GET("/readyz", handlers.ReadinessHandler(readinessChecks...))
+	router.POST("/api/auth", publicLimit, handlers.AuthHandler(repo, []byte(cfg.Auth.JWTSecret)))
+	servers := []*http.Server{newServer("", cfg.Port, router, cfg.HTTP)}
+	if cfg.AdminPort == "" {
+		// Без отдельного порта служебные данные доступны только администраторам.
+		debug := router.Group("", middleware.JWTAuthMiddleware([]byte(cfg.Auth.JWTSecret), repo), middleware.AdminMiddleware())
+		debug.GET("/metrics", gin.WrapH(metrics.Handler()))
+		debug.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	} else {
+		servers = append(servers, newServer(cfg.AdminHost, cfg.AdminPort, adminHandler(), cfg.HTTP))
+	}
 
 	authGroup := router.Group("/api")
-	authGroup.Use(middleware.JWTAuthMiddleware())
+	authGroup.Use(middleware.JWTAuthMiddleware([]byte(cfg.Auth.JWTSecret), repo), userLimit)
 	{
 		authGroup.GET("/info", handlers.InfoHandler(repo))
-		authGroup.POST("/sendCoin", handlers.SendCoinHandler(repo))
-		authGroup.GET("/buy/:item", handlers.BuyHandler(repo))
+		authGroup.GET("/history", handlers.HistoryHandler(repo))
+		authGroup.GET("/statements", handlers.StatementHandler(repo))
+		authGroup.GET("/leaderboard/:board", handlers.LeaderboardHandler(leaderboards))
+		authGroup.PUT("/leaderboard/optOut", mutating, handlers.LeaderboardOptOutHandler(repo))
+		authGroup.POST("/sendCoin", mutating, handlers.SendCoinHandler(repo))
+		authGroup.GET("/buy/:item", mutating, handlers.BuyHandler(repo))
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	adminGroup := authGroup.Group("/admin")
+	adminGroup.Use(middleware.AdminMiddleware())
+	{
+		adminGroup.GET("/reconcile", handlers.ReconcileReportHandler(repo))
+		adminGroup.POST("/reconcile", mutating, handlers.ReconcileFixHandler(repo))
+		adminGroup.POST("/grants/user", mutating, handlers.GrantUserHandler(repo))
+		adminGroup.POST("/grants/users", mutating, handlers.GrantUsersHandler(repo))
+		adminGroup.POST("/grants/all", mutating, handlers.GrantAllHandler(repo))
+		adminGroup.GET("/statements", handlers.AdminStatementHandler(repo))
+		adminGroup.GET("/analytics/:series", handlers.AnalyticsHandler(repo))
+		adminGroup.GET("/users/:username/info", handlers.AdminUserInfoHandler(repo))
+		adminGroup.POST("/users", mutating, handlers.CreateUserHandler(repo))
+		adminGroup.POST("/users/:username/unlock", mutating, handlers.UnlockLoginHandler(repo))
+		adminGroup.POST("/users/:username/offboard", mutating, handlers.OffboardUserHandler(repo))
+		adminGroup.GET("/invites", handlers.ListInvitesHandler(repo))
+		adminGroup.POST("/invites", mutating, handlers.CreateInviteHandler(repo))
+		adminGroup.DELETE("/invites/:code", mutating, handlers.RevokeInviteHandler(repo))
+		adminGroup.GET("/logins", handlers.LoginAttemptsHandler(repo))
+		adminGroup.GET("/logins/suspicious", handlers.SuspiciousLoginsHandler(repo))
+	}
+
+	if cfg.Auth.SCIMToken != "" {
+		scimLimit := middleware.RateLimit(limits, "scim", ratelimit.Limit(cfg.RateLimit.User), middleware.ByIP)
+		scimGroup := router.Group("/scim/v2")
+		scimGroup.Use(middleware.SCIMErrors(), middleware.SCIMAuth(cfg.Auth.SCIMToken), scimLimit)
+		{
+			scimGroup.GET("/Users", handlers.SCIMListUsersHandler(repo))
+			scimGroup.POST("/Users", handlers.SCIMCreateUserHandler(repo))
+			scimGroup.GET("/Users/:id", handlers.SCIMGetUserHandler(repo))
+			scimGroup.PATCH("/Users/:id", handlers.SCIMPatchUserHandler(repo))
+			scimGroup.DELETE("/Users/:id", handlers.SCIMDeleteUserHandler(repo))
+		}
+	}
+
+	if err := serve(ctx, cfg.HTTP.ShutdownDelay, cfg.HTTP.ShutdownTimeout, servers...); err != nil {
+		slog.Error("Server stopped", "error", err)
+	}
+	stop()
+	stopJobs()
+	jobs.Wait()
+
+	store.Close()
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal пишет ошибку в журнал и завершает процесс с кодом 1.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// splitList разбивает список через запятую, пропуская пустые элементы.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	log.Printf("Server running on port %s", port)
-	router.Run(":" + port)
+	return items
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+// runMigrate выполняет команду migrate up|down|status. down по умолчанию
+// откатывает одну последнюю миграцию. status возвращает код выхода 1, если
+// есть неприменённые миграции.
+func runMigrate(s *storage, args []string) int {
+	if len(args) == 0 {
+		slog.Error("usage: migrate up|down [-steps N]|status")
+		return 2
+	}
+	m, err := s.migrator()
+	if err != nil {
+		slog.Error("migrate failed", "error", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			slog.Error("migrate up failed", "error", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		fs.Parse(args[1:])
+		if *steps <= 0 {
+			slog.Error("migrate down: -steps must be positive")
+			return 2
+		}
+		rolledBack, err := m.Down(ctx, *steps)
+		for _, mig := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			slog.Error("migrate down failed", "error", err)
+			return 1
+		}
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			slog.Error("migrate status failed", "error", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		pending := 0
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.AppliedAt != nil {
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			name := st.Name
+			if st.Unknown {
+				name = "(unknown to this build)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, name, appliedAt)
+		}
+		w.Flush()
+		if pending > 0 {
+			return 1
+		}
+	default:
+		slog.Error("migrate: unknown subcommand", "subcommand", args[0])
+		return 2
+	}
+	return 0
+}
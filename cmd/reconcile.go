@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+)
+
+// runReconcile выполняет команду reconcile: сверяет балансы с журналом и печатает
+// отчёт в формате JSON. Возвращает код выхода 1, если найдены неисправленные расхождения.
+func runReconcile(repo repository.Repository, args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "write adjustment transactions for every discrepancy")
+	fs.Parse(args)
+
+	report, err := service.Reconcile(context.Background(), repo, *fix)
+	if err != nil {
+		slog.Error("reconcile failed", "error", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		slog.Error("reconcile failed", "error", err)
+		return 1
+	}
+	if len(report.Discrepancies) > 0 && !*fix {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"merch-shop/internal/config"
+	"merch-shop/internal/metrics"
+)
+
+// newServer создаёт HTTP-сервер на адресе host и порту port с тайм-аутами из
+// cfg. Пустой host означает все интерфейсы.
+func newServer(host, port string, handler http.Handler, cfg config.HTTPConfig) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort(host, port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// adminHandler обслуживает /metrics и /debug/vars на отдельном порту. Порт
+// слушается на ADMIN_HOST, по умолчанию только на локальном интерфейсе.
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// serve запускает серверы servers и ждёт отмены ctx или ошибки любого из них.
+// После отмены ctx серверы ещё delay принимают запросы, пока балансировщик не
+// заметит, что /readyz перестал проходить. Затем серверы перестают принимать
+// соединения и в пределах timeout дожидаются завершения начатых запросов; не
+// успевшие соединения закрываются принудительно. serve возвращается только
+// после выхода всех обработчиков, поэтому хранилище можно закрывать сразу.
+func serve(ctx context.Context, delay, timeout time.Duration, servers ...*http.Server) error {
+	var handlers inFlight
+	errc := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv.Handler = handlers.track(srv.Handler)
+		go func(srv *http.Server) {
+			slog.Info("Server running", "addr", srv.Addr)
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, draining in-flight requests", "delay", delay.String(), "timeout", timeout.String())
+		time.Sleep(delay)
+	case err = <-errc:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = errors.Join(err, shutdownErr)
+			slog.Warn("Shutdown timed out, closing connections", "addr", srv.Addr)
+			if closeErr := srv.Close(); closeErr != nil {
+				err = errors.Join(err, closeErr)
+			}
+		}
+	}
+	handlers.wait()
+	return err
+}
+
+// inFlight отслеживает выполняющиеся обработчики. Shutdown ждёт их только в
+// пределах тайм-аута, а Close не ждёт вовсе, поэтому без этого учёта хранилище
+// могло бы закрыться под ещё работающим запросом.
+type inFlight struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// track оборачивает handler так, чтобы wait дожидался его завершения. Запросы,
+// пришедшие после вызова wait, получают 503.
+func (f *inFlight) track(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		f.wg.Add(1)
+		f.mu.Unlock()
+		defer f.wg.Done()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// wait запрещает новые запросы и ждёт завершения начатых.
+func (f *inFlight) wait() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.wg.Wait()
+}
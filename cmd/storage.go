@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"merch-shop/internal/config"
+	"merch-shop/internal/database"
+	"merch-shop/internal/handlers"
+	"merch-shop/internal/repository"
+)
+
+// storage — хранилище, выбранное при запуске. Для хранилища в памяти db равен nil.
+type storage struct {
+	repo    repository.Repository
+	db      *sql.DB
+	dialect string
+}
+
+// openStorage создаёт хранилище, выбранное настройкой storage: postgres, sqlite
+// или memory.
+func openStorage(cfg *config.Config) (*storage, error) {
+	timeouts := repository.Timeouts{
+		Read:   cfg.Database.ReadTimeout,
+		Write:  cfg.Database.WriteTimeout,
+		Report: cfg.Database.ReportTimeout,
+	}
+	switch cfg.Storage {
+	case "postgres":
+		db, err := database.Connect(cfg.Database)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to database: %w", err)
+		}
+		return &storage{
+			repo:    repository.NewPostgresRepository(db, timeouts),
+			db:      db,
+			dialect: database.Postgres,
+		}, nil
+	case "sqlite":
+		db, err := database.ConnectSQLite(cfg.SQLite)
+		if err != nil {
+			return nil, fmt.Errorf("opening sqlite database %s: %w", cfg.SQLite.Path, err)
+		}
+		return &storage{
+			repo:    repository.NewSQLiteRepository(db, timeouts),
+			db:      db,
+			dialect: database.SQLite,
+		}, nil
+	case "memory":
+		slog.Warn("Using in-memory storage: all data will be lost on restart")
+		return &storage{repo: repository.NewMemoryRepository()}, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE %q", cfg.Storage)
+	}
+}
+
+// Close освобождает ресурсы хранилища.
+func (s *storage) Close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// migrator возвращает Migrator для базы хранилища.
+func (s *storage) migrator() (*database.Migrator, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("storage has no schema to migrate")
+	}
+	return database.NewMigrator(s.db, s.dialect)
+}
+
+// autoMigrate применяет все новые миграции при запуске сервиса.
+func (s *storage) autoMigrate(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	m, err := s.migrator()
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range applied {
+		slog.Info("Applied migration", "version", mig.Version, "name", mig.Name)
+	}
+	return nil
+}
+
+// readinessChecks возвращает проверки готовности хранилища: доступность базы и
+// отсутствие неприменённых миграций. Версии, применённые более новой сборкой,
+// готовности не мешают — при выкатке новая схема уже на месте, пока старые
+// экземпляры дорабатывают. Хранилище в памяти готово всегда.
+func (s *storage) readinessChecks() ([]handlers.ReadinessCheck, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+	m, err := s.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return []handlers.ReadinessCheck{
+		{Name: "database", Check: s.db.PingContext},
+		{Name: "migrations", Check: func(ctx context.Context) error {
+			pending, err := m.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d pending migrations", pending)
+			}
+			return nil
+		}},
+	}, nil
+}
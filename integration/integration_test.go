@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"merch-shop/internal/config"
 	"merch-shop/internal/database"
 	"merch-shop/internal/handlers"
 	"merch-shop/internal/middleware"
@@ -32,24 +33,26 @@ func setupTestRouter(t *testing.T) *gin.Engine {
 		t.Log("No .env file found, using system environment variables")
 	}
 
-	os.Setenv("DB_HOST", getEnv("DB_HOST", "localhost"))
-	os.Setenv("DB_PORT", getEnv("DB_PORT", "5432"))
-	os.Setenv("DB_USER", getEnv("DB_USER", "postgres"))
-	os.Setenv("DB_PASSWORD", getEnv("DB_PASSWORD", "1234"))
-	os.Setenv("DB_NAME", getEnv("DB_NAME", "merch_shop"))
-	os.Setenv("PORT", getEnv("PORT", "8080"))
+	dbConfig := config.Default().Database
+	dbConfig.Host = getEnv("DB_HOST", "localhost")
+	dbConfig.Port = getEnv("DB_PORT", "5432")
+	dbConfig.User = getEnv("DB_USER", "postgres")
+	dbConfig.Password = getEnv("DB_PASSWORD", "1234")
+	dbConfig.Name = getEnv("DB_NAME", "merch_shop")
+	jwtSecret := []byte(getEnv("JWT_SECRET", "integration-secret"))
 
-	db, err := database.Connect()
+	db, err := database.Connect(dbConfig)
 	if err != nil {
 		t.Fatalf("Error connecting to database: %v", err)
 	}
-	repo := repository.NewPostgresRepository(db)
+	repo := repository.NewPostgresRepository(db, repository.DefaultTimeouts)
 
 	router := gin.Default()
-	router.POST("/api/auth", handlers.AuthHandler(repo))
+	router.Use(middleware.ErrorMiddleware())
+	router.POST("/api/auth", handlers.AuthHandler(repo, jwtSecret))
 
 	authGroup := router.Group("/api")
-	authGroup.Use(middleware.JWTAuthMiddleware())
+	authGroup.Use(middleware.JWTAuthMiddleware(jwtSecret, repo))
 	{
 		authGroup.GET("/info", handlers.InfoHandler(repo))
 		authGroup.POST("/sendCoin", handlers.SendCoinHandler(repo))
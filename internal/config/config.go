@@ -0,0 +1,567 @@
+// Package config собирает настройки сервиса из файла YAML, переменных окружения
+// и флагов командной строки (каждый следующий источник переопределяет предыдущий)
+// и проверяет их при запуске.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config — действующие настройки сервиса. AdminPort — отдельный порт для
+// /metrics и /debug/vars, который слушается только на адресе AdminHost; если
+// порт не задан, они обслуживаются на основном порту и доступны только
+// администраторам.
+type Config struct {
+	Port      string          `yaml:"port"`
+	AdminPort string          `yaml:"admin_port"`
+	AdminHost string          `yaml:"admin_host"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Storage   string          `yaml:"storage"`
+	Database  DatabaseConfig  `yaml:"database"`
+	SQLite    SQLiteConfig    `yaml:"sqlite"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Coins     CoinsConfig     `yaml:"coins"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+}
+
+// HTTPConfig — тайм-ауты HTTP-сервера. ShutdownDelay — время между сигналом
+// остановки и закрытием порта, за которое балансировщик успевает увидеть
+// непрошедший /readyz. ShutdownTimeout ограничивает время, за которое при
+// остановке сервиса должны завершиться начатые запросы.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies — адреса и подсети прокси через запятую, которым доверяется
+	// X-Forwarded-For. Без них адресом клиента считается адрес соединения.
+	TrustedProxies string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig — подключение к Postgres, пул соединений и тайм-ауты запросов.
+// Тайм-ауты применяются и к SQLite; 0 отключает тайм-аут.
+type DatabaseConfig struct {
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	ReportTimeout   time.Duration `yaml:"report_timeout"`
+	// AutoMigrate применяет миграции при запуске. Если не задан, включён только для SQLite.
+	AutoMigrate *bool `yaml:"auto_migrate"`
+}
+
+// SQLiteConfig — файл базы для STORAGE=sqlite.
+type SQLiteConfig struct {
+	Path         string `yaml:"path"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+}
+
+// AuthConfig — параметры выпуска токенов, регистрации и блокировки входа.
+// RegistrationMode: open, invite или admin. После LockoutThreshold неудачных
+// попыток подряд вход блокируется на LockoutBaseDelay, каждая следующая неудача
+// удваивает блокировку вплоть до LockoutMaxDelay. SCIMToken включает
+// /scim/v2 для системы учёта персонала.
+type AuthConfig struct {
+	JWTSecret        string        `yaml:"jwt_secret"`
+	SCIMToken        string        `yaml:"scim_token"`
+	RegistrationMode string        `yaml:"registration_mode"`
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutBaseDelay time.Duration `yaml:"lockout_base_delay"`
+	LockoutMaxDelay  time.Duration `yaml:"lockout_max_delay"`
+}
+
+// RateLimitConfig — ограничение частоты запросов. Public действует на
+// публичные маршруты по IP клиента, User — на авторизованные по пользователю,
+// Mutating — дополнительно на изменяющие запросы (переводы, покупки, начисления).
+// Store: memory или postgres (общий бюджет для всех экземпляров).
+type RateLimitConfig struct {
+	Store    string      `yaml:"store"`
+	Public   LimitConfig `yaml:"public"`
+	User     LimitConfig `yaml:"user"`
+	Mutating LimitConfig `yaml:"mutating"`
+}
+
+// LimitConfig — не больше Requests запросов за Period; 0 отключает ограничение.
+type LimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+}
+
+// CoinsConfig — правила начисления и сгорания монет. OffboardingSettlement
+// (forfeit или donate) определяет, куда уходит остаток отключённого
+// пользователя по умолчанию; для donate получателем будет OffboardingRecipient,
+// для forfeit — системный счёт магазина OffboardingShopAccount.
+type CoinsConfig struct {
+	WelcomeCoins           int    `yaml:"welcome_coins"`
+	LifetimeMonths         int    `yaml:"lifetime_months"`
+	ExpiryHour             int    `yaml:"expiry_hour"`
+	OffboardingSettlement  string `yaml:"offboarding_settlement"`
+	OffboardingRecipient   string `yaml:"offboarding_recipient"`
+	OffboardingShopAccount string `yaml:"offboarding_shop_account"`
+}
+
+// JobsConfig — периодичность фоновых задач. Нулевой ReconcileInterval отключает сверку.
+type JobsConfig struct {
+	ReconcileInterval          time.Duration `yaml:"reconcile_interval"`
+	LeaderboardRefreshInterval time.Duration `yaml:"leaderboard_refresh_interval"`
+	CirculationInterval        time.Duration `yaml:"circulation_interval"`
+}
+
+// LogConfig — формат (json или text) и минимальный уровень журнала.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// TracingConfig — экспорт трассировок OpenTelemetry. Exporter: none, otlp
+// (OTLP/HTTP), stdout или file. Пустой OTLPEndpoint означает стандартные
+// переменные OTEL_EXPORTER_OTLP_*.
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	File         string  `yaml:"file"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+	ServiceName  string  `yaml:"service_name"`
+}
+
+// Default возвращает настройки по умолчанию.
+func Default() Config {
+	return Config{
+		Port:      "8080",
+		AdminHost: "127.0.0.1",
+		Storage:   "postgres",
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownDelay:     5 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            "5432",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ReadTimeout:     2 * time.Second,
+			WriteTimeout:    3 * time.Second,
+			ReportTimeout:   30 * time.Second,
+		},
+		SQLite: SQLiteConfig{
+			Path:         "merch-shop.db",
+			MaxOpenConns: 4,
+		},
+		Auth: AuthConfig{
+			RegistrationMode: "open",
+			LockoutThreshold: 5,
+			LockoutBaseDelay: time.Minute,
+			LockoutMaxDelay:  time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:    "memory",
+			Public:   LimitConfig{Requests: 30, Period: time.Minute},
+			User:     LimitConfig{Requests: 600, Period: time.Minute},
+			Mutating: LimitConfig{Requests: 60, Period: time.Minute},
+		},
+		Coins: CoinsConfig{
+			WelcomeCoins:           1000,
+			LifetimeMonths:         12,
+			ExpiryHour:             3,
+			OffboardingSettlement:  "forfeit",
+			OffboardingShopAccount: "shop",
+		},
+		Jobs: JobsConfig{
+			LeaderboardRefreshInterval: 5 * time.Minute,
+			CirculationInterval:        time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.json",
+			SampleRatio: 1,
+			ServiceName: "merch-shop",
+		},
+	}
+}
+
+// setting связывает поле конфигурации с переменной окружения и флагом.
+type setting struct {
+	env    string
+	flag   string
+	secret bool
+}
+
+// bind регистрирует флаги для всех настроек. Значения по умолчанию флагов —
+// текущие значения полей c.
+func (c *Config) bind(fs *flag.FlagSet) []setting {
+	var settings []setting
+	str := func(p *string, env, name, usage string, secret bool) {
+		fs.StringVar(p, name, *p, usage)
+		settings = append(settings, setting{env: env, flag: name, secret: secret})
+	}
+	num := func(p *int, env, name, usage string) {
+		fs.IntVar(p, name, *p, usage)
+		settings = append(settings, setting{env: env, flag: name})
+	}
+	dur := func(p *time.Duration, env, name, usage string) {
+		fs.DurationVar(p, name, *p, usage)
+		settings = append(settings, setting{env: env, flag: name})
+	}
+	float := func(p *float64, env, name, usage string) {
+		fs.Float64Var(p, name, *p, usage)
+		settings = append(settings, setting{env: env, flag: name})
+	}
+
+	str(&c.Port, "PORT", "port", "HTTP port", false)
+	str(&c.AdminPort, "ADMIN_PORT", "admin-port", "separate port for /metrics and /debug/vars", false)
+	str(&c.AdminHost, "ADMIN_HOST", "admin-host", "address the admin port listens on", false)
+	dur(&c.HTTP.ReadHeaderTimeout, "HTTP_READ_HEADER_TIMEOUT", "http-read-header-timeout", "time to read request headers")
+	dur(&c.HTTP.ReadTimeout, "HTTP_READ_TIMEOUT", "http-read-timeout", "time to read the whole request (0 disables)")
+	dur(&c.HTTP.WriteTimeout, "HTTP_WRITE_TIMEOUT", "http-write-timeout", "time to write the response (0 disables)")
+	dur(&c.HTTP.IdleTimeout, "HTTP_IDLE_TIMEOUT", "http-idle-timeout", "keep-alive connection idle timeout")
+	dur(&c.HTTP.ShutdownDelay, "SHUTDOWN_DELAY", "shutdown-delay", "time to keep serving with /readyz failing before shutdown")
+	dur(&c.HTTP.ShutdownTimeout, "SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to drain in-flight requests on shutdown")
+	str(&c.HTTP.TrustedProxies, "TRUSTED_PROXIES", "trusted-proxies", "comma-separated proxy addresses or CIDRs trusted for X-Forwarded-For", false)
+	str(&c.Storage, "STORAGE", "storage", "storage backend: postgres, sqlite or memory", false)
+
+	str(&c.Database.Host, "DB_HOST", "db-host", "Postgres host", false)
+	str(&c.Database.Port, "DB_PORT", "db-port", "Postgres port", false)
+	str(&c.Database.User, "DB_USER", "db-user", "Postgres user", false)
+	str(&c.Database.Password, "DB_PASSWORD", "db-password", "Postgres password", true)
+	str(&c.Database.Name, "DB_NAME", "db-name", "Postgres database name", false)
+	str(&c.Database.SSLMode, "DB_SSLMODE", "db-sslmode", "Postgres sslmode", false)
+	num(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open Postgres connections")
+	num(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle Postgres connections")
+	dur(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum Postgres connection lifetime")
+	dur(&c.Database.ReadTimeout, "DB_READ_TIMEOUT", "db-read-timeout", "read query timeout (0 disables)")
+	dur(&c.Database.WriteTimeout, "DB_WRITE_TIMEOUT", "db-write-timeout", "write query timeout (0 disables)")
+	dur(&c.Database.ReportTimeout, "DB_REPORT_TIMEOUT", "db-report-timeout", "report query timeout (0 disables)")
+	fs.Var(boolPtr{&c.Database.AutoMigrate}, "auto-migrate", "apply migrations on startup (default true for sqlite)")
+	settings = append(settings, setting{env: "AUTO_MIGRATE", flag: "auto-migrate"})
+
+	str(&c.SQLite.Path, "SQLITE_PATH", "sqlite-path", "SQLite database file", false)
+	num(&c.SQLite.MaxOpenConns, "SQLITE_MAX_OPEN_CONNS", "sqlite-max-open-conns", "maximum open SQLite connections")
+
+	str(&c.Auth.JWTSecret, "JWT_SECRET", "jwt-secret", "secret for signing tokens", true)
+	str(&c.Auth.SCIMToken, "SCIM_TOKEN", "scim-token", "bearer token for the SCIM provisioning API (empty disables it)", true)
+	str(&c.Auth.RegistrationMode, "REGISTRATION_MODE", "registration-mode", "registration mode: open, invite or admin", false)
+	num(&c.Auth.LockoutThreshold, "LOGIN_LOCKOUT_THRESHOLD", "login-lockout-threshold", "failed logins in a row before the account is locked (0 disables)")
+	dur(&c.Auth.LockoutBaseDelay, "LOGIN_LOCKOUT_BASE_DELAY", "login-lockout-base-delay", "first lockout duration, doubled on each further failure")
+	dur(&c.Auth.LockoutMaxDelay, "LOGIN_LOCKOUT_MAX_DELAY", "login-lockout-max-delay", "maximum lockout duration")
+
+	str(&c.RateLimit.Store, "RATE_LIMIT_STORE", "rate-limit-store", "rate limit store: memory or postgres", false)
+	num(&c.RateLimit.Public.Requests, "RATE_LIMIT_PUBLIC_REQUESTS", "rate-limit-public-requests", "requests per period per IP on public routes (0 disables)")
+	dur(&c.RateLimit.Public.Period, "RATE_LIMIT_PUBLIC_PERIOD", "rate-limit-public-period", "period of the public rate limit")
+	num(&c.RateLimit.User.Requests, "RATE_LIMIT_USER_REQUESTS", "rate-limit-user-requests", "requests per period per user (0 disables)")
+	dur(&c.RateLimit.User.Period, "RATE_LIMIT_USER_PERIOD", "rate-limit-user-period", "period of the per-user rate limit")
+	num(&c.RateLimit.Mutating.Requests, "RATE_LIMIT_MUTATING_REQUESTS", "rate-limit-mutating-requests", "mutating requests per period per user (0 disables)")
+	dur(&c.RateLimit.Mutating.Period, "RATE_LIMIT_MUTATING_PERIOD", "rate-limit-mutating-period", "period of the mutating rate limit")
+
+	num(&c.Coins.WelcomeCoins, "WELCOME_COINS", "welcome-coins", "coins granted on first login")
+	num(&c.Coins.LifetimeMonths, "COIN_LIFETIME_MONTHS", "coin-lifetime-months", "months before granted coins expire")
+	num(&c.Coins.ExpiryHour, "COIN_EXPIRY_HOUR", "coin-expiry-hour", "hour of day to expire coins")
+	str(&c.Coins.OffboardingSettlement, "OFFBOARDING_SETTLEMENT", "offboarding-settlement", "default settlement of an offboarded user's balance: forfeit or donate", false)
+	str(&c.Coins.OffboardingRecipient, "OFFBOARDING_RECIPIENT", "offboarding-recipient", "user receiving donated balances of offboarded users", false)
+	str(&c.Coins.OffboardingShopAccount, "OFFBOARDING_SHOP_ACCOUNT", "offboarding-shop-account", "inactive system account receiving forfeited balances of offboarded users", false)
+
+	dur(&c.Jobs.ReconcileInterval, "RECONCILE_INTERVAL", "reconcile-interval", "ledger reconciliation interval (0 disables)")
+	dur(&c.Jobs.LeaderboardRefreshInterval, "LEADERBOARD_REFRESH_INTERVAL", "leaderboard-refresh-interval", "leaderboard rebuild interval")
+	dur(&c.Jobs.CirculationInterval, "CIRCULATION_INTERVAL", "circulation-interval", "coins in circulation metric update interval")
+
+	str(&c.Log.Level, "LOG_LEVEL", "log-level", "log level: debug, info, warn or error", false)
+	str(&c.Log.Format, "LOG_FORMAT", "log-format", "log format: json or text", false)
+
+	str(&c.Tracing.Exporter, "TRACES_EXPORTER", "traces-exporter", "trace exporter: none, otlp, stdout or file", false)
+	str(&c.Tracing.OTLPEndpoint, "TRACES_OTLP_ENDPOINT", "traces-otlp-endpoint", "OTLP/HTTP endpoint URL, e.g. http://collector:4318", false)
+	str(&c.Tracing.File, "TRACES_FILE", "traces-file", "file for the file trace exporter", false)
+	float(&c.Tracing.SampleRatio, "TRACES_SAMPLE_RATIO", "traces-sample-ratio", "fraction of new traces to sample")
+	str(&c.Tracing.ServiceName, "TRACES_SERVICE_NAME", "traces-service-name", "service.name resource attribute", false)
+	return settings
+}
+
+// Load собирает настройки: значения по умолчанию, затем файл из флага -config
+// или переменной CONFIG_FILE, затем переменные окружения и флаги из args.
+// Для каждой переменной NAME можно задать NAME_FILE — путь к файлу со значением.
+// Возвращает аргументы, оставшиеся после флагов (подкоманду и её флаги).
+func Load(args []string) (*Config, []string, error) {
+	path := configPath(args)
+	cfg := Default()
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fs := newFlagSet()
+	fs.String("config", path, "path to YAML config file")
+	settings := cfg.bind(fs)
+	for _, s := range settings {
+		v, ok, err := lookupEnv(s.env)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := fs.Set(s.flag, v); err != nil {
+			if s.secret {
+				return nil, nil, fmt.Errorf("invalid %s", s.env)
+			}
+			return nil, nil, fmt.Errorf("invalid %s: %q", s.env, v)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// configPath находит путь к файлу настроек до разбора остальных источников.
+func configPath(args []string) string {
+	path := os.Getenv("CONFIG_FILE")
+	scratch := Default()
+	fs := newFlagSet()
+	fs.StringVar(&path, "config", path, "")
+	scratch.bind(fs)
+	fs.SetOutput(io.Discard)
+	// Ошибки разбора будут повторно обнаружены и выведены в Load.
+	fs.Parse(args)
+	return path
+}
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("merch-shop", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: merch-shop [flags] [reconcile|migrate|config] ...\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return nil
+}
+
+// lookupEnv читает переменную name или, если задана name_FILE, содержимое
+// указанного в ней файла без завершающего перевода строки.
+func lookupEnv(name string) (string, bool, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("reading %s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	v := os.Getenv(name)
+	return v, v != "", nil
+}
+
+// Validate проверяет обязательные значения и допустимые диапазоны.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port != "", "port is required")
+	check(c.AdminPort == "" || c.AdminPort != c.Port, "ADMIN_PORT must differ from PORT")
+	check(c.HTTP.ReadHeaderTimeout > 0, "HTTP_READ_HEADER_TIMEOUT must be positive")
+	check(c.HTTP.ReadTimeout >= 0, "HTTP_READ_TIMEOUT must not be negative")
+	check(c.HTTP.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT must not be negative")
+	check(c.HTTP.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT must not be negative")
+	check(c.HTTP.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(c.Auth.JWTSecret != "", "JWT_SECRET is required")
+	switch c.Auth.RegistrationMode {
+	case "open", "invite", "admin":
+	default:
+		errs = append(errs, fmt.Errorf("REGISTRATION_MODE must be open, invite or admin"))
+	}
+	check(c.Auth.LockoutThreshold >= 0, "LOGIN_LOCKOUT_THRESHOLD must not be negative")
+	if c.Auth.LockoutThreshold > 0 {
+		check(c.Auth.LockoutBaseDelay > 0, "LOGIN_LOCKOUT_BASE_DELAY must be positive")
+		check(c.Auth.LockoutMaxDelay >= c.Auth.LockoutBaseDelay, "LOGIN_LOCKOUT_MAX_DELAY must not be less than LOGIN_LOCKOUT_BASE_DELAY")
+	}
+	switch c.Storage {
+	case "postgres":
+		check(c.Database.User != "", "DB_USER is required for postgres storage")
+		check(c.Database.Name != "", "DB_NAME is required for postgres storage")
+	case "sqlite":
+		check(c.SQLite.Path != "", "SQLITE_PATH is required for sqlite storage")
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("unknown STORAGE %q", c.Storage))
+	}
+
+	check(c.Database.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Database.ReadTimeout >= 0, "DB_READ_TIMEOUT must not be negative")
+	check(c.Database.WriteTimeout >= 0, "DB_WRITE_TIMEOUT must not be negative")
+	check(c.Database.ReportTimeout >= 0, "DB_REPORT_TIMEOUT must not be negative")
+	check(c.SQLite.MaxOpenConns >= 0, "SQLITE_MAX_OPEN_CONNS must not be negative")
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "postgres":
+		check(c.Storage == "postgres", "RATE_LIMIT_STORE=postgres requires STORAGE=postgres")
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres"))
+	}
+	for _, l := range []struct {
+		name  string
+		limit LimitConfig
+	}{
+		{"PUBLIC", c.RateLimit.Public},
+		{"USER", c.RateLimit.User},
+		{"MUTATING", c.RateLimit.Mutating},
+	} {
+		check(l.limit.Requests >= 0, "RATE_LIMIT_%s_REQUESTS must not be negative", l.name)
+		check(l.limit.Requests == 0 || l.limit.Period > 0, "RATE_LIMIT_%s_PERIOD must be positive", l.name)
+	}
+	check(c.Coins.WelcomeCoins >= 0, "WELCOME_COINS must not be negative")
+	check(c.Coins.LifetimeMonths > 0, "COIN_LIFETIME_MONTHS must be positive")
+	check(c.Coins.ExpiryHour >= 0 && c.Coins.ExpiryHour <= 23, "COIN_EXPIRY_HOUR must be between 0 and 23")
+	check(c.Coins.OffboardingShopAccount != "", "OFFBOARDING_SHOP_ACCOUNT is required")
+	switch c.Coins.OffboardingSettlement {
+	case "forfeit":
+	case "donate":
+		check(c.Coins.OffboardingRecipient != "", "OFFBOARDING_RECIPIENT is required when OFFBOARDING_SETTLEMENT is donate")
+	default:
+		errs = append(errs, fmt.Errorf("OFFBOARDING_SETTLEMENT must be forfeit or donate"))
+	}
+	check(c.Jobs.ReconcileInterval >= 0, "RECONCILE_INTERVAL must not be negative")
+	check(c.Jobs.LeaderboardRefreshInterval > 0, "LEADERBOARD_REFRESH_INTERVAL must be positive")
+	check(c.Jobs.CirculationInterval > 0, "CIRCULATION_INTERVAL must be positive")
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error"))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or text"))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		check(c.Tracing.File != "", "TRACES_FILE is required for the file exporter")
+	default:
+		errs = append(errs, fmt.Errorf("TRACES_EXPORTER must be none, otlp, stdout or file"))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACES_SAMPLE_RATIO must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "TRACES_SERVICE_NAME is required")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// MigrateOnStartup сообщает, нужно ли применять миграции при запуске.
+func (c *Config) MigrateOnStartup() bool {
+	if c.Database.AutoMigrate != nil {
+		return *c.Database.AutoMigrate
+	}
+	return c.Storage == "sqlite"
+}
+
+const redacted = "[REDACTED]"
+
+// Redacted возвращает копию настроек, в которой секреты заменены заглушкой.
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = redacted
+	}
+	if c.Auth.SCIMToken != "" {
+		c.Auth.SCIMToken = redacted
+	}
+	return c
+}
+
+// Print выводит действующие настройки в формате YAML со скрытыми секретами.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// boolPtr — флаг для необязательного логического значения.
+type boolPtr struct{ p **bool }
+
+func (b boolPtr) String() string {
+	if b.p == nil || *b.p == nil {
+		return ""
+	}
+	if **b.p {
+		return "true"
+	}
+	return "false"
+}
+
+func (b boolPtr) Set(s string) error {
+	var v bool
+	switch strings.ToLower(s) {
+	case "1", "t", "true", "yes":
+		v = true
+	case "0", "f", "false", "no":
+		v = false
+	default:
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	*b.p = &v
+	return nil
+}
+
+func (b boolPtr) IsBoolFlag() bool { return true }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: "9000"
+storage: sqlite
+sqlite:
+  path: /tmp/from-file.db
+auth:
+  jwt_secret: from-file
+jobs:
+  leaderboard_refresh_interval: 1m
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9100")
+	t.Setenv("SQLITE_PATH", "/tmp/from-env.db")
+
+	cfg, args, err := Load([]string{"-port", "9200", "reconcile", "-fix"})
+	require.NoError(t, err)
+	assert.Equal(t, "9200", cfg.Port, "флаг важнее переменной окружения")
+	assert.Equal(t, "/tmp/from-env.db", cfg.SQLite.Path, "переменная окружения важнее файла")
+	assert.Equal(t, "sqlite", cfg.Storage)
+	assert.Equal(t, "from-file", cfg.Auth.JWTSecret)
+	assert.Equal(t, time.Minute, cfg.Jobs.LeaderboardRefreshInterval)
+	assert.Equal(t, 4, cfg.SQLite.MaxOpenConns, "незаданные значения берутся по умолчанию")
+	assert.Equal(t, []string{"reconcile", "-fix"}, args)
+	assert.True(t, cfg.MigrateOnStartup())
+}
+
+func TestLoad_ConfigFlag(t *testing.T) {
+	path := writeFile(t, "config.yaml", "storage: memory\nauth:\n  jwt_secret: s\n")
+	cfg, _, err := Load([]string{"-port", "9300", "-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.Storage)
+	assert.Equal(t, "9300", cfg.Port)
+	assert.False(t, cfg.MigrateOnStartup())
+}
+
+func TestLoad_SecretFile(t *testing.T) {
+	t.Setenv("STORAGE", "memory")
+	t.Setenv("JWT_SECRET", "ignored")
+	t.Setenv("JWT_SECRET_FILE", writeFile(t, "secret", "from-secret-file\n"))
+
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-secret-file", cfg.Auth.JWTSecret)
+}
+
+func TestLoad_Validation(t *testing.T) {
+	t.Setenv("STORAGE", "postgres")
+	t.Setenv("COIN_EXPIRY_HOUR", "24")
+	t.Setenv("SHUTDOWN_DELAY", "-1s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "0s")
+	t.Setenv("REGISTRATION_MODE", "closed")
+	t.Setenv("OFFBOARDING_SETTLEMENT", "donate")
+
+	_, _, err := Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JWT_SECRET is required")
+	assert.Contains(t, err.Error(), "DB_USER is required")
+	assert.Contains(t, err.Error(), "COIN_EXPIRY_HOUR must be between 0 and 23")
+	assert.Contains(t, err.Error(), "SHUTDOWN_DELAY must not be negative")
+	assert.Contains(t, err.Error(), "SHUTDOWN_TIMEOUT must be positive")
+	assert.Contains(t, err.Error(), "REGISTRATION_MODE must be open, invite or admin")
+	assert.Contains(t, err.Error(), "OFFBOARDING_RECIPIENT is required when OFFBOARDING_SETTLEMENT is donate")
+}
+
+func TestLoad_InvalidValue(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("DB_READ_TIMEOUT", "soon")
+
+	_, _, err := Load(nil)
+	assert.EqualError(t, err, `invalid DB_READ_TIMEOUT: "soon"`)
+}
+
+func TestLoad_UnknownFileField(t *testing.T) {
+	path := writeFile(t, "config.yaml", "jwt_secret: misplaced\n")
+	_, _, err := Load([]string{"-config", path})
+	assert.Error(t, err)
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = "top-secret"
+	cfg.Database.Password = "hunter2"
+	cfg.Auth.SCIMToken = "hr-token"
+
+	var buf bytes.Buffer
+	require.NoError(t, cfg.Print(&buf))
+	assert.NotContains(t, buf.String(), "top-secret")
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.NotContains(t, buf.String(), "hr-token")
+	assert.Contains(t, buf.String(), "[REDACTED]")
+	assert.Contains(t, buf.String(), "read_timeout: 2s")
+	assert.Equal(t, "top-secret", cfg.Auth.JWTSecret, "исходные настройки не меняются")
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"merch-shop/internal/config"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{Postgres, SQLite} {
+		migrations, err := loadMigrations(dialect)
+		require.NoError(t, err, dialect)
+		require.NotEmpty(t, migrations, dialect)
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version, "%s: версии должны идти подряд", dialect)
+			assert.NotEmpty(t, m.Up)
+			assert.NotEmpty(t, m.Down)
+		}
+	}
+
+	_, err := loadMigrations("mysql")
+	assert.Error(t, err)
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := ConnectSQLite(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "shop.db"), MaxOpenConns: 4})
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(m.migrations), pending)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(m.migrations))
+	_, err = db.Exec("INSERT INTO users (username, password, created_at) VALUES ('alice', 'x', CURRENT_TIMESTAMP)")
+	assert.NoError(t, err)
+
+	// Повторный запуск ничего не меняет.
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "migration %d", s.Version)
+		assert.False(t, s.Unknown)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	if assert.Len(t, rolledBack, 1) {
+		assert.Equal(t, len(m.migrations), rolledBack[0].Version)
+	}
+	pending, err = m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pending)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	pending, err = m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pending)
+}
+
+func TestMigrator_UnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	db, err := ConnectSQLite(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "shop.db"), MaxOpenConns: 4})
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)")
+	require.NoError(t, err)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	last := statuses[len(statuses)-1]
+	assert.Equal(t, 9999, last.Version)
+	assert.True(t, last.Unknown)
+}
+
+// TestMigration_WelcomeGrants проверяет, что наследный пользователь, созданный
+// до появления приветственных начислений в журнале, получает запись welcome и
+// перестаёт расходиться при сверке.
+func TestMigration_WelcomeGrants(t *testing.T) {
+	ctx := context.Background()
+	db, err := ConnectSQLite(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "shop.db"), MaxOpenConns: 4})
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+
+	legacyAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	welcomeAt := time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO users (username, password, coins, created_at) VALUES ('legacy', 'x', 1000, $1)", []interface{}{legacyAt}},
+		{"INSERT INTO users (username, password, coins, created_at) VALUES ('newbie', 'x', 1000, $1)", []interface{}{welcomeAt}},
+		{"INSERT INTO transactions (to_user_id, amount, type, reason, created_at) VALUES (2, 1000, 'grant', 'welcome', $1)", []interface{}{welcomeAt.Add(time.Millisecond)}},
+		{"INSERT INTO users (username, password, coins, created_at) VALUES ('nowelcome', 'x', 0, $1)", []interface{}{welcomeAt.AddDate(0, 1, 0)}},
+	} {
+		_, err := db.ExecContext(ctx, stmt.query, stmt.args...)
+		require.NoError(t, err, stmt.query)
+	}
+
+	repo := repository.NewSQLiteRepository(db, repository.DefaultTimeouts)
+	report, err := service.Reconcile(ctx, repo, false)
+	require.NoError(t, err)
+	if assert.Len(t, report.Discrepancies, 1) {
+		assert.Equal(t, "legacy", report.Discrepancies[0].Username)
+		assert.Equal(t, 1000, report.Discrepancies[0].Drift)
+	}
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	history, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: 1})
+	require.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, model.TransactionTypeGrant, history[0].Type)
+		assert.Equal(t, model.WelcomeGrantReason, history[0].Reason)
+		assert.Equal(t, 1000, history[0].Amount)
+		assert.True(t, legacyAt.Equal(history[0].CreatedAt))
+	}
+	for userID, want := range map[int64]int{2: 1, 3: 0} {
+		history, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: userID})
+		require.NoError(t, err)
+		assert.Len(t, history, want, "user %d", userID)
+	}
+	balance, err := repo.GetBalanceAt(ctx, 1, legacyAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1000, balance)
+
+	report, err = service.Reconcile(ctx, repo, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Discrepancies)
+
+	// Откат удаляет только добавленные записи.
+	_, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+	history, err = repo.GetHistory(ctx, model.HistoryFilter{UserID: 1})
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	history, err = repo.GetHistory(ctx, model.HistoryFilter{UserID: 2})
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
@@ -1,4 +1,6 @@
-CREATE TABLE users (
+-- Исходная схема. IF NOT EXISTS позволяет принять под учёт базу, созданную
+-- до появления миграций из schema.sql.
+CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     username TEXT UNIQUE NOT NULL,
     password TEXT NOT NULL,
@@ -6,18 +8,18 @@ CREATE TABLE users (
     created_at TIMESTAMP NOT NULL
 );
 
-CREATE TABLE transactions (
+CREATE TABLE IF NOT EXISTS transactions (
     id SERIAL PRIMARY KEY,
     from_user_id INT,
     to_user_id INT NOT NULL,
     amount INT NOT NULL,
-    type TEXT NOT NULL,  -- 'transfer' or 'purchase'
+    type TEXT NOT NULL,  -- 'transfer', 'purchase', 'adjustment', 'grant' or 'expiry'
     created_at TIMESTAMP NOT NULL,
     FOREIGN KEY (from_user_id) REFERENCES users(id),
     FOREIGN KEY (to_user_id) REFERENCES users(id)
 );
 
-CREATE TABLE purchases (
+CREATE TABLE IF NOT EXISTS purchases (
     id SERIAL PRIMARY KEY,
     user_id INT NOT NULL,
     item TEXT NOT NULL,
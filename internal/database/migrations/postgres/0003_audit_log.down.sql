@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE transactions DROP COLUMN IF EXISTS reason;
@@ -0,0 +1,9 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
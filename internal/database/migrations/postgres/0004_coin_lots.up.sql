@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS coin_lots (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount INT NOT NULL,
+    remaining INT NOT NULL,
+    granted_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
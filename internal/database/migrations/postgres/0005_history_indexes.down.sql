@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_coin_lots_expires_at;
+DROP INDEX IF EXISTS idx_coin_lots_user_id;
+DROP INDEX IF EXISTS idx_purchases_user_id;
+DROP INDEX IF EXISTS idx_transactions_from_user_id;
+DROP INDEX IF EXISTS idx_transactions_to_user_id;
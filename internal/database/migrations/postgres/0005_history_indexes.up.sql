@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_transactions_to_user_id ON transactions (to_user_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_from_user_id ON transactions (from_user_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_user_id ON purchases (user_id);
+CREATE INDEX IF NOT EXISTS idx_coin_lots_user_id ON coin_lots (user_id, expires_at) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_coin_lots_expires_at ON coin_lots (expires_at) WHERE remaining > 0;
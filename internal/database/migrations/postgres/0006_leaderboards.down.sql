@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_purchases_created_at;
+DROP INDEX IF EXISTS idx_transactions_type_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS leaderboard_opt_out;
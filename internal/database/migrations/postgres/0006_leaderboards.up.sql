@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS leaderboard_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_type_created_at ON transactions (type, created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_created_at ON purchases (created_at);
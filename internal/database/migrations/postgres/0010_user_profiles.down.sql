@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN IF EXISTS active;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS department;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
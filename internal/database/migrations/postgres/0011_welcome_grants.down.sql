@@ -0,0 +1,5 @@
+-- Удаляются только добавленные записи: они датированы моментом создания
+-- пользователя, у обычных приветственных начислений время отличается.
+DELETE FROM transactions
+WHERE type = 'grant' AND reason = 'welcome' AND from_user_id IS NULL
+    AND created_at = (SELECT u.created_at FROM users u WHERE u.id = transactions.to_user_id);
@@ -0,0 +1,17 @@
+-- Пользователи, созданные до появления приветственного начисления в журнале,
+-- получили 1000 монет без записи grant, и сверка показывала у них расхождение.
+-- Для каждого такого пользователя добавляется запись welcome на момент создания.
+-- Наследными считаются пользователи без записи welcome, созданные не позже
+-- первой из них.
+INSERT INTO transactions (from_user_id, to_user_id, amount, type, reason, created_at)
+SELECT NULL, u.id, 1000, 'grant', 'welcome', u.created_at
+FROM users u
+WHERE NOT EXISTS (
+        SELECT 1 FROM transactions t
+        WHERE t.to_user_id = u.id AND t.type = 'grant' AND t.reason = 'welcome'
+    )
+    AND u.created_at <= COALESCE(
+        (SELECT MIN(created_at) FROM transactions WHERE type = 'grant' AND reason = 'welcome'),
+        u.created_at
+    )
+ORDER BY u.id;
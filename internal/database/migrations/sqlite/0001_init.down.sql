@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS coin_lots;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS users;
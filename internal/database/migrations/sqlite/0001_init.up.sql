@@ -0,0 +1,54 @@
+-- Схема для SQLite. Повторяет миграции Postgres; время хранится в UTC в
+-- текстовом формате, который сравнивается как строка.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    coins INTEGER NOT NULL DEFAULT 1000,
+    role TEXT NOT NULL DEFAULT 'user',
+    leaderboard_opt_out BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_user_id INTEGER REFERENCES users(id),
+    to_user_id INTEGER NOT NULL REFERENCES users(id),
+    amount INTEGER NOT NULL,
+    type TEXT NOT NULL,  -- 'transfer', 'purchase', 'adjustment', 'grant' or 'expiry'
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS purchases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    item TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS coin_lots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    amount INTEGER NOT NULL,
+    remaining INTEGER NOT NULL,
+    granted_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_to_user_id ON transactions (to_user_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_from_user_id ON transactions (from_user_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_user_id ON purchases (user_id);
+CREATE INDEX IF NOT EXISTS idx_coin_lots_user_id ON coin_lots (user_id, expires_at) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_coin_lots_expires_at ON coin_lots (expires_at) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_transactions_type_created_at ON transactions (type, created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_created_at ON purchases (created_at);
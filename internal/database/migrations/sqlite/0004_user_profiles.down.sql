@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN active;
+ALTER TABLE users DROP COLUMN external_id;
+ALTER TABLE users DROP COLUMN department;
+ALTER TABLE users DROP COLUMN email;
+ALTER TABLE users DROP COLUMN display_name;
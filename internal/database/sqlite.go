@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"merch-shop/internal/config"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteParams включает внешние ключи и журнал WAL (читатели не блокируют
+// писателя), ждёт освобождения блокировки до 5 секунд вместо немедленной ошибки
+// SQLITE_BUSY и берёт блокировку на запись в начале транзакции. Время пишется
+// в формате, который понимают функции даты SQLite.
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+
+// ConnectSQLite открывает файл базы SQLite cfg.Path, создавая его при
+// необходимости. Схему создают миграции (см. Migrator).
+func ConnectSQLite(cfg config.SQLiteConfig) (*sql.DB, error) {
+	db, err := openTraced("sqlite", "file:"+cfg.Path+"?"+sqliteParams, semconv.DBSystemSqlite)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReconcileReportHandler пересчитывает балансы по журналу и возвращает найденные расхождения.
+// Ничего не исправляет.
+func ReconcileReportHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := service.Reconcile(c.Request.Context(), repo, false)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ReconcileFixHandler пересчитывает балансы и записывает корректирующие транзакции
+// для каждого найденного расхождения.
+func ReconcileFixHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := service.Reconcile(c.Request.Context(), repo, true)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GrantUserHandler начисляет монеты одному пользователю.
+func GrantUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.GrantUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		result, err := service.GrantCoins(c.Request.Context(), repo, c.GetString("username"), []string{req.ToUser}, req.Amount, req.Reason)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GrantUsersHandler начисляет монеты списку пользователей.
+func GrantUsersHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.GrantUsersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		result, err := service.GrantCoins(c.Request.Context(), repo, c.GetString("username"), req.Usernames, req.Amount, req.Reason)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GrantAllHandler начисляет монеты всем пользователям, например при квартальном пополнении.
+func GrantAllHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.GrantAllRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		result, err := service.GrantCoinsToAll(c.Request.Context(), repo, c.GetString("username"), req.Amount, req.Reason)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// AdminStatementHandler отдаёт выписки всех пользователей за период одним потоком.
+func AdminStatementHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamStatement(c, func(enc service.StatementEncoder, from, to time.Time) error {
+			return service.WriteAllStatements(c.Request.Context(), repo, enc, from, to)
+		})
+	}
+}
+
+// AnalyticsHandler отдаёт временной ряд экономики магазина: purchases (продажи и
+// выручка по товарам), balances (монеты в обращении), active-users и transfers
+// (число, объём и скорость оборота переводов). Параметры: bucket (day, week,
+// month; по умолчанию day), from и to (RFC 3339; по умолчанию последние 30 дней).
+func AnalyticsHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := model.AnalyticsQuery{Bucket: c.DefaultQuery("bucket", model.BucketDay)}
+		to, err := parseTimeQuery(c, "to")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid to"))
+			return
+		}
+		q.To = time.Now()
+		if to != nil {
+			q.To = *to
+		}
+		from, err := parseTimeQuery(c, "from")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid from"))
+			return
+		}
+		q.From = q.To.AddDate(0, 0, -30)
+		if from != nil {
+			q.From = *from
+		}
+
+		resp, err := service.GetAnalytics(c.Request.Context(), repo, c.Param("series"), q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// AdminUserInfoHandler возвращает /api/info любого пользователя, в том числе на
+// момент at, для разбора спорных ситуаций.
+func AdminUserInfoHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.Request.Context(), c.Param("username"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		at, err := parseTimeQuery(c, "at")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid at"))
+			return
+		}
+
+		info, err := service.GetInfo(c.Request.Context(), repo, user.ID, service.InfoOptions{At: at})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// LoginAttemptsHandler возвращает журнал попыток входа от новых к старым.
+// Параметры: username, ip, failed=true (только неудачные), since (RFC 3339) и limit.
+func LoginAttemptsHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f := model.LoginAttemptFilter{
+			Username:   c.Query("username"),
+			IP:         c.Query("ip"),
+			FailedOnly: c.Query("failed") == "true",
+		}
+		since, err := parseTimeQuery(c, "since")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid since"))
+			return
+		}
+		f.Since = since
+		if f.Limit, err = parseIntQuery(c, "limit"); err != nil {
+			c.Error(model.BadRequest("Invalid limit"))
+			return
+		}
+
+		attempts, err := service.ListLoginAttempts(c.Request.Context(), repo, f)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+	}
+}
+
+// SuspiciousLoginsHandler возвращает сводку неудачных попыток входа по IP
+// (by=ip, по умолчанию) или по имени пользователя (by=username). Параметры:
+// since (RFC 3339; по умолчанию последние сутки), minFailures и limit.
+func SuspiciousLoginsHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := model.LoginActivityQuery{By: c.DefaultQuery("by", model.LoginActivityByIP)}
+		since, err := parseTimeQuery(c, "since")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid since"))
+			return
+		}
+		if since != nil {
+			q.Since = *since
+		}
+		if q.MinFailures, err = parseIntQuery(c, "minFailures"); err != nil {
+			c.Error(model.BadRequest("Invalid minFailures"))
+			return
+		}
+		if q.Limit, err = parseIntQuery(c, "limit"); err != nil {
+			c.Error(model.BadRequest("Invalid limit"))
+			return
+		}
+
+		activity, err := service.GetSuspiciousLogins(c.Request.Context(), repo, q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"by": q.By, "activity": activity})
+	}
+}
+
+// UnlockLoginHandler снимает блокировку входа пользователя и сбрасывает счётчик
+// неудачных попыток. Возвращает состояние блокировки до снятия.
+func UnlockLoginHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lockout, err := service.UnlockLogin(c.Request.Context(), repo, c.GetString("username"), c.Param("username"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, lockout)
+	}
+}
+
+// OffboardUserHandler отключает пользователя и закрывает его баланс. Тело
+// запроса необязательно: settlement (forfeit или donate) и recipient; без него
+// применяется политика по умолчанию.
+func OffboardUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.OffboardRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.Error(model.BadRequest("Invalid request payload"))
+				return
+			}
+		}
+
+		resp, err := service.OffboardUser(c.Request.Context(), repo, c.GetString("username"), c.Param("username"), req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// CreateUserHandler заводит учётную запись. Работает в любом режиме регистрации;
+// в режиме admin это единственный способ добавить пользователя.
+func CreateUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.CreateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		user, err := service.ProvisionUser(c.Request.Context(), repo, c.GetString("username"), &model.User{
+			Username: req.Username,
+			Password: req.Password,
+			Role:     req.Role,
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"role":     user.Role,
+			"coins":    user.Coins,
+		})
+	}
+}
+
+// CreateInviteHandler выпускает код приглашения. Тело запроса: role, maxUses и
+// expiresAt (RFC 3339); все поля необязательны.
+func CreateInviteHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.CreateInviteRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.Error(model.BadRequest("Invalid request payload"))
+				return
+			}
+		}
+
+		invite, err := service.CreateInvite(c.Request.Context(), repo, c.GetString("username"), req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusCreated, invite)
+	}
+}
+
+// ListInvitesHandler возвращает все приглашения, новые первыми.
+func ListInvitesHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invites, err := service.ListInvites(c.Request.Context(), repo)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"invites": invites})
+	}
+}
+
+// RevokeInviteHandler отзывает приглашение и возвращает его состояние.
+func RevokeInviteHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invite, err := service.RevokeInvite(c.Request.Context(), repo, c.GetString("username"), c.Param("code"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, invite)
+	}
+}
@@ -2,8 +2,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"merch-shop/internal/logging"
 	"merch-shop/internal/middleware"
 	"merch-shop/internal/model"
 	"merch-shop/internal/repository"
@@ -13,24 +19,29 @@ import (
 )
 
 // AuthHandler обрабатывает аутентификацию и регистрацию.
-// Он вызывает сервисную функцию AuthenticateUser и генерирует JWT.
-func AuthHandler(repo repository.Repository) gin.HandlerFunc {
+// Он вызывает сервисную функцию AuthenticateUser и генерирует JWT. Если вход
+// заблокирован после неудачных попыток, ответ 429 содержит Retry-After.
+func AuthHandler(repo repository.Repository, jwtSecret []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req model.AuthRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": "Invalid request"})
+			c.Error(model.BadRequest("Invalid request"))
 			return
 		}
 
-		user, err := service.AuthenticateUser(repo, req)
+		user, err := service.AuthenticateUser(c.Request.Context(), repo, req, c.ClientIP())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			var locked *service.LockedError
+			if errors.As(err, &locked) {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(locked.Until).Seconds()))))
+			}
+			c.Error(err)
 			return
 		}
 
-		token, err := middleware.GenerateToken(user.ID, user.Username)
+		token, err := middleware.GenerateToken(jwtSecret, user.ID, user.Username, user.Role)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"errors": "Failed to generate token"})
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusOK, model.AuthResponse{Token: token})
@@ -38,19 +49,36 @@ func AuthHandler(repo repository.Repository) gin.HandlerFunc {
 }
 
 // InfoHandler возвращает информацию о монетах, инвентаре и истории транзакций.
-// Сервисный слой формирует объект InfoResponse.
+// Сервисный слой формирует объект InfoResponse. Параметр at (RFC 3339) возвращает
+// состояние на указанный момент.
 func InfoHandler(repo repository.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDVal, exists := c.Get("user_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"errors": "User not found in token"})
+			c.Error(model.ErrUnauthorized)
 			return
 		}
 		userID := userIDVal.(int64)
 
-		info, err := service.GetInfo(repo, userID)
+		var opts service.InfoOptions
+		if v := c.Query("historyLimit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				c.Error(model.BadRequest("Invalid historyLimit"))
+				return
+			}
+			opts.HistoryLimit = limit
+		}
+		at, err := parseTimeQuery(c, "at")
+		if err != nil {
+			c.Error(model.BadRequest("Invalid at"))
+			return
+		}
+		opts.At = at
+
+		info, err := service.GetInfo(c.Request.Context(), repo, userID, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusOK, info)
@@ -65,13 +93,13 @@ func SendCoinHandler(repo repository.Repository) gin.HandlerFunc {
 		senderUsername := c.GetString("username")
 		var req model.SendCoinRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": "Invalid request payload"})
+			c.Error(model.BadRequest("Invalid request payload"))
 			return
 		}
 
-		err := service.TransferCoins(repo, senderUsername, req.ToUser, req.Amount)
+		err := service.TransferCoins(c.Request.Context(), repo, senderUsername, req.ToUser, req.Amount)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "Coins transferred successfully"})
@@ -85,14 +113,184 @@ func BuyHandler(repo repository.Repository) gin.HandlerFunc {
 		username := c.GetString("username")
 		item := c.Param("item")
 		if item == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": "Item parameter is required"})
+			c.Error(model.BadRequest("Item parameter is required"))
 			return
 		}
-		err := service.PurchaseItem(repo, username, item)
+		err := service.PurchaseItem(c.Request.Context(), repo, username, item)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "Purchase successful"})
 	}
 }
+
+// HistoryHandler возвращает постраничную историю движений по счёту пользователя.
+// Поддерживает фильтры direction, type, counterparty, from и to (RFC 3339),
+// а также limit и cursor для пагинации.
+func HistoryHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := model.HistoryFilter{
+			UserID:       c.GetInt64("user_id"),
+			Direction:    c.Query("direction"),
+			Type:         c.Query("type"),
+			Counterparty: c.Query("counterparty"),
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				c.Error(model.BadRequest("Invalid limit"))
+				return
+			}
+			filter.Limit = limit
+		}
+		var err error
+		if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+			c.Error(model.BadRequest("Invalid from"))
+			return
+		}
+		if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+			c.Error(model.BadRequest("Invalid to"))
+			return
+		}
+
+		history, err := service.GetHistory(c.Request.Context(), repo, filter, c.Query("cursor"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+// parseTimeQuery разбирает необязательный query-параметр в формате RFC 3339.
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseIntQuery разбирает необязательный положительный целочисленный
+// query-параметр; отсутствующий параметр даёт 0.
+func parseIntQuery(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+// StatementHandler отдаёт выписку пользователя за период в формате CSV или JSON Lines.
+// Выписка пишется в ответ потоком по мере чтения движений из базы.
+func StatementHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		streamStatement(c, func(enc service.StatementEncoder, from, to time.Time) error {
+			return service.WriteStatement(c.Request.Context(), repo, enc, userID, from, to)
+		})
+	}
+}
+
+// streamStatement разбирает параметры from, to и format, выставляет заголовки
+// ответа и вызывает write. По умолчанию выписка строится с начала текущего месяца
+// по текущий момент в формате CSV.
+func streamStatement(c *gin.Context, write func(enc service.StatementEncoder, from, to time.Time) error) {
+	now := time.Now()
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		c.Error(model.BadRequest("Invalid from"))
+		return
+	}
+	if from == nil {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		from = &monthStart
+	}
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		c.Error(model.BadRequest("Invalid to"))
+		return
+	}
+	if to == nil {
+		to = &now
+	}
+	if !from.Before(*to) {
+		c.Error(model.ErrInvalidDateRange)
+		return
+	}
+
+	format := c.DefaultQuery("format", service.StatementFormatCSV)
+	enc, err := service.NewStatementEncoder(c.Writer, format)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == service.StatementFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename=statement."+format)
+	c.Status(http.StatusOK)
+	if err := write(enc, *from, *to); err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Error(err)
+			return
+		}
+		// Часть выписки уже отправлена, статус изменить нельзя: обрываем ответ.
+		logging.FromContext(c.Request.Context()).Error("statement aborted", "error", err)
+		c.Abort()
+	}
+}
+
+// LeaderboardHandler отдаёт рейтинг из кэша. Параметры: period (week, month,
+// quarter, all; по умолчанию month), department (отдел; по умолчанию все) и
+// limit (по умолчанию 10).
+func LeaderboardHandler(cache *service.LeaderboardCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 10
+		if v := c.Query("limit"); v != "" {
+			var err error
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit <= 0 || limit > service.LeaderboardSize {
+				c.Error(model.BadRequest("Invalid limit"))
+				return
+			}
+		}
+
+		lb, err := cache.Get(c.Request.Context(), c.Param("board"), c.DefaultQuery("period", model.PeriodMonth), c.Query("department"), limit)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, lb)
+	}
+}
+
+// LeaderboardOptOutHandler включает или выключает участие пользователя в рейтингах.
+// Изменение становится видно после очередного обновления кэша рейтингов.
+func LeaderboardOptOutHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.LeaderboardOptOutRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+		if err := service.SetLeaderboardOptOut(c.Request.Context(), repo, c.GetInt64("user_id"), req.OptOut); err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"optOut": req.OptOut})
+	}
+}
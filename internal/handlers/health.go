@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"merch-shop/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessCheckTimeout ограничивает время одной проверки готовности, чтобы
+// зависшая база не задерживала ответ пробе дольше её собственного тайм-аута.
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck — проверка, без успешного прохождения которой экземпляр не
+// принимает трафик.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// ShutdownCheck возвращает проверку, которая перестаёт проходить, как только
+// отменён ctx: получив сигнал остановки, экземпляр выводится из балансировки,
+// пока дорабатывают начатые запросы.
+func ShutdownCheck(ctx context.Context) ReadinessCheck {
+	return ReadinessCheck{Name: "shutdown", Check: func(context.Context) error {
+		if ctx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		return nil
+	}}
+}
+
+// HealthHandler отвечает 200, пока процесс жив и обслуживает запросы.
+// Зависимости не проверяет: перезапуск не поможет, если недоступна база.
+func HealthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// ReadinessHandler выполняет проверки checks и отвечает 200, если все они
+// прошли, или 503 с текстом ошибки каждой непрошедшей проверки.
+func ReadinessHandler(checks ...ReadinessCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := http.StatusOK
+		results := make(map[string]string, len(checks))
+		for _, check := range checks {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+			err := check.Check(ctx)
+			cancel()
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				results[check.Name] = err.Error()
+				logging.FromContext(c.Request.Context()).Warn("readiness check failed",
+					"check", check.Name, "error", err)
+				continue
+			}
+			results[check.Name] = "ok"
+		}
+
+		body := gin.H{"status": "ready", "checks": results}
+		if status != http.StatusOK {
+			body["status"] = "not_ready"
+		}
+		c.JSON(status, body)
+	}
+}
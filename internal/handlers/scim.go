@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/scim"
+	"merch-shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMListUsersHandler ищет пользователей. Параметры: filter (`attribute eq
+// value`), startIndex (с 1) и count.
+func SCIMListUsersHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startIndex := 1
+		if v := c.Query("startIndex"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				c.Error(model.BadRequest("Invalid startIndex"))
+				return
+			}
+			startIndex = n
+		}
+		var count *int
+		if v := c.Query("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				c.Error(model.BadRequest("Invalid count"))
+				return
+			}
+			count = &n
+		}
+
+		resp, err := service.ListSCIMUsers(c.Request.Context(), repo, c.Query("filter"), startIndex, count)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		scimJSON(c, http.StatusOK, resp)
+	}
+}
+
+// SCIMGetUserHandler возвращает пользователя по идентификатору ресурса.
+func SCIMGetUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := service.GetSCIMUser(c.Request.Context(), repo, c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		scimJSON(c, http.StatusOK, user)
+	}
+}
+
+// SCIMCreateUserHandler заводит пользователя и отвечает 201 с заголовком Location.
+func SCIMCreateUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.User
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		user, err := service.CreateSCIMUser(c.Request.Context(), repo, req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.Header("Location", user.Meta.Location)
+		scimJSON(c, http.StatusCreated, user)
+	}
+}
+
+// SCIMPatchUserHandler изменяет атрибуты пользователя, в том числе active.
+func SCIMPatchUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.PatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(model.BadRequest("Invalid request payload"))
+			return
+		}
+
+		user, err := service.PatchSCIMUser(c.Request.Context(), repo, c.Param("id"), req.Operations)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		scimJSON(c, http.StatusOK, user)
+	}
+}
+
+// SCIMDeleteUserHandler деактивирует пользователя. Учётная запись не
+// удаляется, чтобы сохранить историю переводов и покупок.
+func SCIMDeleteUserHandler(repo repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := service.DeactivateSCIMUser(c.Request.Context(), repo, c.Param("id")); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func scimJSON(c *gin.Context, status int, v interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, v)
+}
@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"context"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
+	"merch-shop/internal/repository"
+)
+
+// UpdateCirculation возвращает задачу, обновляющую метрику coins_in_circulation.
+func UpdateCirculation(repo repository.Repository) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		total, err := repo.GetCoinsInCirculation(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error("coins in circulation update failed", "job", "circulation", "error", err)
+			return
+		}
+		metrics.CoinsInCirculation.Set(float64(total))
+	}
+}
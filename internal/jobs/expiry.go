@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+)
+
+// ExpireCoins возвращает ночную задачу, которая гасит партии монет с истёкшим сроком.
+// Перед этим баланс, не покрытый партиями, оформляется в новую партию.
+func ExpireCoins(repo repository.Repository) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx = logging.With(ctx, "job", "expire_coins")
+		logger := logging.FromContext(ctx)
+		now := time.Now()
+		if err := service.BackfillCoinLots(ctx, repo, now); err != nil {
+			logger.Error("coin lot backfill failed", "error", err)
+			return
+		}
+		report, err := service.ExpireCoins(ctx, repo, now)
+		if err != nil {
+			logger.Error("coin expiry failed", "error", err)
+			return
+		}
+		metrics.CoinsExpired.Add(int64(report.ExpiredCoins))
+		logger.Info("coins expired",
+			"coins", report.ExpiredCoins, "lots", report.ExpiredLots, "users", report.Users)
+	}
+}
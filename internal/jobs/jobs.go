@@ -0,0 +1,61 @@
+// Package jobs содержит фоновые задачи, которые сервис выполняет по расписанию.
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// running учитывает запущенные задачи, чтобы при остановке Wait дождался
+// выполняющихся и хранилище не закрылось посреди записи.
+var running sync.WaitGroup
+
+// Wait ждёт, пока все задачи, запущенные Every и Daily, завершатся после отмены
+// их контекста. Каждая задача пишет в хранилище транзакциями, поэтому отмена
+// прерывает её только между ними.
+func Wait() {
+	running.Wait()
+}
+
+// Every вызывает fn каждые interval, пока не будет отменён ctx.
+// Первый запуск происходит через interval после вызова.
+func Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}()
+}
+
+// Daily вызывает fn каждый день в hour:00 по локальному времени, пока не будет отменён ctx.
+func Daily(ctx context.Context, hour int, fn func(ctx context.Context)) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				fn(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"context"
+	"merch-shop/internal/logging"
+	"merch-shop/internal/service"
+)
+
+// RefreshLeaderboards возвращает задачу фонового обновления кэша рейтингов.
+func RefreshLeaderboards(cache *service.LeaderboardCache) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx = logging.With(ctx, "job", "refresh_leaderboards")
+		if err := cache.Refresh(ctx); err != nil {
+			logging.FromContext(ctx).Error("leaderboard refresh failed", "error", err)
+		}
+	}
+}
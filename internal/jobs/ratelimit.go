@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/ratelimit"
+)
+
+// DeleteIdleRateLimits возвращает задачу, удаляющую из Postgres корзины
+// ограничения частоты, к которым не обращались дольше idle.
+func DeleteIdleRateLimits(store *ratelimit.PostgresStore, idle time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		deleted, err := store.DeleteIdle(ctx, idle)
+		if err != nil {
+			logging.FromContext(ctx).Error("rate limit cleanup failed", "job", "rate_limit_cleanup", "error", err)
+			return
+		}
+		if deleted > 0 {
+			logging.FromContext(ctx).Debug("rate limit buckets deleted", "job", "rate_limit_cleanup", "buckets", deleted)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+)
+
+// Reconcile возвращает задачу плановой сверки журнала. Задача только сообщает
+// о расхождениях и обновляет метрики, корректирующие записи не создаются.
+func Reconcile(repo repository.Repository) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx = logging.With(ctx, "job", "reconcile")
+		logger := logging.FromContext(ctx)
+		report, err := service.Reconcile(ctx, repo, false)
+		if err != nil {
+			logger.Error("reconcile failed", "error", err)
+			return
+		}
+		metrics.LedgerReconcileRuns.Add(1)
+		metrics.LedgerDriftUsers.Set(int64(len(report.Discrepancies)))
+		metrics.LedgerDriftCoins.Set(int64(report.AbsoluteDrift))
+		if len(report.Discrepancies) == 0 {
+			return
+		}
+		metrics.LedgerDriftDetected.Add(1)
+		for _, d := range report.Discrepancies {
+			logger.Warn("ledger drift detected",
+				"user_id", d.UserID, "username", d.Username, "actual", d.Actual, "expected", d.Expected)
+		}
+	}
+}
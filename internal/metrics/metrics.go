@@ -0,0 +1,19 @@
+// Package metrics публикует метрики сервиса через expvar (/debug/vars).
+package metrics
+
+import "expvar"
+
+var (
+	// LedgerReconcileRuns — число выполненных плановых сверок журнала.
+	LedgerReconcileRuns = expvar.NewInt("ledger_reconcile_runs_total")
+	// LedgerDriftDetected — число сверок, обнаруживших хотя бы одно расхождение.
+	LedgerDriftDetected = expvar.NewInt("ledger_drift_detected_total")
+	// LedgerDriftUsers — число пользователей с расхождением по итогам последней сверки.
+	LedgerDriftUsers = expvar.NewInt("ledger_drift_users")
+	// LedgerDriftCoins — сумма модулей расхождений в монетах по итогам последней
+	// сверки, так что излишки и недостачи не гасят друг друга.
+	LedgerDriftCoins = expvar.NewInt("ledger_drift_coins")
+)
+
+// CoinsExpired — общее число монет, сгоревших по истечении срока жизни.
+var CoinsExpired = expvar.NewInt("coins_expired_total")
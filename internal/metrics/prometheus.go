@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry содержит все метрики Prometheus сервиса. Кроме собственных метрик в
+// нём зарегистрированы метрики рантайма Go, процесса и счётчики expvar из этого пакета.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests — число обработанных запросов по маршруту и статусу ответа.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	// HTTPRequestDuration — длительность обработки запросов по маршруту.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"method", "route"})
+	// RateLimited — число запросов, отклонённых ограничением частоты, по бюджету.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected by rate limiting by budget.",
+	}, []string{"budget"})
+
+	// CoinsTransferred — сумма монет, переведённых между пользователями.
+	CoinsTransferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "coins_transferred_total",
+		Help: "Coins transferred between users.",
+	})
+	// Purchases — число покупок по товарам.
+	Purchases = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "purchases_total",
+		Help: "Successful purchases by item.",
+	}, []string{"item"})
+	// PurchaseFailures — число неудачных покупок по коду ошибки.
+	PurchaseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "purchase_failures_total",
+		Help: "Failed purchases by reason.",
+	}, []string{"reason"})
+	// CoinsInCirculation — сумма балансов всех пользователей на момент последнего обновления.
+	CoinsInCirculation = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "coins_in_circulation",
+		Help: "Total coins held by all users.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewExpvarCollector(map[string]*prometheus.Desc{
+			"ledger_reconcile_runs_total": prometheus.NewDesc("ledger_reconcile_runs_total", "Scheduled ledger reconciliations.", nil, nil),
+			"ledger_drift_detected_total": prometheus.NewDesc("ledger_drift_detected_total", "Reconciliations that found a discrepancy.", nil, nil),
+			"ledger_drift_users":          prometheus.NewDesc("ledger_drift_users", "Users with a discrepancy after the last reconciliation.", nil, nil),
+			"ledger_drift_coins":          prometheus.NewDesc("ledger_drift_coins", "Total drift in coins after the last reconciliation.", nil, nil),
+			"coins_expired_total":         prometheus.NewDesc("coins_expired_total", "Coins expired at the end of their lifetime.", nil, nil),
+		}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		RateLimited,
+		CoinsTransferred,
+		Purchases,
+		PurchaseFailures,
+		CoinsInCirculation,
+	)
+}
+
+// RegisterDB публикует статистику пула соединений db (sql.DBStats) с меткой db_name.
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler отдаёт метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+var statusByKind = map[model.ErrorKind]int{
+	model.KindBadRequest:        http.StatusBadRequest,
+	model.KindInvalid:           http.StatusUnprocessableEntity,
+	model.KindUnauthorized:      http.StatusUnauthorized,
+	model.KindForbidden:         http.StatusForbidden,
+	model.KindInsufficientFunds: http.StatusPaymentRequired,
+	model.KindNotFound:          http.StatusNotFound,
+	model.KindConflict:          http.StatusConflict,
+	model.KindUnavailable:       http.StatusServiceUnavailable,
+	model.KindTooManyRequests:   http.StatusTooManyRequests,
+}
+
+// ErrorMiddleware переводит ошибку, добавленную обработчиком через c.Error, в ответ
+// application/problem+json. Доменные ошибки получают статус по своему классу и
+// стабильный код, истёкший тайм-аут базы — 504, отменённый запрос — 503. На
+// остальные ошибки клиент получает 500 без подробностей, чтобы текст ошибок SQL
+// не попадал в ответ; исходная ошибка остаётся в c.Errors и попадает в журнал
+// через AccessLog. Должен подключаться раньше обработчиков и остальных middleware,
+// вызывающих c.Error.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		status, problem := translateError(err)
+		problem.Instance = c.Request.URL.Path
+		c.Header("Content-Type", "application/problem+json")
+		c.JSON(status, problem)
+	}
+}
+
+func translateError(err error) (int, model.Problem) {
+	var domainErr *model.Error
+	switch {
+	case errors.As(err, &domainErr):
+		status, ok := statusByKind[domainErr.Kind]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		return status, newProblem(status, domainErr.Code, domainErr.Message)
+	case repository.IsTimeout(err):
+		return http.StatusGatewayTimeout, newProblem(http.StatusGatewayTimeout, "timeout", "database timeout")
+	case repository.IsCanceled(err):
+		return http.StatusServiceUnavailable, newProblem(http.StatusServiceUnavailable, "request_canceled", "request canceled")
+	default:
+		return http.StatusInternalServerError, newProblem(http.StatusInternalServerError, "internal_error", "internal server error")
+	}
+}
+
+func newProblem(status int, code, detail string) model.Problem {
+	return model.Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: detail,
+	}
+}
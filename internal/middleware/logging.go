@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"merch-shop/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает длину идентификатора, пришедшего от клиента.
+const maxRequestIDLength = 128
+
+// RequestID берёт идентификатор запроса из заголовка X-Request-ID или создаёт
+// новый, возвращает его в ответе и кладёт в контекст запроса логгер с полями
+// request_id, method и path, а при активной трассировке — и trace_id. Должен
+// подключаться первым после middleware трассировки.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+
+		logger := slog.Default().With(
+			"request_id", id,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+		)
+		span := trace.SpanFromContext(c.Request.Context())
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		span.SetAttributes(attribute.String("http.request_id", id))
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog пишет строку журнала по каждому запросу: статус, длительность,
+// размер ответа и последнюю ошибку обработчика. Ответы 5xx пишутся с уровнем
+// error, 4xx — warn. Подключается сразу после RequestID.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.Last().Err.Error()))
+		}
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+// Recovery перехватывает панику обработчика, пишет её в журнал запроса вместе
+// со стеком и отвечает 500.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.FromContext(c.Request.Context()).Error("panic recovered",
+					"panic", r, "stack", string(debug.Stack()))
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// withUser добавляет к логгеру запроса и к спану запроса поля пользователя.
+func withUser(c *gin.Context, userID int64, username string) {
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(
+		attribute.Int64("enduser.id", userID),
+		attribute.String("enduser.name", username),
+	)
+	ctx := logging.With(c.Request.Context(), "user_id", userID, "username", username)
+	c.Request = c.Request.WithContext(ctx)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	_, err := logging.Setup(&buf, "json", "debug")
+	require.NoError(t, err)
+	return &buf
+}
+
+func newLoggingRouter(secret []byte, repo repository.Repository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), AccessLog(), Recovery(), ErrorMiddleware())
+	api := router.Group("/api", JWTAuthMiddleware(secret, repo))
+	api.GET("/buy/:item", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("handler")
+		c.Error(model.ErrInsufficientCoins)
+	})
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	return router
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]interface{}
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestID_HonorsIncomingHeader(t *testing.T) {
+	buf := captureLogs(t)
+	secret := []byte("test-secret")
+	repo := repository.NewMemoryRepository()
+	alice := &model.User{Username: "alice", Password: "secret"}
+	require.NoError(t, repo.CreateUser(context.Background(), alice))
+	token, err := GenerateToken(secret, alice.ID, "alice", model.RoleUser)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/buy/cup", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(RequestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	newLoggingRouter(secret, repo).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.Equal(t, "req-123", w.Header().Get(RequestIDHeader))
+
+	lines := decodeLines(t, buf)
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Equal(t, "req-123", line["request_id"])
+		assert.Equal(t, float64(alice.ID), line["user_id"])
+		assert.Equal(t, "alice", line["username"])
+	}
+	access := lines[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "WARN", access["level"])
+	assert.Equal(t, float64(http.StatusPaymentRequired), access["status"])
+	assert.Equal(t, "/api/buy/:item", access["route"])
+	assert.Equal(t, "insufficient coins", access["error"])
+}
+
+func TestRequestID_GeneratesWhenMissingOrInvalid(t *testing.T) {
+	captureLogs(t)
+	router := newLoggingRouter([]byte("test-secret"), repository.NewMemoryRepository())
+
+	for _, incoming := range []string{"", "bad id\nwith newline"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/buy/cup", nil)
+		if incoming != "" {
+			req.Header.Set(RequestIDHeader, incoming)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.NotEqual(t, incoming, id)
+	}
+}
+
+func TestRecovery_LogsPanic(t *testing.T) {
+	buf := captureLogs(t)
+	w := httptest.NewRecorder()
+	newLoggingRouter([]byte("s"), repository.NewMemoryRepository()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	lines := decodeLines(t, buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "panic recovered", lines[0]["msg"])
+	assert.Equal(t, "ERROR", lines[1]["level"])
+}
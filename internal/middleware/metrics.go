@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"merch-shop/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics считает запросы и их длительность по шаблону маршрута (например,
+// /api/buy/:item), чтобы число рядов не зависело от параметров пути. Запросы к
+// несуществующим маршрутам учитываются под меткой unmatched.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -1,37 +1,46 @@
 package middleware
 
 import (
-	"net/http"
-	"os"
+	"errors"
 	"strings"
 	"time"
 
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
-func GenerateToken(userID int64, username string) (string, error) {
+// GenerateToken выпускает токен пользователя, подписанный ключом secret.
+func GenerateToken(secret []byte, userID int64, username, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
+		"role":     role,
 		"exp":      time.Now().Add(72 * time.Hour).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(secret)
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// JWTAuthMiddleware проверяет токен, подписанный ключом secret, и сохраняет
+// данные пользователя в контексте запроса. Пользователь ищется в repo при каждом
+// запросе, поэтому токен удалённого или отключённого пользователя перестаёт
+// действовать сразу, не дожидаясь истечения срока. Имя и роль берутся из
+// хранилища, а не из токена: снятие роли admin действует немедленно.
+func JWTAuthMiddleware(secret []byte, repo repository.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "Authorization header missing"})
+			c.Error(model.ErrUnauthorized)
+			c.Abort()
 			return
 		}
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "Invalid authorization header format"})
+			c.Error(model.ErrUnauthorized)
+			c.Abort()
 			return
 		}
 		tokenStr := parts[1]
@@ -39,17 +48,49 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, jwt.ErrSignatureInvalid
 			}
-			return jwtSecret, nil
+			return secret, nil
 		})
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "Invalid token"})
+			c.Error(model.ErrUnauthorized)
+			c.Abort()
 			return
 		}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", int64(claims["user_id"].(float64)))
-			c.Set("username", claims["username"].(string))
+			userID := int64(claims["user_id"].(float64))
+			user, err := repo.GetUserByID(c.Request.Context(), userID)
+			switch {
+			case errors.Is(err, model.ErrUserNotFound):
+				c.Error(model.ErrUnauthorized)
+				c.Abort()
+				return
+			case err != nil:
+				c.Error(err)
+				c.Abort()
+				return
+			case !user.Active:
+				c.Error(model.ErrAccountInactive)
+				c.Abort()
+				return
+			}
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			c.Set("role", user.Role)
+			withUser(c, user.ID, user.Username)
 		}
 		c.Next()
 	}
 
 }
+
+// AdminMiddleware пропускает дальше только пользователей с ролью admin.
+// Должен подключаться после JWTAuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != model.RoleAdmin {
+			c.Error(model.ErrForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTAuthMiddleware_ChecksAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	secret := []byte("test-secret")
+	repo := repository.NewMemoryRepository()
+	alice := &model.User{Username: "alice", Password: "secret"}
+	require.NoError(t, repo.CreateUser(ctx, alice))
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/api/info", JWTAuthMiddleware(secret, repo), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("username"))
+	})
+	do := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, err := GenerateToken(secret, alice.ID, alice.Username, model.RoleUser)
+	require.NoError(t, err)
+	w := do(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	// Токен отключённого пользователя перестаёт действовать сразу.
+	alice.Active = false
+	require.NoError(t, repo.UpdateUserProfile(ctx, alice))
+	w = do(token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"account_inactive"`)
+
+	ghost, err := GenerateToken(secret, 42, "ghost", model.RoleUser)
+	require.NoError(t, err)
+	w = do(ghost)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestJWTAuthMiddleware_RoleFromAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	secret := []byte("test-secret")
+	repo := repository.NewMemoryRepository()
+	bob := &model.User{Username: "bob", Password: "secret", Role: model.RoleUser}
+	require.NoError(t, repo.CreateUser(ctx, bob))
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/api/admin/reconcile", JWTAuthMiddleware(secret, repo), AdminMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("username"))
+	})
+
+	// Токен выпущен, когда bob ещё был администратором; роль в хранилище уже
+	// снята, и токен больше не открывает административные маршруты.
+	token, err := GenerateToken(secret, bob.ID, bob.Username, model.RoleAdmin)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/reconcile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"forbidden"`)
+
+	// И наоборот: роль, выданная после выпуска токена, действует сразу, а имя
+	// пользователя тоже берётся из хранилища.
+	carol := &model.User{Username: "carol", Password: "secret", Role: model.RoleAdmin}
+	require.NoError(t, repo.CreateUser(ctx, carol))
+	token, err = GenerateToken(secret, carol.ID, "someone-else", model.RoleUser)
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/reconcile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "carol", w.Body.String())
+}
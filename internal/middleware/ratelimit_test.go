@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/ratelimit"
+	"merch-shop/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitRouter(t *testing.T, secret []byte) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	repo := repository.NewMemoryRepository()
+	for _, name := range []string{"alice", "bob"} {
+		require.NoError(t, repo.CreateUser(context.Background(), &model.User{Username: name, Password: "secret"}))
+	}
+	store := ratelimit.NewMemoryStore()
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router.POST("/api/auth", RateLimit(store, "public", ratelimit.Limit{Requests: 2, Period: time.Minute}, ByIP), ok)
+	api := router.Group("/api", JWTAuthMiddleware(secret, repo),
+		RateLimit(store, "user", ratelimit.Limit{Requests: 10, Period: time.Minute}, ByUser))
+	api.GET("/info", ok)
+	api.POST("/sendCoin", RateLimit(store, "mutating", ratelimit.Limit{Requests: 1, Period: time.Minute}, ByUser), ok)
+	return router
+}
+
+func TestRateLimit_PublicByIP(t *testing.T) {
+	router := newRateLimitRouter(t, []byte("test-secret"))
+	do := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1:1234").Code)
+	w = do("10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.2:1234").Code)
+}
+
+func TestRateLimit_MutatingBudget(t *testing.T) {
+	secret := []byte("test-secret")
+	router := newRateLimitRouter(t, secret)
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	alice, err := GenerateToken(secret, 1, "alice", model.RoleUser)
+	require.NoError(t, err)
+	bob, err := GenerateToken(secret, 2, "bob", model.RoleUser)
+	require.NoError(t, err)
+
+	w := do(http.MethodPost, "/api/sendCoin", alice)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// В заголовках остаётся более исчерпанный бюджет mutating.
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = do(http.MethodPost, "/api/sendCoin", alice)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Чтение расходует только общий бюджет пользователя.
+	w = do(http.MethodGet, "/api/info", alice)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "7", w.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/sendCoin", bob).Code)
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", RateLimit(ratelimit.NewMemoryStore(), "public", ratelimit.Limit{}, ByIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
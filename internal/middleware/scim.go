@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/scim"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuth пропускает запросы с заголовком Authorization: Bearer <token>.
+// Токен сравнивается за постоянное время; с пустым token отклоняются все запросы.
+func SCIMAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, got, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		if token == "" || !ok || !strings.EqualFold(scheme, "bearer") ||
+			subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Error(model.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SCIMErrors отдаёт ошибки обработчиков SCIM в формате RFC 7644 вместо
+// application/problem+json. Подключается к группе маршрутов SCIM; статус и
+// сокрытие внутренних ошибок те же, что у ErrorMiddleware.
+func SCIMErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		status, problem := translateError(c.Errors.Last().Err)
+		status, body := scim.NewError(status, problem.Code, problem.Detail)
+		c.Header("Content-Type", scim.ContentType)
+		c.JSON(status, body)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/scim"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSCIMRouter(token string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	group := router.Group("/scim/v2", SCIMErrors(), SCIMAuth(token))
+	group.GET("/Users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.POST("/Users", func(c *gin.Context) { c.Error(model.ErrUsernameTaken) })
+	return router
+}
+
+func TestSCIMAuth(t *testing.T) {
+	do := func(router *gin.Engine, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := newSCIMRouter("hr-token")
+	assert.Equal(t, http.StatusOK, do(router, "Bearer hr-token").Code)
+	assert.Equal(t, http.StatusOK, do(router, "bearer hr-token").Code)
+
+	for _, header := range []string{"", "Bearer wrong", "Basic hr-token", "hr-token"} {
+		w := do(router, header)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+		assert.Equal(t, scim.ContentType, w.Header().Get("Content-Type"), header)
+		assert.Contains(t, w.Body.String(), scim.SchemaError, header)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(newSCIMRouter(""), "Bearer ").Code)
+}
+
+func TestSCIMErrors(t *testing.T) {
+	router := newSCIMRouter("hr-token")
+	req := httptest.NewRequest(http.MethodPost, "/scim/v2/Users", nil)
+	req.Header.Set("Authorization", "Bearer hr-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, scim.ContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+		"status": "409",
+		"scimType": "uniqueness",
+		"detail": "username is already taken"
+	}`, w.Body.String())
+}
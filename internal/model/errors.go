@@ -0,0 +1,97 @@
+package model
+
+// ErrorKind определяет класс доменной ошибки. По нему HTTP-слой выбирает статус ответа.
+type ErrorKind int
+
+const (
+	KindBadRequest ErrorKind = iota + 1
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindInsufficientFunds
+	KindNotFound
+	KindConflict
+	KindUnavailable
+	KindTooManyRequests
+)
+
+// Error — доменная ошибка со стабильным машиночитаемым кодом. Code не меняется
+// между версиями и может использоваться клиентами, Message предназначено для людей.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError создаёт доменную ошибку.
+func NewError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// BadRequest возвращает ошибку разбора запроса: некорректное тело или параметр.
+func BadRequest(message string) *Error {
+	return NewError(KindBadRequest, "invalid_request", message)
+}
+
+var (
+	ErrUnauthorized       = NewError(KindUnauthorized, "unauthorized", "unauthorized")
+	ErrInvalidCredentials = NewError(KindUnauthorized, "invalid_credentials", "invalid credentials")
+	ErrForbidden          = NewError(KindForbidden, "forbidden", "admin role required")
+	ErrInvalidInvite      = NewError(KindForbidden, "invalid_invite", "invite code is invalid, expired or used up")
+	ErrAccountInactive    = NewError(KindForbidden, "account_inactive", "account is deactivated")
+
+	ErrUserNotFound   = NewError(KindNotFound, "user_not_found", "user not found")
+	ErrItemNotFound   = NewError(KindNotFound, "item_not_found", "item not found")
+	ErrInviteNotFound = NewError(KindNotFound, "invite_not_found", "invite not found")
+
+	ErrInsufficientCoins = NewError(KindInsufficientFunds, "insufficient_coins", "insufficient coins")
+
+	ErrUsernameTaken = NewError(KindConflict, "username_taken", "username is already taken")
+
+	ErrInvalidFilter     = NewError(KindBadRequest, "invalid_filter", "unsupported filter")
+	ErrInvalidPath       = NewError(KindBadRequest, "invalid_path", "unsupported attribute path")
+	ErrUsernameImmutable = NewError(KindInvalid, "username_immutable", "username cannot be changed")
+
+	ErrInvalidAmount      = NewError(KindInvalid, "invalid_amount", "amount must be positive")
+	ErrReasonRequired     = NewError(KindInvalid, "reason_required", "reason is required")
+	ErrInvalidDateRange   = NewError(KindInvalid, "invalid_date_range", "invalid date range")
+	ErrInvalidCursor      = NewError(KindInvalid, "invalid_cursor", "invalid cursor")
+	ErrInvalidDirection   = NewError(KindInvalid, "invalid_direction", "invalid direction")
+	ErrInvalidType        = NewError(KindInvalid, "invalid_type", "invalid type")
+	ErrInvalidFormat      = NewError(KindInvalid, "invalid_format", "invalid format")
+	ErrInvalidPeriod      = NewError(KindInvalid, "invalid_period", "invalid period")
+	ErrInvalidLeaderboard = NewError(KindInvalid, "invalid_leaderboard", "invalid leaderboard")
+	ErrInvalidSeries      = NewError(KindInvalid, "invalid_series", "invalid series")
+	ErrInvalidBucket      = NewError(KindInvalid, "invalid_bucket", "invalid bucket")
+	ErrTooManyBuckets     = NewError(KindInvalid, "too_many_buckets", "too many buckets")
+	ErrInvalidGrouping    = NewError(KindInvalid, "invalid_grouping", "invalid grouping")
+	ErrInvalidRole        = NewError(KindInvalid, "invalid_role", "invalid role")
+	ErrInvalidExpiry      = NewError(KindInvalid, "invalid_expiry", "expiry must be in the future")
+	ErrInvalidMaxUses     = NewError(KindInvalid, "invalid_max_uses", "maxUses must be positive")
+	ErrRecipientInactive  = NewError(KindInvalid, "recipient_inactive", "recipient account is deactivated")
+	ErrSelfTransfer       = NewError(KindInvalid, "self_transfer", "coins cannot be transferred to yourself")
+	ErrInvalidSettlement  = NewError(KindInvalid, "invalid_settlement", "settlement must be forfeit or donate")
+	ErrRecipientRequired  = NewError(KindInvalid, "recipient_required", "recipient is required to donate coins")
+	ErrInvalidRecipient   = NewError(KindInvalid, "invalid_recipient", "coins cannot be donated to the offboarded user")
+
+	ErrLeaderboardNotReady = NewError(KindUnavailable, "leaderboard_not_ready", "leaderboard is not ready")
+
+	ErrRateLimited   = NewError(KindTooManyRequests, "rate_limited", "too many requests")
+	ErrAccountLocked = NewError(KindTooManyRequests, "account_locked", "too many failed login attempts, try again later")
+)
+
+// Problem — тело ответа об ошибке в формате RFC 7807 (application/problem+json).
+// Поле errors дублирует detail для клиентов, читающих прежний формат ответа.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	Errors   string `json:"errors"`
+}
@@ -2,12 +2,58 @@ package model
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	TransactionTypeTransfer   = "transfer"
+	TransactionTypePurchase   = "purchase"
+	TransactionTypeAdjustment = "adjustment"
+	TransactionTypeGrant      = "grant"
+	TransactionTypeExpiry     = "expiry"
+)
+
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// WelcomeGrantReason — причина приветственного начисления при регистрации.
+const WelcomeGrantReason = "welcome"
+
+// User — учётная запись сотрудника. DisplayName, Email, Department и
+// ExternalID (идентификатор во внешней кадровой системе) заполняются при
+// создании через SCIM или администратором. Неактивный пользователь не может войти.
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"`
-	Coins     int       `json:"coins"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                int64     `json:"id"`
+	Username          string    `json:"username"`
+	Password          string    `json:"password"`
+	Coins             int       `json:"coins"`
+	Role              string    `json:"role"`
+	LeaderboardOptOut bool      `json:"leaderboard_opt_out"`
+	DisplayName       string    `json:"display_name"`
+	Email             string    `json:"email"`
+	Department        string    `json:"department"`
+	ExternalID        string    `json:"external_id"`
+	Active            bool      `json:"active"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// UserQuery отбирает страницу пользователей в порядке ID; пустые поля не
+// ограничивают выборку. Строковые поля, кроме ExternalID, сравниваются без учёта
+// регистра. Offset пропускает первые подходящие записи, Limit ограничивает
+// страницу; при нулевом Limit возвращается только общее число.
+type UserQuery struct {
+	Username    string
+	DisplayName string
+	Email       string
+	Department  string
+	ExternalID  string
+	Active      *bool
+	Offset      int
+	Limit       int
 }
 
 type Transaction struct {
@@ -15,7 +61,8 @@ type Transaction struct {
 	FromUserID *int64    `json:"from_user_id,omitempty"` 
 	ToUserID   int64     `json:"to_user_id"`
 	Amount     int       `json:"amount"`
-	Type       string    `json:"type"` // "transfer" или "purchase"
+	Type       string    `json:"type"` // "transfer", "purchase", "adjustment", "grant" или "expiry"
+	Reason     string    `json:"reason,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
@@ -27,6 +74,17 @@ type Purchase struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// CoinLot — партия монет с общей датой начисления. Партии расходуются в порядке
+// истечения срока (FIFO) и сгорают целиком по истечении ExpiresAt.
+type CoinLot struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Amount    int       `json:"amount"`
+	Remaining int       `json:"remaining"`
+	GrantedAt time.Time `json:"granted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type InventoryItem struct {
 	Type     string `json:"type"`
 	Quantity int    `json:"quantity"`
@@ -47,15 +105,23 @@ type CoinHistory struct {
 	Sent     []CoinHistorySent     `json:"sent"`
 }
 
+type ExpiringCoins struct {
+	Amount    int       `json:"amount"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type InfoResponse struct {
-	Coins       int             `json:"coins"`
-	Inventory   []InventoryItem `json:"inventory"`
-	CoinHistory CoinHistory     `json:"coinHistory"`
+	Coins        int             `json:"coins"`
+	Inventory    []InventoryItem `json:"inventory"`
+	CoinHistory  CoinHistory     `json:"coinHistory"`
+	ExpiringSoon []ExpiringCoins `json:"expiringSoon"`
 }
 
 type AuthRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// InviteCode нужен для регистрации, если она открыта только по приглашениям.
+	InviteCode string `json:"inviteCode,omitempty"`
 }
 
 type AuthResponse struct {
@@ -66,3 +132,350 @@ type SendCoinRequest struct {
 	ToUser string `json:"toUser" binding:"required"`
 	Amount int    `json:"amount" binding:"required,gt=0"`
 }
+
+// LedgerSummary содержит текущий баланс пользователя и агрегаты по его движениям.
+type LedgerSummary struct {
+	UserID   int64
+	Username string
+	Coins    int
+	Granted  int
+	Received int
+	Sent     int
+	Spent    int
+	Expired  int
+	Adjusted int
+}
+
+type BalanceDiscrepancy struct {
+	UserID       int64  `json:"userId"`
+	Username     string `json:"username"`
+	Actual       int    `json:"actual"`
+	Expected     int    `json:"expected"`
+	Drift        int    `json:"drift"`
+	Granted      int    `json:"granted"`
+	Received     int    `json:"received"`
+	Sent         int    `json:"sent"`
+	Spent        int    `json:"spent"`
+	Expired      int    `json:"expired"`
+	Adjusted     int    `json:"adjusted"`
+	AdjustmentID *int64 `json:"adjustmentId,omitempty"`
+}
+
+// ReconcileReport — итог сверки. TotalDrift — сумма расхождений со знаком, в
+// которой излишки и недостачи разных пользователей взаимно гасятся;
+// AbsoluteDrift — сумма их модулей.
+type ReconcileReport struct {
+	CheckedUsers  int                  `json:"checkedUsers"`
+	TotalDrift    int                  `json:"totalDrift"`
+	AbsoluteDrift int                  `json:"absoluteDrift"`
+	Fixed         bool                 `json:"fixed"`
+	Discrepancies []BalanceDiscrepancy `json:"discrepancies"`
+}
+
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type GrantUserRequest struct {
+	ToUser string `json:"toUser" binding:"required"`
+	Amount int    `json:"amount" binding:"required,gt=0"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type GrantUsersRequest struct {
+	Usernames []string `json:"usernames" binding:"required,min=1"`
+	Amount    int      `json:"amount" binding:"required,gt=0"`
+	Reason    string   `json:"reason" binding:"required"`
+}
+
+type GrantAllRequest struct {
+	Amount int    `json:"amount" binding:"required,gt=0"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type GrantResponse struct {
+	Recipients     int     `json:"recipients"`
+	Amount         int     `json:"amount"`
+	Total          int     `json:"total"`
+	Reason         string  `json:"reason"`
+	TransactionIDs []int64 `json:"transactionIds"`
+}
+
+type ExpiryReport struct {
+	ExpiredLots  int `json:"expiredLots"`
+	ExpiredCoins int `json:"expiredCoins"`
+	Users        int `json:"users"`
+}
+
+// LedgerEntry — движение по счёту пользователя с точки зрения этого пользователя.
+// Amount всегда положителен, знак задаётся Direction. Для покупок Reason содержит товар.
+type LedgerEntry struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Direction    string    `json:"direction"`
+	Amount       int       `json:"amount"`
+	Counterparty string    `json:"counterparty,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// HistoryFilter задаёт выборку истории. Записи отдаются от новых к старым,
+// BeforeID ограничивает выборку записями с меньшим ID (курсор).
+type HistoryFilter struct {
+	UserID       int64
+	Direction    string
+	Type         string
+	Counterparty string
+	From         *time.Time
+	To           *time.Time
+	BeforeID     int64
+	Limit        int
+}
+
+type HistoryResponse struct {
+	Entries    []LedgerEntry `json:"entries"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+const (
+	StatementRowOpening = "opening"
+	StatementRowEntry   = "entry"
+	StatementRowClosing = "closing"
+)
+
+// StatementRow — строка выписки. Выписка по пользователю начинается строкой
+// opening с входящим остатком, затем идут движения с остатком после каждого
+// из них, и заканчивается строкой closing с исходящим остатком.
+type StatementRow struct {
+	Kind          string    `json:"kind"`
+	UserID        int64     `json:"userId"`
+	Username      string    `json:"username"`
+	TransactionID int64     `json:"transactionId,omitempty"`
+	Type          string    `json:"type,omitempty"`
+	Direction     string    `json:"direction,omitempty"`
+	Amount        int       `json:"amount"`
+	Counterparty  string    `json:"counterparty,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Time          time.Time `json:"time"`
+	Balance       int       `json:"balance"`
+}
+
+const (
+	LeaderboardGivers    = "givers"
+	LeaderboardReceivers = "receivers"
+	LeaderboardSpenders  = "spenders"
+)
+
+const (
+	PeriodWeek    = "week"
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodAll     = "all"
+)
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Total    int    `json:"total"`
+}
+
+type Leaderboard struct {
+	Board      string             `json:"board"`
+	Period     string             `json:"period"`
+	Department string             `json:"department,omitempty"`
+	Since      *time.Time         `json:"since,omitempty"`
+	UpdatedAt  time.Time          `json:"updatedAt"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+type LeaderboardOptOutRequest struct {
+	OptOut bool `json:"optOut"`
+}
+
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// TruncateBucket повторяет date_trunc: возвращает начало дня, недели (с
+// понедельника) или месяца по UTC, в который попадает t.
+func TruncateBucket(t time.Time, bucket string) (time.Time, error) {
+	y, m, d := t.UTC().Date()
+	switch bucket {
+	case BucketDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case BucketWeek:
+		offset := (int(t.UTC().Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC), nil
+	case BucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, ErrInvalidBucket
+	}
+}
+
+// AnalyticsQuery задаёт период [From, To) и размер интервала агрегации.
+type AnalyticsQuery struct {
+	Bucket string
+	From   time.Time
+	To     time.Time
+}
+
+// BucketValue — значение показателя за интервал, начинающийся в Bucket.
+type BucketValue struct {
+	Bucket time.Time `json:"bucket"`
+	Value  int       `json:"value"`
+}
+
+type ItemSalesPoint struct {
+	Bucket    time.Time `json:"bucket"`
+	Item      string    `json:"item"`
+	Purchases int       `json:"purchases"`
+	Revenue   int       `json:"revenue"`
+}
+
+type TransferPoint struct {
+	Bucket    time.Time `json:"bucket"`
+	Transfers int       `json:"transfers"`
+	Volume    int       `json:"volume"`
+	// Velocity — отношение объёма переводов за интервал к монетам в обращении на его конец.
+	Velocity float64 `json:"velocity"`
+}
+
+type AnalyticsResponse struct {
+	Series string      `json:"series"`
+	Bucket string      `json:"bucket"`
+	From   time.Time   `json:"from"`
+	To     time.Time   `json:"to"`
+	Points interface{} `json:"points"`
+}
+
+// Исходы попытки входа.
+const (
+	LoginSuccess            = "success"
+	LoginRegistered         = "registered"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginLocked             = "locked"
+	LoginInactive           = "inactive"
+)
+
+// LoginAttempt — запись журнала попыток входа.
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Result    string    `json:"result"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Failed сообщает, была ли попытка неудачной.
+func (a LoginAttempt) Failed() bool {
+	return a.Result == LoginInvalidCredentials || a.Result == LoginLocked
+}
+
+// LoginAttemptFilter отбирает попытки входа; пустые поля не ограничивают выборку.
+// Попытки возвращаются от новых к старым.
+type LoginAttemptFilter struct {
+	Username   string
+	IP         string
+	Since      *time.Time
+	FailedOnly bool
+	Limit      int
+}
+
+// LoginLockout — счётчик неудачных входов подряд и блокировка входа по имени пользователя.
+type LoginLockout struct {
+	Username    string     `json:"username"`
+	Failures    int        `json:"failures"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// Locked сообщает, заблокирован ли вход в момент now.
+func (l *LoginLockout) Locked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
+
+const (
+	LoginActivityByIP       = "ip"
+	LoginActivityByUsername = "username"
+)
+
+// LoginActivityQuery группирует попытки входа с момента Since по IP или по имени
+// пользователя и оставляет группы, в которых не меньше MinFailures неудачных попыток.
+type LoginActivityQuery struct {
+	By          string
+	Since       time.Time
+	MinFailures int
+	Limit       int
+}
+
+// LoginActivity — сводка попыток входа с одного IP или под одним именем.
+// Много имён с одного IP указывает на перебор учётных записей, много IP для
+// одного имени — на распределённый подбор пароля.
+type LoginActivity struct {
+	IP          string    `json:"ip,omitempty"`
+	Username    string    `json:"username,omitempty"`
+	Failures    int       `json:"failures"`
+	Successes   int       `json:"successes"`
+	Usernames   int       `json:"usernames"`
+	IPs         int       `json:"ips"`
+	LastAttempt time.Time `json:"lastAttempt"`
+}
+
+// Invite — код приглашения для регистрации. Код действует до ExpiresAt и
+// принимается не больше MaxUses раз; зарегистрированные по нему пользователи
+// получают роль Role.
+type Invite struct {
+	ID        int64      `json:"id"`
+	Code      string     `json:"code"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Usable сообщает, можно ли зарегистрироваться по приглашению в момент now.
+func (i *Invite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && i.Uses < i.MaxUses && now.Before(i.ExpiresAt)
+}
+
+// CreateInviteRequest — параметры нового приглашения. Пустые поля заменяются
+// значениями по умолчанию: роль user, одно использование, срок действия неделя.
+type CreateInviteRequest struct {
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"maxUses" binding:"gte=0"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateUserRequest — учётная запись, заводимая администратором.
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// OffboardRequest — расчёт с уходящим сотрудником: settlement forfeit или
+// donate, recipient — коллега или общий фонд для donate. Пустой запрос
+// применяет политику по умолчанию.
+type OffboardRequest struct {
+	Settlement string `json:"settlement"`
+	Recipient  string `json:"recipient"`
+}
+
+// OffboardResponse — итог отключения пользователя. Amount — остаток баланса,
+// закрытый транзакцией TransactionID; при нулевом остатке транзакции нет.
+type OffboardResponse struct {
+	Username      string `json:"username"`
+	Settlement    string `json:"settlement"`
+	Recipient     string `json:"recipient,omitempty"`
+	Amount        int    `json:"amount"`
+	TransactionID *int64 `json:"transactionId,omitempty"`
+}
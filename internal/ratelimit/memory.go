@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval — как часто MemoryStore удаляет пополнившиеся корзины.
+const sweepInterval = time.Minute
+
+// MemoryStore хранит корзины в памяти процесса. Подходит для одного экземпляра
+// сервиса: у каждого экземпляра свой бюджет.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	full time.Time
+}
+
+// NewMemoryStore создаёт пустое хранилище корзин в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}
+}
+
+// Take реализует Store.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: newBucket(limit, now)}
+		s.buckets[key] = b
+	}
+	res := b.take(limit, now)
+	b.full = b.bucket.full(limit)
+	return res, nil
+}
+
+// sweep удаляет корзины, которые уже пополнились: новая корзина для того же
+// ключа будет в точности такой же. Вызывается под s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore хранит корзины в таблице rate_limit_buckets, так что все
+// экземпляры сервиса делят общий бюджет. Время берётся из часов базы, чтобы
+// расхождение часов между экземплярами не влияло на пополнение корзин.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore создаёт хранилище корзин в Postgres. Таблицу создаёт миграция
+// 0007_rate_limits.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take реализует Store. Корзина блокируется на время транзакции, поэтому
+// одновременные запросы с одним ключом не берут один и тот же токен.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (key) DO NOTHING`, key, limit.Requests)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		b   bucket
+		now time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT tokens, updated_at, now() FROM rate_limit_buckets
+		WHERE key = $1 FOR UPDATE`, key).Scan(&b.tokens, &b.updated, &now)
+	if err != nil {
+		return Result{}, err
+	}
+	res := b.take(limit, now)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1`,
+		key, b.tokens, b.updated)
+	if err != nil {
+		return Result{}, err
+	}
+	return res, tx.Commit()
+}
+
+// DeleteIdle удаляет корзины, к которым не обращались дольше idle. Такие
+// корзины уже пополнились, если idle не меньше самого длинного периода бюджета.
+func (s *PostgresStore) DeleteIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)",
+		idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
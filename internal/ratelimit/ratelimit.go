@@ -0,0 +1,86 @@
+// Package ratelimit ограничивает частоту запросов алгоритмом token bucket.
+// Состояние корзин хранится в памяти процесса или в Postgres, если экземпляров
+// сервиса несколько.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit — бюджет запросов: не больше Requests за Period. Корзина вмещает
+// Requests токенов и пополняется равномерно, так что короткий всплеск в пределах
+// бюджета проходит сразу. Нулевой Requests отключает ограничение.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled сообщает, задан ли бюджет.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// rate возвращает скорость пополнения корзины в токенах в секунду.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result — итог попытки взять токен. Reset — время до полного пополнения
+// корзины, RetryAfter — время до появления следующего токена, если запрос отклонён.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store хранит корзины по ключам.
+type Store interface {
+	// Take берёт один токен из корзины key с бюджетом limit.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket — состояние одной корзины на момент updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newBucket возвращает полную корзину.
+func newBucket(limit Limit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Requests), updated: now}
+}
+
+// take пополняет корзину за время, прошедшее с прошлого обращения, и пытается
+// взять из неё токен.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	rate := limit.rate()
+	if now.After(b.updated) {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+		b.updated = now
+	}
+
+	res := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((capacity - b.tokens) / rate)
+	return res
+}
+
+// full возвращает момент, когда корзина пополнится целиком.
+func (b *bucket) full(limit Limit) time.Time {
+	return b.updated.Add(seconds((float64(limit.Requests) - b.tokens) / limit.rate()))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
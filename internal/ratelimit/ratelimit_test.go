@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"merch-shop/internal/database"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fiveAMinute = Limit{Requests: 5, Period: time.Minute}
+
+func newTestStore(now *time.Time) *MemoryStore {
+	s := NewMemoryStore()
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestMemoryStore_BurstThenRefill(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(&now)
+	ctx := context.Background()
+
+	for i := 4; i >= 0; i-- {
+		res, err := s.Take(ctx, "k", fiveAMinute)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 5, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := s.Take(ctx, "k", fiveAMinute)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 12*time.Second, res.RetryAfter)
+	assert.Equal(t, time.Minute, res.Reset)
+
+	// Один токен пополняется за 12 секунд.
+	now = now.Add(12 * time.Second)
+	res, err = s.Take(ctx, "k", fiveAMinute)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// Другой ключ расходует свою корзину.
+	res, err = s.Take(ctx, "other", fiveAMinute)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 4, res.Remaining)
+}
+
+func TestMemoryStore_RefillIsCapped(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(&now)
+
+	_, err := s.Take(context.Background(), "k", fiveAMinute)
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	res, err := s.Take(context.Background(), "k", fiveAMinute)
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.Remaining)
+}
+
+func TestMemoryStore_SweepsFullBuckets(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(&now)
+
+	_, err := s.Take(context.Background(), "idle", fiveAMinute)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = s.Take(context.Background(), "active", fiveAMinute)
+	require.NoError(t, err)
+
+	assert.NotContains(t, s.buckets, "idle")
+	assert.Contains(t, s.buckets, "active")
+}
+
+// TestPostgresStore запускается, только если задана переменная TEST_DATABASE_DSN.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, database.Postgres)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	_, err = db.Exec("TRUNCATE rate_limit_buckets")
+	require.NoError(t, err)
+
+	s := NewPostgresStore(db)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.Take(context.Background(), "k", fiveAMinute)
+			assert.NoError(t, err)
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, allowed)
+
+	deleted, err := s.DeleteIdle(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -2,115 +2,1063 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"fmt"
+	"time"
 
 	"merch-shop/internal/model"
 )
 
+// Timeouts задаёт предельное время выполнения запросов по видам операций.
+// Нулевое значение означает, что ограничение берётся только из контекста запроса.
+type Timeouts struct {
+	// Read — точечные чтения: пользователь, инвентарь, история.
+	Read time.Duration
+	// Write — изменения баланса, транзакций, покупок и партий.
+	Write time.Duration
+	// Report — агрегирующие запросы: сверка, рейтинги, аналитика, выписки.
+	Report time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Read:   2 * time.Second,
+	Write:  3 * time.Second,
+	Report: 30 * time.Second,
+}
+
+// dbtx — общие методы *sql.DB и *sql.Tx: запросы репозитория выполняются
+// одинаково вне транзакции и внутри WithTx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// withTx открывает транзакцию на db и передаёт её fn. Если db уже транзакция,
+// fn выполняется в ней. Транзакция фиксируется, только если fn не вернул ошибку.
+func withTx(ctx context.Context, db dbtx, fn func(tx dbtx) error) error {
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 type PostgresRepository struct {
-	db *sql.DB
+	db       dbtx
+	timeouts Timeouts
+}
+
+func NewPostgresRepository(db *sql.DB, timeouts Timeouts) Repository {
+	return &PostgresRepository{db: db, timeouts: timeouts}
 }
 
-func NewPostgresRepository(db *sql.DB) Repository {
-	return &PostgresRepository{db: db}
+// userColumns — столбцы пользователя в порядке scanUser. Одинаковы для
+// Postgres и SQLite.
+const userColumns = "id, username, password, coins, role, leaderboard_opt_out, display_name, email, department, external_id, active"
+
+// scanUser читает пользователя из строки с userColumns.
+func scanUser(row interface{ Scan(...interface{}) error }, user *model.User) error {
+	return row.Scan(&user.ID, &user.Username, &user.Password, &user.Coins, &user.Role, &user.LeaderboardOptOut,
+		&user.DisplayName, &user.Email, &user.Department, &user.ExternalID, &user.Active)
 }
 
-func (r *PostgresRepository) GetUserByUsername(username string) (*model.User, error) {
-	row := r.db.QueryRow("SELECT id, username, password, coins FROM users WHERE username = $1", username)
+func (r *PostgresRepository) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username)
 	var user model.User
-	if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Coins); err != nil {
+	if err := scanUser(row, &user); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, model.ErrUserNotFound
 		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *PostgresRepository) CreateUser(user *model.User) error {
-	query := "INSERT INTO users (username, password, coins, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id"
-	return r.db.QueryRow(query, user.Username, user.Password, user.Coins).Scan(&user.ID)
+func (r *PostgresRepository) CreateUser(ctx context.Context, user *model.User) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	query := `INSERT INTO users (username, password, coins, role, display_name, email, department, external_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW()) RETURNING id`
+	err := r.db.QueryRowContext(ctx, query, user.Username, user.Password, user.Coins, user.Role,
+		user.DisplayName, user.Email, user.Department, user.ExternalID).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return model.ErrUsernameTaken
+	}
+	if err == nil {
+		user.Active = true
+	}
+	return err
+}
+
+// UpdateUserProfile сохраняет пароль, профиль и признак активности пользователя.
+// Баланс и роль не меняются.
+func (r *PostgresRepository) UpdateUserProfile(ctx context.Context, user *model.User) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `UPDATE users SET password = $1, display_name = $2, email = $3, department = $4, external_id = $5, active = $6
+		WHERE id = $7`
+	res, err := r.db.ExecContext(ctx, query, user.Password, user.DisplayName, user.Email, user.Department, user.ExternalID, user.Active, user.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		var user model.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresRepository) ListUsersPage(ctx context.Context, q model.UserQuery) ([]*model.User, int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return listUsersPage(ctx, r.db, q)
+}
+
+// listUsersPage выбирает страницу пользователей по запросу q и считает общее
+// число подходящих. Запросы одинаковы для Postgres и SQLite.
+func listUsersPage(ctx context.Context, db dbtx, q model.UserQuery) ([]*model.User, int, error) {
+	where := " WHERE TRUE"
+	var args []interface{}
+	addArg := func(cond string, v interface{}) {
+		args = append(args, v)
+		where += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	for _, c := range []struct {
+		cond  string
+		value string
+	}{
+		{"LOWER(username) = LOWER($%d)", q.Username},
+		{"LOWER(display_name) = LOWER($%d)", q.DisplayName},
+		{"LOWER(email) = LOWER($%d)", q.Email},
+		{"LOWER(department) = LOWER($%d)", q.Department},
+		{"external_id = $%d", q.ExternalID},
+	} {
+		if c.value != "" {
+			addArg(c.cond, c.value)
+		}
+	}
+	if q.Active != nil {
+		addArg("active = $%d", *q.Active)
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	users := []*model.User{}
+	if q.Limit <= 0 || q.Offset >= total {
+		return users, total, nil
+	}
+
+	args = append(args, q.Limit, q.Offset)
+	query := fmt.Sprintf("SELECT "+userColumns+" FROM users%s ORDER BY id LIMIT $%d OFFSET $%d", where, len(args)-1, len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user model.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, &user)
+	}
+	return users, total, rows.Err()
+}
+
+// GetCoinsInCirculation возвращает сумму балансов активных пользователей.
+func (r *PostgresRepository) GetCoinsInCirculation(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(coins), 0) FROM users WHERE active").Scan(&total)
+	return total, err
+}
+
+// AddCoins атомарно изменяет баланс пользователя на delta.
+func (r *PostgresRepository) AddCoins(ctx context.Context, userID int64, delta int) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET coins = coins + $1 WHERE id = $2", delta, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+// DebitCoins списывает amount монет одним условным UPDATE, поэтому баланс не
+// уходит в минус даже при одновременных списаниях.
+func (r *PostgresRepository) DebitCoins(ctx context.Context, userID int64, amount int) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1", amount, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return model.ErrUserNotFound
+	}
+	return model.ErrInsufficientCoins
+}
+
+// WithTx выполняет fn в транзакции Postgres. Репозиторий, переданный в fn,
+// выполняет все запросы в этой транзакции; вложенный WithTx использует её же.
+func (r *PostgresRepository) WithTx(ctx context.Context, fn func(repo Repository) error) error {
+	return withTx(ctx, r.db, func(tx dbtx) error {
+		return fn(&PostgresRepository{db: tx, timeouts: r.timeouts})
+	})
 }
 
-func (r *PostgresRepository) UpdateUser(user *model.User) error {
-	query := "UPDATE users SET password = $1, coins = $2 WHERE id = $3"
-	_, err := r.db.Exec(query, user.Password, user.Coins, user.ID)
+func (r *PostgresRepository) SetLeaderboardOptOut(ctx context.Context, userID int64, optOut bool) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET leaderboard_opt_out = $1 WHERE id = $2", optOut, userID)
 	return err
 }
 
-func (r *PostgresRepository) GetUserByID(userID int64) (*model.User, error) {
-	row := r.db.QueryRow("SELECT id, username, password, coins FROM users WHERE id = $1", userID)
+func (r *PostgresRepository) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID)
+	var user model.User
+	if err := scanUser(row, &user); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LockUser читает пользователя с блокировкой строки (SELECT ... FOR UPDATE):
+// до конца транзакции его баланс не изменит никто другой.
+func (r *PostgresRepository) LockUser(ctx context.Context, userID int64) (*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", userID)
 	var user model.User
-	if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Coins); err != nil {
+	if err := scanUser(row, &user); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, model.ErrUserNotFound
 		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *PostgresRepository) CreateTransaction(t *model.Transaction) error {
-	query := "INSERT INTO transactions (from_user_id, to_user_id, amount, type, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id"
-	return r.db.QueryRow(query, t.FromUserID, t.ToUserID, t.Amount, t.Type).Scan(&t.ID)
+func (r *PostgresRepository) CreateTransaction(ctx context.Context, t *model.Transaction) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO transactions (from_user_id, to_user_id, amount, type, reason, created_at) VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, t.FromUserID, t.ToUserID, t.Amount, t.Type, t.Reason).Scan(&t.ID)
 }
 
-func (r *PostgresRepository) CreatePurchase(p *model.Purchase) error {
+func (r *PostgresRepository) CreatePurchase(ctx context.Context, p *model.Purchase) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
 	query := "INSERT INTO purchases (user_id, item, price, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id"
-	return r.db.QueryRow(query, p.UserID, p.Item, p.Price).Scan(&p.ID)
+	return r.db.QueryRowContext(ctx, query, p.UserID, p.Item, p.Price).Scan(&p.ID)
 }
 
-func (r *PostgresRepository) GetPurchasesByUserID(userID int64) ([]*model.Purchase, error) {
-	rows, err := r.db.Query("SELECT id, user_id, item, price, created_at FROM purchases WHERE user_id = $1", userID)
+// GetInventoryByUserID возвращает купленные пользователем товары с количеством.
+// Если at не nil, учитываются только покупки, сделанные до момента at.
+func (r *PostgresRepository) GetInventoryByUserID(ctx context.Context, userID int64, at *time.Time) ([]model.InventoryItem, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT item, COUNT(*) FROM purchases
+		WHERE user_id = $1 AND ($2::timestamp IS NULL OR created_at < $2)
+		GROUP BY item ORDER BY item`, userID, at)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var purchases []*model.Purchase
+	var inventory []model.InventoryItem
 	for rows.Next() {
-		var p model.Purchase
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Item, &p.Price, &p.CreatedAt); err != nil {
+		var item model.InventoryItem
+		if err := rows.Scan(&item.Type, &item.Quantity); err != nil {
 			return nil, err
 		}
-		purchases = append(purchases, &p)
+		inventory = append(inventory, item)
 	}
-	return purchases, nil
+	return inventory, rows.Err()
 }
 
-func (r *PostgresRepository) GetTransactionsReceivedByUserID(userID int64) ([]*model.Transaction, error) {
-	rows, err := r.db.Query("SELECT id, from_user_id, to_user_id, amount, type, created_at FROM transactions WHERE to_user_id = $1", userID)
+// GetCoinHistoryByUserID возвращает переводы пользователя с уже подставленными
+// именами отправителей и получателей. limit > 0 оставляет в каждом списке только
+// последние limit переводов; порядок внутри списка — от старых к новым. Если at
+// не nil, учитываются только переводы, сделанные до момента at.
+func (r *PostgresRepository) GetCoinHistoryByUserID(ctx context.Context, userID int64, limit int, at *time.Time) (*model.CoinHistory, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var lim interface{}
+	if limit > 0 {
+		lim = limit
+	}
+
+	history := &model.CoinHistory{}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT username, amount FROM (
+			SELECT t.id, u.username, t.amount FROM transactions t
+			JOIN users u ON u.id = t.from_user_id
+			WHERE t.to_user_id = $1 AND t.type = 'transfer' AND ($3::timestamp IS NULL OR t.created_at < $3)
+			ORDER BY t.id DESC LIMIT $2
+		) h ORDER BY id`, userID, lim, at)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	for rows.Next() {
+		var h model.CoinHistoryReceived
+		if err := rows.Scan(&h.FromUser, &h.Amount); err != nil {
+			return nil, err
+		}
+		history.Received = append(history.Received, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	var txs []*model.Transaction
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT username, amount FROM (
+			SELECT t.id, u.username, t.amount FROM transactions t
+			JOIN users u ON u.id = t.to_user_id
+			WHERE t.from_user_id = $1 AND t.type = 'transfer' AND ($3::timestamp IS NULL OR t.created_at < $3)
+			ORDER BY t.id DESC LIMIT $2
+		) h ORDER BY id`, userID, lim, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	for rows.Next() {
-		var tx model.Transaction
-		if err := rows.Scan(&tx.ID, &tx.FromUserID, &tx.ToUserID, &tx.Amount, &tx.Type, &tx.CreatedAt); err != nil {
+		var h model.CoinHistorySent
+		if err := rows.Scan(&h.ToUser, &h.Amount); err != nil {
 			return nil, err
 		}
-		txs = append(txs, &tx)
+		history.Sent = append(history.Sent, h)
 	}
-	return txs, nil
+	return history, rows.Err()
 }
 
-func (r *PostgresRepository) GetTransactionsSentByUserID(userID int64) ([]*model.Transaction, error) {
-	rows, err := r.db.Query("SELECT id, from_user_id, to_user_id, amount, type, created_at FROM transactions WHERE from_user_id = $1", userID)
+func (r *PostgresRepository) ListLedgerSummaries(ctx context.Context) ([]*model.LedgerSummary, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query := `
+		SELECT u.id, u.username, u.coins,
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'grant'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'transfer'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE from_user_id = u.id AND type = 'transfer'), 0),
+			COALESCE((SELECT SUM(price) FROM purchases WHERE user_id = u.id), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'expiry'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'adjustment'), 0)
+		FROM users u
+		ORDER BY u.id`
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var txs []*model.Transaction
+	var summaries []*model.LedgerSummary
 	for rows.Next() {
-		var tx model.Transaction
-		if err := rows.Scan(&tx.ID, &tx.FromUserID, &tx.ToUserID, &tx.Amount, &tx.Type, &tx.CreatedAt); err != nil {
+		var s model.LedgerSummary
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Coins, &s.Granted, &s.Received, &s.Sent, &s.Spent, &s.Expired, &s.Adjusted); err != nil {
 			return nil, err
 		}
-		txs = append(txs, &tx)
+		summaries = append(summaries, &s)
+	}
+	return summaries, rows.Err()
+}
+
+func (r *PostgresRepository) CreateAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO audit_log (actor, action, details, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id, created_at"
+	return r.db.QueryRowContext(ctx, query, e.Actor, e.Action, e.Details).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r *PostgresRepository) CreateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO coin_lots (user_id, amount, remaining, granted_at, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, l.UserID, l.Amount, l.Remaining, l.GrantedAt, l.ExpiresAt).Scan(&l.ID)
+}
+
+func (r *PostgresRepository) UpdateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE coin_lots SET remaining = $1 WHERE id = $2", l.Remaining, l.ID)
+	return err
+}
+
+// GetCoinLotsByUserID возвращает непогашенные партии пользователя в порядке расходования.
+func (r *PostgresRepository) GetCoinLotsByUserID(ctx context.Context, userID int64) ([]*model.CoinLot, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	return r.queryCoinLots(ctx, `
+		SELECT id, user_id, amount, remaining, granted_at, expires_at FROM coin_lots
+		WHERE user_id = $1 AND remaining > 0
+		ORDER BY expires_at, id`, userID)
+}
+
+// GetExpiredCoinLots возвращает непогашенные партии, срок которых истёк к моменту now.
+func (r *PostgresRepository) GetExpiredCoinLots(ctx context.Context, now time.Time) ([]*model.CoinLot, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	return r.queryCoinLots(ctx, `
+		SELECT id, user_id, amount, remaining, granted_at, expires_at FROM coin_lots
+		WHERE remaining > 0 AND expires_at <= $1
+		ORDER BY expires_at, id`, now)
+}
+
+func (r *PostgresRepository) queryCoinLots(ctx context.Context, query string, args ...interface{}) ([]*model.CoinLot, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*model.CoinLot
+	for rows.Next() {
+		var l model.CoinLot
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Amount, &l.Remaining, &l.GrantedAt, &l.ExpiresAt); err != nil {
+			return nil, err
+		}
+		lots = append(lots, &l)
+	}
+	return lots, rows.Err()
+}
+
+// ledgerEntriesQuery разворачивает транзакции пользователя $1 в движения по его
+// счёту. Перевод самому себе, оставшийся от версий без проверки получателя, даёт
+// два движения, out и in, с одним номером, так что в сумме баланс не меняется,
+// как и в ListLedgerSummaries.
+const ledgerEntriesQuery = `
+	SELECT t.id, t.type, s.direction,
+		ABS(t.amount) AS amount,
+		COALESCE(cp.username, '') AS counterparty,
+		t.reason, t.created_at
+	FROM transactions t
+	JOIN (SELECT 'in' AS direction UNION ALL SELECT 'out' AS direction) s ON
+		CASE
+			WHEN t.type = 'transfer' THEN
+				(s.direction = 'out' AND t.from_user_id = $1) OR (s.direction = 'in' AND t.to_user_id = $1)
+			WHEN t.type IN ('purchase', 'expiry') THEN s.direction = 'out'
+			WHEN t.type = 'adjustment' AND t.amount < 0 THEN s.direction = 'out'
+			ELSE s.direction = 'in'
+		END
+	LEFT JOIN users cp ON cp.id = CASE WHEN s.direction = 'out' AND t.from_user_id = $1 THEN t.to_user_id ELSE t.from_user_id END
+	WHERE t.to_user_id = $1 OR t.from_user_id = $1`
+
+func (r *PostgresRepository) GetHistory(ctx context.Context, f model.HistoryFilter) ([]*model.LedgerEntry, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query := "SELECT id, type, direction, amount, counterparty, reason, created_at FROM (" + ledgerEntriesQuery + ") h WHERE TRUE"
+	args := []interface{}{f.UserID}
+	addArg := func(cond string, v interface{}) {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if f.Direction != "" {
+		addArg("direction = $%d", f.Direction)
+	}
+	if f.Type != "" {
+		addArg("type = $%d", f.Type)
+	}
+	if f.Counterparty != "" {
+		addArg("counterparty = $%d", f.Counterparty)
+	}
+	if f.From != nil {
+		addArg("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		addArg("created_at < $%d", *f.To)
+	}
+	if f.BeforeID > 0 {
+		addArg("id < $%d", f.BeforeID)
+	}
+	query += " ORDER BY id DESC, direction"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*model.LedgerEntry
+	for rows.Next() {
+		var e model.LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Type, &e.Direction, &e.Amount, &e.Counterparty, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// GetBalanceAt восстанавливает баланс пользователя по журналу на момент at
+// (движения в момент at не учитываются). Перевод самому себе даёт списание и
+// зачисление, как в ListLedgerSummaries, поэтому итог сходится со сверкой.
+func (r *PostgresRepository) GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query := "SELECT COALESCE(SUM(CASE WHEN direction = 'out' THEN -amount ELSE amount END), 0) FROM (" +
+		ledgerEntriesQuery + ") h WHERE created_at < $2"
+	var balance int
+	err := r.db.QueryRowContext(ctx, query, userID, at).Scan(&balance)
+	return balance, err
+}
+
+// StreamLedger передаёт в fn движения пользователя за период [from, to) от старых
+// к новым, не загружая их в память целиком. Ошибка fn прерывает обход.
+func (r *PostgresRepository) StreamLedger(ctx context.Context, userID int64, from, to time.Time, fn func(*model.LedgerEntry) error) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query := "SELECT id, type, direction, amount, counterparty, reason, created_at FROM (" +
+		ledgerEntriesQuery + ") h WHERE created_at >= $2 AND created_at < $3 ORDER BY created_at, id, direction DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Type, &e.Direction, &e.Amount, &e.Counterparty, &e.Reason, &e.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var leaderboardQueries = map[string]string{
+	model.LeaderboardGivers: `
+		SELECT u.username, SUM(t.amount) AS total FROM transactions t
+		JOIN users u ON u.id = t.from_user_id
+		WHERE t.type = 'transfer' AND NOT u.leaderboard_opt_out AND ($1::timestamp IS NULL OR t.created_at >= $1)
+			AND ($2::text = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+	model.LeaderboardReceivers: `
+		SELECT u.username, SUM(t.amount) AS total FROM transactions t
+		JOIN users u ON u.id = t.to_user_id
+		WHERE t.type = 'transfer' AND NOT u.leaderboard_opt_out AND ($1::timestamp IS NULL OR t.created_at >= $1)
+			AND ($2::text = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+	model.LeaderboardSpenders: `
+		SELECT u.username, SUM(p.price) AS total FROM purchases p
+		JOIN users u ON u.id = p.user_id
+		WHERE NOT u.leaderboard_opt_out AND ($1::timestamp IS NULL OR p.created_at >= $1)
+			AND ($2::text = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+}
+
+// GetLeaderboard возвращает первые limit участников рейтинга board с момента since
+// (nil — за всё время) среди сотрудников отдела department (пустая строка — все
+// отделы; регистр не учитывается). Пользователи, отказавшиеся от рейтингов, не
+// учитываются.
+func (r *PostgresRepository) GetLeaderboard(ctx context.Context, board string, since *time.Time, department string, limit int) ([]model.LeaderboardEntry, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query, ok := leaderboardQueries[board]
+	if !ok {
+		return nil, model.ErrInvalidLeaderboard
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY total DESC, u.username LIMIT $3", since, department, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.LeaderboardEntry
+	for rows.Next() {
+		var e model.LeaderboardEntry
+		if err := rows.Scan(&e.Username, &e.Total); err != nil {
+			return nil, err
+		}
+		e.Rank = len(entries) + 1
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *PostgresRepository) GetItemSales(ctx context.Context, q model.AnalyticsQuery) ([]model.ItemSalesPoint, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT date_trunc($1, created_at) AS bucket, item, COUNT(*), SUM(price) FROM purchases
+		WHERE created_at >= $2 AND created_at < $3
+		GROUP BY bucket, item
+		ORDER BY bucket, item`, q.Bucket, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.ItemSalesPoint
+	for rows.Next() {
+		var p model.ItemSalesPoint
+		if err := rows.Scan(&p.Bucket, &p.Item, &p.Purchases, &p.Revenue); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// supplyDeltaSQL — изменение числа монет в обращении, вызванное транзакцией.
+// Переводы перемещают монеты между пользователями и на обращение не влияют.
+const supplyDeltaSQL = `CASE
+	WHEN type = 'grant' THEN amount
+	WHEN type IN ('purchase', 'expiry') THEN -amount
+	WHEN type = 'adjustment' THEN amount
+	ELSE 0
+END`
+
+// GetCoinSupplyChanges возвращает число монет в обращении на начало периода и
+// его изменение по интервалам. Интервалы без изменений не возвращаются.
+func (r *PostgresRepository) GetCoinSupplyChanges(ctx context.Context, q model.AnalyticsQuery) (int, []model.BucketValue, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	var opening int
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM("+supplyDeltaSQL+"), 0) FROM transactions WHERE created_at < $1", q.From).Scan(&opening); err != nil {
+		return 0, nil, err
+	}
+	changes, err := r.queryBucketValues(ctx, `
+		SELECT date_trunc($1, created_at) AS bucket, SUM(`+supplyDeltaSQL+`) FROM transactions
+		WHERE created_at >= $2 AND created_at < $3
+		GROUP BY bucket
+		ORDER BY bucket`, q.Bucket, q.From, q.To)
+	return opening, changes, err
+}
+
+// GetActiveUsers возвращает число пользователей, совершивших перевод или покупку
+// либо получивших перевод, по интервалам.
+func (r *PostgresRepository) GetActiveUsers(ctx context.Context, q model.AnalyticsQuery) ([]model.BucketValue, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	return r.queryBucketValues(ctx, `
+		SELECT date_trunc($1, created_at) AS bucket, COUNT(DISTINCT user_id) FROM (
+			SELECT created_at, to_user_id AS user_id FROM transactions WHERE type IN ('transfer', 'purchase')
+			UNION ALL
+			SELECT created_at, from_user_id FROM transactions WHERE type = 'transfer'
+		) a
+		WHERE created_at >= $2 AND created_at < $3
+		GROUP BY bucket
+		ORDER BY bucket`, q.Bucket, q.From, q.To)
+}
+
+func (r *PostgresRepository) GetTransferVolume(ctx context.Context, q model.AnalyticsQuery) ([]model.TransferPoint, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT date_trunc($1, created_at) AS bucket, COUNT(*), SUM(amount) FROM transactions
+		WHERE type = 'transfer' AND created_at >= $2 AND created_at < $3
+		GROUP BY bucket
+		ORDER BY bucket`, q.Bucket, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.TransferPoint
+	for rows.Next() {
+		var p model.TransferPoint
+		if err := rows.Scan(&p.Bucket, &p.Transfers, &p.Volume); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func (r *PostgresRepository) queryBucketValues(ctx context.Context, query string, args ...interface{}) ([]model.BucketValue, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []model.BucketValue
+	for rows.Next() {
+		var v model.BucketValue
+		if err := rows.Scan(&v.Bucket, &v.Value); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func (r *PostgresRepository) CreateLoginAttempt(ctx context.Context, a *model.LoginAttempt) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	a.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO login_attempts (username, ip, result, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, a.Username, a.IP, a.Result, a.CreatedAt).Scan(&a.ID)
+}
+
+// loginAttemptsQuery строит выборку попыток входа по фильтру f. Запрос
+// одинаков для Postgres и SQLite.
+func loginAttemptsQuery(f model.LoginAttemptFilter) (string, []interface{}) {
+	query := "SELECT id, username, ip, result, created_at FROM login_attempts WHERE TRUE"
+	var args []interface{}
+	addArg := func(cond string, v interface{}) {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if f.Username != "" {
+		addArg("username = $%d", f.Username)
+	}
+	if f.IP != "" {
+		addArg("ip = $%d", f.IP)
+	}
+	if f.Since != nil {
+		addArg("created_at >= $%d", f.Since.UTC())
+	}
+	if f.FailedOnly {
+		query += fmt.Sprintf(" AND result IN ('%s', '%s')", model.LoginInvalidCredentials, model.LoginLocked)
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+// loginActivityColumns — столбцы, по которым группируется сводка попыток входа.
+var loginActivityColumns = map[string]string{
+	model.LoginActivityByIP:       "ip",
+	model.LoginActivityByUsername: "username",
+}
+
+// loginActivityQuery строит сводку попыток входа по запросу q. Запрос одинаков
+// для Postgres и SQLite.
+func loginActivityQuery(q model.LoginActivityQuery) (string, []interface{}, error) {
+	column, ok := loginActivityColumns[q.By]
+	if !ok {
+		return "", nil, model.ErrInvalidGrouping
+	}
+	failed := fmt.Sprintf("CASE WHEN result IN ('%s', '%s') THEN 1 ELSE 0 END", model.LoginInvalidCredentials, model.LoginLocked)
+	query := fmt.Sprintf(`
+		SELECT %[1]s, SUM(%[2]s) AS failures, COUNT(*) - SUM(%[2]s) AS successes,
+			COUNT(DISTINCT username), COUNT(DISTINCT ip), MAX(created_at) AS last_attempt
+		FROM login_attempts
+		WHERE created_at >= $1
+		GROUP BY %[1]s
+		HAVING SUM(%[2]s) >= $2
+		ORDER BY failures DESC, last_attempt DESC, %[1]s`, column, failed)
+	args := []interface{}{q.Since.UTC(), q.MinFailures}
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += " LIMIT $3"
+	}
+	return query, args, nil
+}
+
+// setLoginActivityKey записывает значение столбца группировки в поле a.
+func setLoginActivityKey(a *model.LoginActivity, by, key string) {
+	if by == model.LoginActivityByIP {
+		a.IP = key
+	} else {
+		a.Username = key
+	}
+}
+
+func (r *PostgresRepository) ListLoginAttempts(ctx context.Context, f model.LoginAttemptFilter) ([]*model.LoginAttempt, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query, args := loginAttemptsQuery(f)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*model.LoginAttempt
+	for rows.Next() {
+		var a model.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.Username, &a.IP, &a.Result, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &a)
+	}
+	return attempts, rows.Err()
+}
+
+func (r *PostgresRepository) GetLoginActivity(ctx context.Context, q model.LoginActivityQuery) ([]model.LoginActivity, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query, args, err := loginActivityQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []model.LoginActivity
+	for rows.Next() {
+		var a model.LoginActivity
+		var key string
+		if err := rows.Scan(&key, &a.Failures, &a.Successes, &a.Usernames, &a.IPs, &a.LastAttempt); err != nil {
+			return nil, err
+		}
+		setLoginActivityKey(&a, q.By, key)
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+func (r *PostgresRepository) GetLoginLockout(ctx context.Context, username string) (*model.LoginLockout, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	l := &model.LoginLockout{Username: username}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, "SELECT failures, locked_until FROM login_lockouts WHERE username = $1", username).
+		Scan(&l.Failures, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		l.LockedUntil = &lockedUntil.Time
+	}
+	return l, nil
+}
+
+// RecordLoginFailure атомарно увеличивает счётчик неудачных входов подряд и
+// возвращает новое значение.
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, username string) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_lockouts (username, failures) VALUES ($1, 1)
+		ON CONFLICT (username) DO UPDATE SET failures = login_lockouts.failures + 1
+		RETURNING failures`, username).Scan(&failures)
+	return failures, err
+}
+
+func (r *PostgresRepository) LockLogin(ctx context.Context, username string, until time.Time) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE login_lockouts SET locked_until = $1 WHERE username = $2", until.UTC(), username)
+	return err
+}
+
+// ResetLoginFailures сбрасывает счётчик неудачных входов и снимает блокировку.
+func (r *PostgresRepository) ResetLoginFailures(ctx context.Context, username string) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_lockouts WHERE username = $1", username)
+	return err
+}
+
+// inviteColumns — столбцы приглашения в порядке scanInvite. Одинаковы для
+// Postgres и SQLite.
+const inviteColumns = "id, code, role, max_uses, uses, expires_at, created_by, created_at, revoked_at"
+
+// scanInvite читает приглашение из строки с inviteColumns.
+func scanInvite(row interface{ Scan(...interface{}) error }) (*model.Invite, error) {
+	var inv model.Invite
+	var revokedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.Code, &inv.Role, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.CreatedBy, &inv.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		inv.RevokedAt = &revokedAt.Time
+	}
+	return &inv, nil
+}
+
+func (r *PostgresRepository) CreateInvite(ctx context.Context, inv *model.Invite) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	inv.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO invites (code, role, max_uses, expires_at, created_by, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, inv.Code, inv.Role, inv.MaxUses, inv.ExpiresAt.UTC(), inv.CreatedBy, inv.CreatedAt).Scan(&inv.ID)
+}
+
+func (r *PostgresRepository) GetInvite(ctx context.Context, code string) (*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	inv, err := scanInvite(r.db.QueryRowContext(ctx, "SELECT "+inviteColumns+" FROM invites WHERE code = $1", code))
+	if err == sql.ErrNoRows {
+		return nil, model.ErrInviteNotFound
+	}
+	return inv, err
+}
+
+// ListInvites возвращает все приглашения, новые первыми.
+func (r *PostgresRepository) ListInvites(ctx context.Context) ([]*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+inviteColumns+" FROM invites ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*model.Invite
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// RedeemInvite атомарно засчитывает использование приглашения, если оно не
+// отозвано, не истекло к моменту now и не исчерпано. Иначе возвращает
+// model.ErrInvalidInvite.
+func (r *PostgresRepository) RedeemInvite(ctx context.Context, code string, now time.Time) (*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	inv, err := scanInvite(r.db.QueryRowContext(ctx, `
+		UPDATE invites SET uses = uses + 1
+		WHERE code = $1 AND revoked_at IS NULL AND uses < max_uses AND expires_at > $2
+		RETURNING `+inviteColumns, code, now.UTC()))
+	if err == sql.ErrNoRows {
+		return nil, model.ErrInvalidInvite
+	}
+	return inv, err
+}
+
+// RevokeInvite отзывает приглашение; повторный отзыв не меняет время отзыва.
+func (r *PostgresRepository) RevokeInvite(ctx context.Context, code string, at time.Time) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE invites SET revoked_at = COALESCE(revoked_at, $1) WHERE code = $2", at.UTC(), code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrInviteNotFound
 	}
-	return txs, nil
+	return nil
 }
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Коды ошибок Postgres, которые репозиторий переводит в доменные ошибки.
+const (
+	queryCanceledCode   = "57014"
+	uniqueViolationCode = "23505"
+)
+
+// IsTimeout сообщает, что операция не уложилась в отведённое время: истёк
+// контекст запроса или Postgres отменил запрос по тайм-ауту.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == queryCanceledCode
+}
+
+// IsCanceled сообщает, что операция прервана, потому что клиент закрыл соединение.
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// isUniqueViolation сообщает, что запись нарушила ограничение уникальности.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode
+}
@@ -0,0 +1,1059 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"merch-shop/internal/model"
+)
+
+// MemoryRepository хранит данные в памяти процесса. Предназначен для локальной
+// разработки (STORAGE=memory) и тестов; поведение повторяет PostgresRepository:
+// уникальные имена пользователей, те же ошибки и тот же порядок выборок.
+// Все методы безопасны для одновременного вызова из нескольких горутин.
+type MemoryRepository struct {
+	mu rwLocker
+	*memoryData
+	// undo — журнал отката транзакции; nil вне WithTx.
+	undo *[]func()
+}
+
+// memoryData — содержимое хранилища. Репозиторий внутри WithTx работает с теми
+// же данными, но без собственной блокировки.
+type memoryData struct {
+	users         []model.User
+	userIndex     map[string]int
+	transactions  []model.Transaction
+	purchases     []model.Purchase
+	audits        []model.AuditEntry
+	lots          []model.CoinLot
+	loginAttempts []model.LoginAttempt
+	lockouts      map[string]model.LoginLockout
+	invites       []model.Invite
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{
+		mu: &sync.RWMutex{},
+		memoryData: &memoryData{
+			userIndex: make(map[string]int),
+			lockouts:  make(map[string]model.LoginLockout),
+		},
+	}
+}
+
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// noLock — блокировка репозитория внутри WithTx: хранилище уже заблокировано
+// на запись на всё время транзакции.
+type noLock struct{}
+
+func (noLock) Lock()    {}
+func (noLock) Unlock()  {}
+func (noLock) RLock()   {}
+func (noLock) RUnlock() {}
+
+// WithTx выполняет fn, удерживая блокировку хранилища на запись, поэтому
+// транзакции выполняются по очереди. Каждое изменение внутри fn записывает в
+// журнал действие, возвращающее прежнее значение; если fn вернул ошибку, журнал
+// выполняется в обратном порядке. Так откат стоит столько, сколько записей
+// изменил fn, а не сколько данных в хранилище. Репозиторий, переданный в fn,
+// нельзя использовать после возврата из WithTx; вложенный WithTx выполняется в
+// той же транзакции.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(repo Repository) error) error {
+	if _, ok := r.mu.(noLock); ok {
+		return fn(r)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var undo []func()
+	if err := fn(&MemoryRepository{mu: noLock{}, memoryData: r.memoryData, undo: &undo}); err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+// onRollback добавляет в журнал отката действие, отменяющее изменение. Вне
+// WithTx ничего не делает. Вызывается под блокировкой.
+func (r *MemoryRepository) onRollback(fn func()) {
+	if r.undo != nil {
+		*r.undo = append(*r.undo, fn)
+	}
+}
+
+// saveUser запоминает пользователя перед изменением для отката транзакции.
+func (r *MemoryRepository) saveUser(u *model.User) {
+	prev := *u
+	r.onRollback(func() { r.users[prev.ID-1] = prev })
+}
+
+// saveLockout запоминает состояние блокировки входа перед изменением для отката
+// транзакции.
+func (r *MemoryRepository) saveLockout(username string) {
+	prev, ok := r.lockouts[username]
+	r.onRollback(func() {
+		if ok {
+			r.lockouts[username] = prev
+		} else {
+			delete(r.lockouts, username)
+		}
+	})
+}
+
+// user возвращает пользователя по ID. Вызывается под блокировкой.
+func (r *MemoryRepository) user(userID int64) *model.User {
+	if userID <= 0 || int(userID) > len(r.users) {
+		return nil
+	}
+	return &r.users[userID-1]
+}
+
+// username возвращает имя пользователя или пустую строку, если его нет.
+func (r *MemoryRepository) username(userID *int64) string {
+	if userID == nil {
+		return ""
+	}
+	if u := r.user(*userID); u != nil {
+		return u.Username
+	}
+	return ""
+}
+
+func (r *MemoryRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, ok := r.userIndex[username]
+	if !ok {
+		return nil, model.ErrUserNotFound
+	}
+	user := r.users[i]
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u := r.user(userID)
+	if u == nil {
+		return nil, model.ErrUserNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+// LockUser читает пользователя. Внутри WithTx хранилище и так заблокировано
+// на запись целиком.
+func (r *MemoryRepository) LockUser(ctx context.Context, userID int64) (*model.User, error) {
+	return r.GetUserByID(ctx, userID)
+}
+
+func (r *MemoryRepository) CreateUser(ctx context.Context, user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.userIndex[user.Username]; exists {
+		return model.ErrUsernameTaken
+	}
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	n, username := len(r.users), user.Username
+	r.onRollback(func() {
+		r.users = r.users[:n]
+		delete(r.userIndex, username)
+	})
+	user.ID = int64(len(r.users) + 1)
+	r.userIndex[user.Username] = len(r.users)
+	user.Active = true
+	r.users = append(r.users, model.User{
+		ID:          user.ID,
+		Username:    user.Username,
+		Password:    user.Password,
+		Coins:       user.Coins,
+		Role:        user.Role,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Department:  user.Department,
+		ExternalID:  user.ExternalID,
+		Active:      true,
+	})
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUserProfile(ctx context.Context, user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u := r.user(user.ID)
+	if u == nil {
+		return model.ErrUserNotFound
+	}
+	r.saveUser(u)
+	u.Password = user.Password
+	u.DisplayName = user.DisplayName
+	u.Email = user.Email
+	u.Department = user.Department
+	u.ExternalID = user.ExternalID
+	u.Active = user.Active
+	return nil
+}
+
+func (r *MemoryRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*model.User
+	for _, u := range r.users {
+		user := u
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+func (r *MemoryRepository) ListUsersPage(ctx context.Context, q model.UserQuery) ([]*model.User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []*model.User{}
+	total := 0
+	for _, u := range r.users {
+		if !matchUserQuery(&u, q) {
+			continue
+		}
+		total++
+		if total > q.Offset && len(users) < q.Limit {
+			user := u
+			users = append(users, &user)
+		}
+	}
+	return users, total, nil
+}
+
+// matchUserQuery сообщает, подходит ли пользователь под условия q.
+func matchUserQuery(u *model.User, q model.UserQuery) bool {
+	for _, c := range []struct{ got, want string }{
+		{u.Username, q.Username},
+		{u.DisplayName, q.DisplayName},
+		{u.Email, q.Email},
+		{u.Department, q.Department},
+	} {
+		if c.want != "" && !strings.EqualFold(c.got, c.want) {
+			return false
+		}
+	}
+	return (q.ExternalID == "" || u.ExternalID == q.ExternalID) &&
+		(q.Active == nil || u.Active == *q.Active)
+}
+
+// GetCoinsInCirculation возвращает сумму балансов активных пользователей.
+func (r *MemoryRepository) GetCoinsInCirculation(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := 0
+	for _, u := range r.users {
+		if u.Active {
+			total += u.Coins
+		}
+	}
+	return total, nil
+}
+
+// AddCoins атомарно изменяет баланс пользователя на delta.
+func (r *MemoryRepository) AddCoins(ctx context.Context, userID int64, delta int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u := r.user(userID)
+	if u == nil {
+		return model.ErrUserNotFound
+	}
+	r.saveUser(u)
+	u.Coins += delta
+	return nil
+}
+
+// DebitCoins списывает amount монет, если их хватает на балансе.
+func (r *MemoryRepository) DebitCoins(ctx context.Context, userID int64, amount int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u := r.user(userID)
+	if u == nil {
+		return model.ErrUserNotFound
+	}
+	if u.Coins < amount {
+		return model.ErrInsufficientCoins
+	}
+	r.saveUser(u)
+	u.Coins -= amount
+	return nil
+}
+
+func (r *MemoryRepository) SetLeaderboardOptOut(ctx context.Context, userID int64, optOut bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u := r.user(userID); u != nil {
+		r.saveUser(u)
+		u.LeaderboardOptOut = optOut
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateTransaction(ctx context.Context, t *model.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.transactions)
+	r.onRollback(func() { r.transactions = r.transactions[:n] })
+	t.ID = int64(len(r.transactions) + 1)
+	stored := *t
+	if t.FromUserID != nil {
+		from := *t.FromUserID
+		stored.FromUserID = &from
+	}
+	stored.CreatedAt = time.Now()
+	r.transactions = append(r.transactions, stored)
+	return nil
+}
+
+func (r *MemoryRepository) CreatePurchase(ctx context.Context, p *model.Purchase) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.purchases)
+	r.onRollback(func() { r.purchases = r.purchases[:n] })
+	p.ID = int64(len(r.purchases) + 1)
+	stored := *p
+	stored.CreatedAt = time.Now()
+	r.purchases = append(r.purchases, stored)
+	return nil
+}
+
+// GetInventoryByUserID возвращает купленные пользователем товары с количеством.
+// Если at не nil, учитываются только покупки, сделанные до момента at.
+func (r *MemoryRepository) GetInventoryByUserID(ctx context.Context, userID int64, at *time.Time) ([]model.InventoryItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, p := range r.purchases {
+		if p.UserID == userID && before(p.CreatedAt, at) {
+			counts[p.Item]++
+		}
+	}
+	var inventory []model.InventoryItem
+	for item, n := range counts {
+		inventory = append(inventory, model.InventoryItem{Type: item, Quantity: n})
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Type < inventory[j].Type })
+	return inventory, nil
+}
+
+// GetCoinHistoryByUserID возвращает переводы пользователя с именами контрагентов.
+// limit > 0 оставляет в каждом списке последние limit переводов; порядок внутри
+// списка — от старых к новым. Если at не nil, учитываются только переводы до at.
+func (r *MemoryRepository) GetCoinHistoryByUserID(ctx context.Context, userID int64, limit int, at *time.Time) (*model.CoinHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := &model.CoinHistory{}
+	for _, t := range r.transactions {
+		if t.Type != model.TransactionTypeTransfer || !before(t.CreatedAt, at) {
+			continue
+		}
+		if t.ToUserID == userID && r.username(t.FromUserID) != "" {
+			history.Received = append(history.Received, model.CoinHistoryReceived{FromUser: r.username(t.FromUserID), Amount: t.Amount})
+		}
+		if t.FromUserID != nil && *t.FromUserID == userID && r.username(&t.ToUserID) != "" {
+			history.Sent = append(history.Sent, model.CoinHistorySent{ToUser: r.username(&t.ToUserID), Amount: t.Amount})
+		}
+	}
+	if limit > 0 && len(history.Received) > limit {
+		history.Received = history.Received[len(history.Received)-limit:]
+	}
+	if limit > 0 && len(history.Sent) > limit {
+		history.Sent = history.Sent[len(history.Sent)-limit:]
+	}
+	return history, nil
+}
+
+// ledgerEntries разворачивает транзакцию в движения по счёту пользователя так же,
+// как ledgerEntriesQuery: перевод самому себе даёт два движения, сначала out,
+// затем in. Вызывается под блокировкой.
+func (r *MemoryRepository) ledgerEntries(userID int64, t model.Transaction) []*model.LedgerEntry {
+	outgoing := t.FromUserID != nil && *t.FromUserID == userID
+	incoming := t.ToUserID == userID
+	if !incoming && !outgoing {
+		return nil
+	}
+
+	var directions []string
+	switch {
+	case t.Type == model.TransactionTypeTransfer:
+		if outgoing {
+			directions = append(directions, model.DirectionOut)
+		}
+		if incoming {
+			directions = append(directions, model.DirectionIn)
+		}
+	case t.Type == model.TransactionTypePurchase,
+		t.Type == model.TransactionTypeExpiry,
+		t.Type == model.TransactionTypeAdjustment && t.Amount < 0:
+		directions = append(directions, model.DirectionOut)
+	default:
+		directions = append(directions, model.DirectionIn)
+	}
+
+	amount := t.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+	entries := make([]*model.LedgerEntry, 0, len(directions))
+	for _, direction := range directions {
+		e := &model.LedgerEntry{
+			ID:        t.ID,
+			Type:      t.Type,
+			Direction: direction,
+			Amount:    amount,
+			Reason:    t.Reason,
+			CreatedAt: t.CreatedAt,
+		}
+		if direction == model.DirectionOut && outgoing {
+			e.Counterparty = r.username(&t.ToUserID)
+		} else {
+			e.Counterparty = r.username(t.FromUserID)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (r *MemoryRepository) GetHistory(ctx context.Context, f model.HistoryFilter) ([]*model.LedgerEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []*model.LedgerEntry
+	for i := len(r.transactions) - 1; i >= 0; i-- {
+		ledger := r.ledgerEntries(f.UserID, r.transactions[i])
+		for j := len(ledger) - 1; j >= 0; j-- {
+			if f.Limit > 0 && len(entries) == f.Limit {
+				return entries, nil
+			}
+			e := ledger[j]
+			if (f.Direction != "" && e.Direction != f.Direction) ||
+				(f.Type != "" && e.Type != f.Type) ||
+				(f.Counterparty != "" && e.Counterparty != f.Counterparty) ||
+				(f.From != nil && e.CreatedAt.Before(*f.From)) ||
+				(f.To != nil && !e.CreatedAt.Before(*f.To)) ||
+				(f.BeforeID > 0 && e.ID >= f.BeforeID) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// GetBalanceAt восстанавливает баланс пользователя по журналу на момент at
+// (движения в момент at не учитываются). Перевод самому себе даёт списание и
+// зачисление, как в ListLedgerSummaries, поэтому итог сходится со сверкой.
+func (r *MemoryRepository) GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	balance := 0
+	for _, t := range r.transactions {
+		for _, e := range r.ledgerEntries(userID, t) {
+			if !e.CreatedAt.Before(at) {
+				continue
+			}
+			if e.Direction == model.DirectionOut {
+				balance -= e.Amount
+			} else {
+				balance += e.Amount
+			}
+		}
+	}
+	return balance, nil
+}
+
+// StreamLedger передаёт в fn движения пользователя за период [from, to) от старых
+// к новым. Движения копируются до вызова fn, чтобы медленный получатель не
+// удерживал блокировку.
+func (r *MemoryRepository) StreamLedger(ctx context.Context, userID int64, from, to time.Time, fn func(*model.LedgerEntry) error) error {
+	r.mu.RLock()
+	var entries []*model.LedgerEntry
+	for _, t := range r.transactions {
+		for _, e := range r.ledgerEntries(userID, t) {
+			if !e.CreatedAt.Before(from) && e.CreatedAt.Before(to) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ListLedgerSummaries(ctx context.Context) ([]*model.LedgerSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	summaries := make([]*model.LedgerSummary, len(r.users))
+	for i, u := range r.users {
+		summaries[i] = &model.LedgerSummary{UserID: u.ID, Username: u.Username, Coins: u.Coins}
+	}
+	for _, t := range r.transactions {
+		if to := r.user(t.ToUserID); to != nil {
+			s := summaries[to.ID-1]
+			switch t.Type {
+			case model.TransactionTypeGrant:
+				s.Granted += t.Amount
+			case model.TransactionTypeTransfer:
+				s.Received += t.Amount
+			case model.TransactionTypeExpiry:
+				s.Expired += t.Amount
+			case model.TransactionTypeAdjustment:
+				s.Adjusted += t.Amount
+			}
+		}
+		if t.FromUserID != nil && t.Type == model.TransactionTypeTransfer {
+			if from := r.user(*t.FromUserID); from != nil {
+				summaries[from.ID-1].Sent += t.Amount
+			}
+		}
+	}
+	for _, p := range r.purchases {
+		if u := r.user(p.UserID); u != nil {
+			summaries[u.ID-1].Spent += p.Price
+		}
+	}
+	if len(summaries) == 0 {
+		return nil, nil
+	}
+	return summaries, nil
+}
+
+func (r *MemoryRepository) CreateAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.audits)
+	r.onRollback(func() { r.audits = r.audits[:n] })
+	e.ID = int64(len(r.audits) + 1)
+	e.CreatedAt = time.Now()
+	r.audits = append(r.audits, *e)
+	return nil
+}
+
+// GetLeaderboard возвращает первые limit участников рейтинга board с момента since
+// (nil — за всё время) среди сотрудников отдела department (пустая строка — все
+// отделы; регистр не учитывается). Пользователи, отказавшиеся от рейтингов, не
+// учитываются.
+func (r *MemoryRepository) GetLeaderboard(ctx context.Context, board string, since *time.Time, department string, limit int) ([]model.LeaderboardEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	totals := make(map[int64]int)
+	add := func(userID int64, amount int, at time.Time) {
+		u := r.user(userID)
+		if u == nil || u.LeaderboardOptOut || (department != "" && !strings.EqualFold(u.Department, department)) {
+			return
+		}
+		if since == nil || !at.Before(*since) {
+			totals[userID] += amount
+		}
+	}
+	switch board {
+	case model.LeaderboardGivers, model.LeaderboardReceivers:
+		for _, t := range r.transactions {
+			if t.Type != model.TransactionTypeTransfer {
+				continue
+			}
+			if board == model.LeaderboardReceivers {
+				add(t.ToUserID, t.Amount, t.CreatedAt)
+			} else if t.FromUserID != nil {
+				add(*t.FromUserID, t.Amount, t.CreatedAt)
+			}
+		}
+	case model.LeaderboardSpenders:
+		for _, p := range r.purchases {
+			add(p.UserID, p.Price, p.CreatedAt)
+		}
+	default:
+		return nil, model.ErrInvalidLeaderboard
+	}
+
+	var entries []model.LeaderboardEntry
+	for userID, total := range totals {
+		entries = append(entries, model.LeaderboardEntry{Username: r.user(userID).Username, Total: total})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Total != entries[j].Total {
+			return entries[i].Total > entries[j].Total
+		}
+		return entries[i].Username < entries[j].Username
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries, nil
+}
+
+func (r *MemoryRepository) GetItemSales(ctx context.Context, q model.AnalyticsQuery) ([]model.ItemSalesPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type key struct {
+		bucket time.Time
+		item   string
+	}
+	sales := make(map[key]*model.ItemSalesPoint)
+	for _, p := range r.purchases {
+		if !inRange(p.CreatedAt, q) {
+			continue
+		}
+		bucket, err := model.TruncateBucket(p.CreatedAt, q.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		k := key{bucket, p.Item}
+		if sales[k] == nil {
+			sales[k] = &model.ItemSalesPoint{Bucket: bucket, Item: p.Item}
+		}
+		sales[k].Purchases++
+		sales[k].Revenue += p.Price
+	}
+
+	var points []model.ItemSalesPoint
+	for _, p := range sales {
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if !points[i].Bucket.Equal(points[j].Bucket) {
+			return points[i].Bucket.Before(points[j].Bucket)
+		}
+		return points[i].Item < points[j].Item
+	})
+	return points, nil
+}
+
+// supplyDelta — изменение числа монет в обращении, вызванное транзакцией
+// (см. supplyDeltaSQL).
+func supplyDelta(t model.Transaction) int {
+	switch t.Type {
+	case model.TransactionTypeGrant, model.TransactionTypeAdjustment:
+		return t.Amount
+	case model.TransactionTypePurchase, model.TransactionTypeExpiry:
+		return -t.Amount
+	default:
+		return 0
+	}
+}
+
+// GetCoinSupplyChanges возвращает число монет в обращении на начало периода и
+// его изменение по интервалам.
+func (r *MemoryRepository) GetCoinSupplyChanges(ctx context.Context, q model.AnalyticsQuery) (int, []model.BucketValue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	opening := 0
+	changes := make(map[time.Time]int)
+	for _, t := range r.transactions {
+		if t.CreatedAt.Before(q.From) {
+			opening += supplyDelta(t)
+			continue
+		}
+		if !t.CreatedAt.Before(q.To) {
+			continue
+		}
+		bucket, err := model.TruncateBucket(t.CreatedAt, q.Bucket)
+		if err != nil {
+			return 0, nil, err
+		}
+		changes[bucket] += supplyDelta(t)
+	}
+	return opening, sortedBucketValues(changes), nil
+}
+
+// GetActiveUsers возвращает число пользователей, совершивших перевод или покупку
+// либо получивших перевод, по интервалам.
+func (r *MemoryRepository) GetActiveUsers(ctx context.Context, q model.AnalyticsQuery) ([]model.BucketValue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	active := make(map[time.Time]map[int64]bool)
+	for _, t := range r.transactions {
+		if (t.Type != model.TransactionTypeTransfer && t.Type != model.TransactionTypePurchase) || !inRange(t.CreatedAt, q) {
+			continue
+		}
+		bucket, err := model.TruncateBucket(t.CreatedAt, q.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if active[bucket] == nil {
+			active[bucket] = make(map[int64]bool)
+		}
+		active[bucket][t.ToUserID] = true
+		if t.Type == model.TransactionTypeTransfer && t.FromUserID != nil {
+			active[bucket][*t.FromUserID] = true
+		}
+	}
+
+	counts := make(map[time.Time]int, len(active))
+	for bucket, users := range active {
+		counts[bucket] = len(users)
+	}
+	return sortedBucketValues(counts), nil
+}
+
+func (r *MemoryRepository) GetTransferVolume(ctx context.Context, q model.AnalyticsQuery) ([]model.TransferPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	volume := make(map[time.Time]*model.TransferPoint)
+	for _, t := range r.transactions {
+		if t.Type != model.TransactionTypeTransfer || !inRange(t.CreatedAt, q) {
+			continue
+		}
+		bucket, err := model.TruncateBucket(t.CreatedAt, q.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if volume[bucket] == nil {
+			volume[bucket] = &model.TransferPoint{Bucket: bucket}
+		}
+		volume[bucket].Transfers++
+		volume[bucket].Volume += t.Amount
+	}
+
+	var points []model.TransferPoint
+	for _, p := range volume {
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Bucket.Before(points[j].Bucket) })
+	return points, nil
+}
+
+func (r *MemoryRepository) CreateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.lots)
+	r.onRollback(func() { r.lots = r.lots[:n] })
+	l.ID = int64(len(r.lots) + 1)
+	r.lots = append(r.lots, *l)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l.ID > 0 && int(l.ID) <= len(r.lots) {
+		prev := r.lots[l.ID-1]
+		r.onRollback(func() { r.lots[prev.ID-1] = prev })
+		r.lots[l.ID-1].Remaining = l.Remaining
+	}
+	return nil
+}
+
+// GetCoinLotsByUserID возвращает непогашенные партии пользователя в порядке расходования.
+func (r *MemoryRepository) GetCoinLotsByUserID(ctx context.Context, userID int64) ([]*model.CoinLot, error) {
+	return r.findCoinLots(func(l model.CoinLot) bool { return l.UserID == userID }), nil
+}
+
+// GetExpiredCoinLots возвращает непогашенные партии, срок которых истёк к моменту now.
+func (r *MemoryRepository) GetExpiredCoinLots(ctx context.Context, now time.Time) ([]*model.CoinLot, error) {
+	return r.findCoinLots(func(l model.CoinLot) bool { return !l.ExpiresAt.After(now) }), nil
+}
+
+func (r *MemoryRepository) findCoinLots(match func(model.CoinLot) bool) []*model.CoinLot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var lots []*model.CoinLot
+	for _, l := range r.lots {
+		if l.Remaining > 0 && match(l) {
+			lot := l
+			lots = append(lots, &lot)
+		}
+	}
+	sort.SliceStable(lots, func(i, j int) bool { return lots[i].ExpiresAt.Before(lots[j].ExpiresAt) })
+	return lots
+}
+
+// before сообщает, что момент t предшествует at; nil означает «без ограничения».
+func before(t time.Time, at *time.Time) bool {
+	return at == nil || t.Before(*at)
+}
+
+func inRange(t time.Time, q model.AnalyticsQuery) bool {
+	return !t.Before(q.From) && t.Before(q.To)
+}
+
+func sortedBucketValues(values map[time.Time]int) []model.BucketValue {
+	var result []model.BucketValue
+	for bucket, v := range values {
+		result = append(result, model.BucketValue{Bucket: bucket, Value: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Bucket.Before(result[j].Bucket) })
+	return result
+}
+
+func (r *MemoryRepository) CreateLoginAttempt(ctx context.Context, a *model.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.loginAttempts)
+	r.onRollback(func() { r.loginAttempts = r.loginAttempts[:n] })
+	a.ID = int64(len(r.loginAttempts) + 1)
+	a.CreatedAt = time.Now()
+	r.loginAttempts = append(r.loginAttempts, *a)
+	return nil
+}
+
+func (r *MemoryRepository) ListLoginAttempts(ctx context.Context, f model.LoginAttemptFilter) ([]*model.LoginAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var attempts []*model.LoginAttempt
+	for i := len(r.loginAttempts) - 1; i >= 0; i-- {
+		a := r.loginAttempts[i]
+		if (f.Username != "" && a.Username != f.Username) ||
+			(f.IP != "" && a.IP != f.IP) ||
+			(f.Since != nil && a.CreatedAt.Before(*f.Since)) ||
+			(f.FailedOnly && !a.Failed()) {
+			continue
+		}
+		attempts = append(attempts, &a)
+		if f.Limit > 0 && len(attempts) == f.Limit {
+			break
+		}
+	}
+	return attempts, nil
+}
+
+func (r *MemoryRepository) GetLoginActivity(ctx context.Context, q model.LoginActivityQuery) ([]model.LoginActivity, error) {
+	if _, ok := loginActivityColumns[q.By]; !ok {
+		return nil, model.ErrInvalidGrouping
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type group struct {
+		activity  model.LoginActivity
+		usernames map[string]bool
+		ips       map[string]bool
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	for _, a := range r.loginAttempts {
+		if a.CreatedAt.Before(q.Since) {
+			continue
+		}
+		key := a.IP
+		if q.By == model.LoginActivityByUsername {
+			key = a.Username
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{usernames: make(map[string]bool), ips: make(map[string]bool)}
+			setLoginActivityKey(&g.activity, q.By, key)
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		if a.Failed() {
+			g.activity.Failures++
+		} else {
+			g.activity.Successes++
+		}
+		g.usernames[a.Username] = true
+		g.ips[a.IP] = true
+		if a.CreatedAt.After(g.activity.LastAttempt) {
+			g.activity.LastAttempt = a.CreatedAt
+		}
+	}
+
+	var activity []model.LoginActivity
+	for _, key := range keys {
+		g := groups[key]
+		if g.activity.Failures < q.MinFailures {
+			continue
+		}
+		g.activity.Usernames = len(g.usernames)
+		g.activity.IPs = len(g.ips)
+		activity = append(activity, g.activity)
+	}
+	sort.Slice(activity, func(i, j int) bool {
+		if activity[i].Failures != activity[j].Failures {
+			return activity[i].Failures > activity[j].Failures
+		}
+		if !activity[i].LastAttempt.Equal(activity[j].LastAttempt) {
+			return activity[i].LastAttempt.After(activity[j].LastAttempt)
+		}
+		return activity[i].IP+activity[i].Username < activity[j].IP+activity[j].Username
+	})
+	if q.Limit > 0 && len(activity) > q.Limit {
+		activity = activity[:q.Limit]
+	}
+	return activity, nil
+}
+
+func (r *MemoryRepository) GetLoginLockout(ctx context.Context, username string) (*model.LoginLockout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	l, ok := r.lockouts[username]
+	if !ok {
+		return &model.LoginLockout{Username: username}, nil
+	}
+	return &l, nil
+}
+
+// RecordLoginFailure атомарно увеличивает счётчик неудачных входов подряд и
+// возвращает новое значение.
+func (r *MemoryRepository) RecordLoginFailure(ctx context.Context, username string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveLockout(username)
+	l := r.lockouts[username]
+	l.Username = username
+	l.Failures++
+	r.lockouts[username] = l
+	return l.Failures, nil
+}
+
+func (r *MemoryRepository) LockLogin(ctx context.Context, username string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.lockouts[username]; ok {
+		r.saveLockout(username)
+		l.LockedUntil = &until
+		r.lockouts[username] = l
+	}
+	return nil
+}
+
+// ResetLoginFailures сбрасывает счётчик неудачных входов и снимает блокировку.
+func (r *MemoryRepository) ResetLoginFailures(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveLockout(username)
+	delete(r.lockouts, username)
+	return nil
+}
+
+// invite возвращает приглашение по коду. Вызывается под блокировкой.
+func (r *MemoryRepository) invite(code string) *model.Invite {
+	for i := range r.invites {
+		if r.invites[i].Code == code {
+			return &r.invites[i]
+		}
+	}
+	return nil
+}
+
+// saveInvite запоминает приглашение перед изменением для отката транзакции.
+func (r *MemoryRepository) saveInvite(inv *model.Invite) {
+	prev := *inv
+	r.onRollback(func() { r.invites[prev.ID-1] = prev })
+}
+
+func (r *MemoryRepository) CreateInvite(ctx context.Context, inv *model.Invite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.invites)
+	r.onRollback(func() { r.invites = r.invites[:n] })
+	inv.ID = int64(len(r.invites) + 1)
+	inv.CreatedAt = time.Now().UTC()
+	r.invites = append(r.invites, *inv)
+	return nil
+}
+
+func (r *MemoryRepository) GetInvite(ctx context.Context, code string) (*model.Invite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inv := r.invite(code)
+	if inv == nil {
+		return nil, model.ErrInviteNotFound
+	}
+	found := *inv
+	return &found, nil
+}
+
+func (r *MemoryRepository) ListInvites(ctx context.Context) ([]*model.Invite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var invites []*model.Invite
+	for i := len(r.invites) - 1; i >= 0; i-- {
+		inv := r.invites[i]
+		invites = append(invites, &inv)
+	}
+	return invites, nil
+}
+
+func (r *MemoryRepository) RedeemInvite(ctx context.Context, code string, now time.Time) (*model.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv := r.invite(code)
+	if inv == nil || !inv.Usable(now) {
+		return nil, model.ErrInvalidInvite
+	}
+	r.saveInvite(inv)
+	inv.Uses++
+	redeemed := *inv
+	return &redeemed, nil
+}
+
+func (r *MemoryRepository) RevokeInvite(ctx context.Context, code string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv := r.invite(code)
+	if inv == nil {
+		return model.ErrInviteNotFound
+	}
+	if inv.RevokedAt == nil {
+		r.saveInvite(inv)
+		at = at.UTC()
+		inv.RevokedAt = &at
+	}
+	return nil
+}
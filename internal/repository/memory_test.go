@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"merch-shop/internal/repository"
+	"merch-shop/internal/repository/repotest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
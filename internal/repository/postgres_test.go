@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"merch-shop/internal/database"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/repository/repotest"
+)
+
+// TestPostgresRepository запускается, только если задана переменная
+// TEST_DATABASE_DSN. Перед запуском к базе применяются миграции, перед каждой
+// проверкой все таблицы очищаются.
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, database.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		_, err := db.Exec("TRUNCATE users, transactions, purchases, audit_log, coin_lots, login_attempts, login_lockouts, invites RESTART IDENTITY CASCADE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repository.NewPostgresRepository(db, repository.DefaultTimeouts)
+	})
+}
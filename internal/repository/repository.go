@@ -1,17 +1,73 @@
 package repository
 
-import "merch-shop/internal/model"
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/model"
+)
 
 type Repository interface {
-	GetUserByUsername(username string) (*model.User, error)
-	CreateUser(user *model.User) error
-	UpdateUser(user *model.User) error
-	GetUserByID(userID int64) (*model.User, error)
+	// WithTx выполняет fn в одной транзакции хранилища: изменения, сделанные
+	// через переданный в fn репозиторий, фиксируются вместе или не фиксируются
+	// вовсе, если fn вернул ошибку. Внутри fn используется только переданный
+	// репозиторий; вложенный WithTx выполняется в уже открытой транзакции.
+	WithTx(ctx context.Context, fn func(repo Repository) error) error
+
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	CreateUser(ctx context.Context, user *model.User) error
+	UpdateUserProfile(ctx context.Context, user *model.User) error
+	GetUserByID(ctx context.Context, userID int64) (*model.User, error)
+	// LockUser читает пользователя и до конца транзакции WithTx не даёт другим
+	// транзакциям менять его баланс. Вне WithTx равносилен GetUserByID.
+	LockUser(ctx context.Context, userID int64) (*model.User, error)
+	ListUsers(ctx context.Context) ([]*model.User, error)
+	// ListUsersPage возвращает страницу пользователей, подходящих под q, и общее
+	// число подходящих.
+	ListUsersPage(ctx context.Context, q model.UserQuery) ([]*model.User, int, error)
+	GetCoinsInCirculation(ctx context.Context) (int, error)
+	AddCoins(ctx context.Context, userID int64, delta int) error
+	// DebitCoins атомарно списывает amount монет. Если их не хватает, баланс
+	// не меняется и возвращается ErrInsufficientCoins.
+	DebitCoins(ctx context.Context, userID int64, amount int) error
+	SetLeaderboardOptOut(ctx context.Context, userID int64, optOut bool) error
+
+	CreateTransaction(ctx context.Context, t *model.Transaction) error
+	CreatePurchase(ctx context.Context, p *model.Purchase) error
+
+	GetInventoryByUserID(ctx context.Context, userID int64, at *time.Time) ([]model.InventoryItem, error)
+	GetCoinHistoryByUserID(ctx context.Context, userID int64, limit int, at *time.Time) (*model.CoinHistory, error)
+	GetHistory(ctx context.Context, f model.HistoryFilter) ([]*model.LedgerEntry, error)
+	GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error)
+	StreamLedger(ctx context.Context, userID int64, from, to time.Time, fn func(*model.LedgerEntry) error) error
+
+	ListLedgerSummaries(ctx context.Context) ([]*model.LedgerSummary, error)
+
+	CreateAuditEntry(ctx context.Context, e *model.AuditEntry) error
+
+	GetLeaderboard(ctx context.Context, board string, since *time.Time, department string, limit int) ([]model.LeaderboardEntry, error)
+
+	GetItemSales(ctx context.Context, q model.AnalyticsQuery) ([]model.ItemSalesPoint, error)
+	GetCoinSupplyChanges(ctx context.Context, q model.AnalyticsQuery) (int, []model.BucketValue, error)
+	GetActiveUsers(ctx context.Context, q model.AnalyticsQuery) ([]model.BucketValue, error)
+	GetTransferVolume(ctx context.Context, q model.AnalyticsQuery) ([]model.TransferPoint, error)
+
+	CreateCoinLot(ctx context.Context, l *model.CoinLot) error
+	UpdateCoinLot(ctx context.Context, l *model.CoinLot) error
+	GetCoinLotsByUserID(ctx context.Context, userID int64) ([]*model.CoinLot, error)
+	GetExpiredCoinLots(ctx context.Context, now time.Time) ([]*model.CoinLot, error)
 
-	CreateTransaction(t *model.Transaction) error
-	CreatePurchase(p *model.Purchase) error
+	CreateLoginAttempt(ctx context.Context, a *model.LoginAttempt) error
+	ListLoginAttempts(ctx context.Context, f model.LoginAttemptFilter) ([]*model.LoginAttempt, error)
+	GetLoginActivity(ctx context.Context, q model.LoginActivityQuery) ([]model.LoginActivity, error)
+	GetLoginLockout(ctx context.Context, username string) (*model.LoginLockout, error)
+	RecordLoginFailure(ctx context.Context, username string) (int, error)
+	LockLogin(ctx context.Context, username string, until time.Time) error
+	ResetLoginFailures(ctx context.Context, username string) error
 
-	GetPurchasesByUserID(userID int64) ([]*model.Purchase, error)
-	GetTransactionsReceivedByUserID(userID int64) ([]*model.Transaction, error)
-	GetTransactionsSentByUserID(userID int64) ([]*model.Transaction, error)
+	CreateInvite(ctx context.Context, inv *model.Invite) error
+	GetInvite(ctx context.Context, code string) (*model.Invite, error)
+	ListInvites(ctx context.Context) ([]*model.Invite, error)
+	RedeemInvite(ctx context.Context, code string, now time.Time) (*model.Invite, error)
+	RevokeInvite(ctx context.Context, code string, at time.Time) error
 }
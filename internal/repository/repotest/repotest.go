@@ -0,0 +1,1071 @@
+// Package repotest содержит набор проверок, которые должна проходить любая
+// реализация repository.Repository. Так гарантируется, что хранилища в памяти
+// и в Postgres ведут себя одинаково.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run запускает набор проверок. newRepo вызывается для каждой проверки и должен
+// возвращать пустое хранилище.
+func Run(t *testing.T, newRepo func(t *testing.T) repository.Repository) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.Repository)
+	}{
+		{"CreateAndGetUser", testCreateAndGetUser},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"UserNotFound", testUserNotFound},
+		{"LockUser", testLockUser},
+		{"DebitCoins", testDebitCoins},
+		{"UpdateUserProfile", testUpdateUserProfile},
+		{"ListUsersOrderedByID", testListUsersOrderedByID},
+		{"ListUsersPage", testListUsersPage},
+		{"CoinsInCirculation", testCoinsInCirculation},
+		{"ConcurrentAddCoins", testConcurrentAddCoins},
+		{"WithTx", testWithTx},
+		{"WithTxRollback", testWithTxRollback},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+		{"ConcurrentPurchases", testConcurrentPurchases},
+		{"LeaderboardOptOut", testLeaderboardOptOut},
+		{"InventoryGroupedByItem", testInventoryGroupedByItem},
+		{"CoinHistory", testCoinHistory},
+		{"HistoryOrderAndFilters", testHistoryOrderAndFilters},
+		{"SelfTransferHistory", testSelfTransferHistory},
+		{"BalanceAt", testBalanceAt},
+		{"BalanceAtMatchesLedgerSummaries", testBalanceAtMatchesLedgerSummaries},
+		{"StreamLedger", testStreamLedger},
+		{"LedgerSummaries", testLedgerSummaries},
+		{"AuditEntry", testAuditEntry},
+		{"CoinLots", testCoinLots},
+		{"Leaderboard", testLeaderboard},
+		{"Analytics", testAnalytics},
+		{"LoginAttempts", testLoginAttempts},
+		{"LoginActivity", testLoginActivity},
+		{"LoginLockout", testLoginLockout},
+		{"Invites", testInvites},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, repo repository.Repository, username string, coins int) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Password: "secret", Coins: coins}
+	require.NoError(t, repo.CreateUser(context.Background(), user))
+	require.NotZero(t, user.ID)
+	return user
+}
+
+func transfer(t *testing.T, repo repository.Repository, from, to *model.User, amount int) *model.Transaction {
+	t.Helper()
+	tx := &model.Transaction{FromUserID: &from.ID, ToUserID: to.ID, Amount: amount, Type: model.TransactionTypeTransfer}
+	require.NoError(t, repo.CreateTransaction(context.Background(), tx))
+	return tx
+}
+
+func purchase(t *testing.T, repo repository.Repository, user *model.User, item string, price int) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePurchase(ctx, &model.Purchase{UserID: user.ID, Item: item, Price: price}))
+	require.NoError(t, repo.CreateTransaction(ctx, &model.Transaction{
+		ToUserID: user.ID, Amount: price, Type: model.TransactionTypePurchase, Reason: item,
+	}))
+}
+
+func grant(t *testing.T, repo repository.Repository, user *model.User, amount int) {
+	t.Helper()
+	require.NoError(t, repo.CreateTransaction(context.Background(), &model.Transaction{
+		ToUserID: user.ID, Amount: amount, Type: model.TransactionTypeGrant, Reason: "bonus",
+	}))
+}
+
+func testCreateAndGetUser(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	created := createUser(t, repo, "alice", 1000)
+	assert.Equal(t, model.RoleUser, created.Role)
+
+	byName, err := repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, byName.ID)
+	assert.Equal(t, "secret", byName.Password)
+	assert.Equal(t, 1000, byName.Coins)
+	assert.Equal(t, model.RoleUser, byName.Role)
+	assert.False(t, byName.LeaderboardOptOut)
+	assert.True(t, byName.Active)
+
+	byID, err := repo.GetUserByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, byName, byID)
+
+	admin := &model.User{Username: "root", Password: "secret", Role: model.RoleAdmin}
+	require.NoError(t, repo.CreateUser(ctx, admin))
+	got, err := repo.GetUserByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, got.Role)
+}
+
+func testDuplicateUsername(t *testing.T, repo repository.Repository) {
+	createUser(t, repo, "alice", 1000)
+	err := repo.CreateUser(context.Background(), &model.User{Username: "alice", Password: "other"})
+	assert.ErrorIs(t, err, model.ErrUsernameTaken)
+
+	users, err := repo.ListUsers(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func testUserNotFound(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	_, err := repo.GetUserByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+	_, err = repo.GetUserByID(ctx, 42)
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+	assert.ErrorIs(t, repo.AddCoins(ctx, 42, 10), model.ErrUserNotFound)
+}
+
+func testLockUser(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := createUser(t, repo, "alice", 1000)
+
+	err := repo.WithTx(ctx, func(tx repository.Repository) error {
+		locked, err := tx.LockUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", locked.Username)
+		assert.Equal(t, 1000, locked.Coins)
+
+		_, err = tx.LockUser(ctx, 42)
+		assert.ErrorIs(t, err, model.ErrUserNotFound)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testDebitCoins(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := createUser(t, repo, "alice", 1000)
+
+	require.NoError(t, repo.DebitCoins(ctx, user.ID, 700))
+	assert.ErrorIs(t, repo.DebitCoins(ctx, user.ID, 301), model.ErrInsufficientCoins)
+	require.NoError(t, repo.DebitCoins(ctx, user.ID, 300))
+	assert.ErrorIs(t, repo.DebitCoins(ctx, 42, 1), model.ErrUserNotFound)
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, got.Coins)
+}
+
+func testUpdateUserProfile(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := &model.User{
+		Username:    "alice",
+		Password:    "secret",
+		Coins:       1000,
+		DisplayName: "Alice Liddell",
+		Email:       "alice@example.com",
+		Department:  "Design",
+		ExternalID:  "hr-1",
+	}
+	require.NoError(t, repo.CreateUser(ctx, user))
+	assert.True(t, user.Active)
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice Liddell", got.DisplayName)
+	assert.Equal(t, "alice@example.com", got.Email)
+	assert.Equal(t, "Design", got.Department)
+	assert.Equal(t, "hr-1", got.ExternalID)
+	assert.True(t, got.Active)
+
+	// Баланс из устаревшего объекта не перезаписывает текущий.
+	require.NoError(t, repo.AddCoins(ctx, user.ID, -300))
+	user.Email = "alice@wonderland.example"
+	user.Department = "Research"
+	user.Active = false
+	require.NoError(t, repo.UpdateUserProfile(ctx, user))
+
+	got, err = repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@wonderland.example", got.Email)
+	assert.Equal(t, "Research", got.Department)
+	assert.False(t, got.Active)
+	assert.Equal(t, 700, got.Coins)
+
+	assert.ErrorIs(t, repo.UpdateUserProfile(ctx, &model.User{ID: 42}), model.ErrUserNotFound)
+}
+
+func testListUsersOrderedByID(t *testing.T, repo repository.Repository) {
+	for _, name := range []string{"carol", "alice", "bob"} {
+		createUser(t, repo, name, 100)
+	}
+	users, err := repo.ListUsers(context.Background())
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, "carol", users[0].Username)
+	assert.Equal(t, "alice", users[1].Username)
+	assert.Equal(t, "bob", users[2].Username)
+	assert.Less(t, users[0].ID, users[1].ID)
+	assert.Less(t, users[1].ID, users[2].ID)
+}
+
+func testListUsersPage(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	for i, name := range []string{"alice", "bob", "carol", "dave"} {
+		user := createUser(t, repo, name, 100)
+		user.ExternalID = "hr-" + name
+		user.Email = name + "@Example.com"
+		user.Department = []string{"Design", "design", "Sales", "Design"}[i]
+		user.Active = name != "dave"
+		require.NoError(t, repo.UpdateUserProfile(ctx, user))
+	}
+	usernames := func(users []*model.User) []string {
+		names := make([]string, 0, len(users))
+		for _, u := range users {
+			names = append(names, u.Username)
+		}
+		return names
+	}
+	active := true
+
+	for _, tt := range []struct {
+		q     model.UserQuery
+		names []string
+		total int
+	}{
+		{model.UserQuery{Limit: 10}, []string{"alice", "bob", "carol", "dave"}, 4},
+		{model.UserQuery{Offset: 1, Limit: 2}, []string{"bob", "carol"}, 4},
+		{model.UserQuery{Offset: 4, Limit: 2}, []string{}, 4},
+		{model.UserQuery{}, []string{}, 4},
+		{model.UserQuery{Username: "BOB", Limit: 10}, []string{"bob"}, 1},
+		{model.UserQuery{Email: "carol@example.com", Limit: 10}, []string{"carol"}, 1},
+		{model.UserQuery{ExternalID: "hr-alice", Limit: 10}, []string{"alice"}, 1},
+		{model.UserQuery{ExternalID: "HR-ALICE", Limit: 10}, []string{}, 0},
+		{model.UserQuery{Department: "DESIGN", Limit: 10}, []string{"alice", "bob", "dave"}, 3},
+		{model.UserQuery{Department: "design", Active: &active, Offset: 1, Limit: 10}, []string{"bob"}, 2},
+	} {
+		users, total, err := repo.ListUsersPage(ctx, tt.q)
+		require.NoError(t, err)
+		assert.Equal(t, tt.names, usernames(users), "%+v", tt.q)
+		assert.Equal(t, tt.total, total, "%+v", tt.q)
+	}
+}
+
+func testCoinsInCirculation(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	total, err := repo.GetCoinsInCirculation(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	alice := createUser(t, repo, "alice", 1000)
+	createUser(t, repo, "bob", 250)
+	require.NoError(t, repo.AddCoins(ctx, alice.ID, -100))
+
+	total, err = repo.GetCoinsInCirculation(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1150, total)
+
+	// Балансы отключённых учётных записей, например счёта магазина, в обращение
+	// не входят.
+	shop := createUser(t, repo, "shop", 300)
+	shop.Active = false
+	require.NoError(t, repo.UpdateUserProfile(ctx, shop))
+	total, err = repo.GetCoinsInCirculation(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1150, total)
+}
+
+func testConcurrentAddCoins(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := createUser(t, repo, "alice", 1000)
+
+	const workers = 20
+	const perWorker = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for i := 0; i < workers; i++ {
+		delta := 1
+		if i%2 == 1 {
+			delta = -3
+		}
+		wg.Add(1)
+		go func(delta int) {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				errs <- repo.AddCoins(ctx, user.ID, delta)
+			}
+		}(delta)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000+workers/2*perWorker*(1-3), got.Coins, "no update may be lost")
+}
+
+func testWithTx(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 1000)
+	bob := createUser(t, repo, "bob", 0)
+
+	// Ошибка внутри транзакции откатывает все изменения.
+	errAbort := errors.New("abort")
+	err := repo.WithTx(ctx, func(tx repository.Repository) error {
+		require.NoError(t, tx.DebitCoins(ctx, alice.ID, 300))
+		require.NoError(t, tx.AddCoins(ctx, bob.ID, 300))
+		transfer(t, tx, alice, bob, 300)
+		require.NoError(t, tx.CreateCoinLot(ctx, &model.CoinLot{UserID: bob.ID, Amount: 300, Remaining: 300}))
+		require.NoError(t, tx.CreateUser(ctx, &model.User{Username: "carol", Password: "secret"}))
+
+		got, err := tx.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 700, got.Coins, "changes are visible inside the transaction")
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	got, err := repo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, got.Coins)
+	got, err = repo.GetUserByID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Zero(t, got.Coins)
+	history, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID})
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	lots, err := repo.GetCoinLotsByUserID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, lots)
+	_, err = repo.GetUserByUsername(ctx, "carol")
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+
+	// Без ошибки изменения фиксируются, вложенный WithTx идёт в той же транзакции.
+	err = repo.WithTx(ctx, func(tx repository.Repository) error {
+		if err := tx.DebitCoins(ctx, alice.ID, 300); err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(tx repository.Repository) error {
+			return tx.AddCoins(ctx, bob.ID, 300)
+		})
+	})
+	require.NoError(t, err)
+	got, err = repo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 700, got.Coins)
+	got, err = repo.GetUserByID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 300, got.Coins)
+}
+
+// testConcurrentTransfers проводит встречные переводы одновременно через
+// сервис: ни одно списание или зачисление не теряется, журнал сходится с
+// балансами.
+// testWithTxRollback проверяет, что откат транзакции возвращает прежние
+// значения уже существовавших записей, а не только удаляет созданные.
+func testWithTxRollback(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 100)
+	lot := &model.CoinLot{UserID: alice.ID, Amount: 100, Remaining: 100, GrantedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateCoinLot(ctx, lot))
+	invite := &model.Invite{Code: "code", Role: model.RoleUser, MaxUses: 2, ExpiresAt: time.Now().Add(time.Hour), CreatedBy: "root"}
+	require.NoError(t, repo.CreateInvite(ctx, invite))
+	_, err := repo.RecordLoginFailure(ctx, "alice")
+	require.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = repo.WithTx(ctx, func(tx repository.Repository) error {
+		updated := *alice
+		updated.Department = "Design"
+		updated.Active = false
+		require.NoError(t, tx.UpdateUserProfile(ctx, &updated))
+		require.NoError(t, tx.SetLeaderboardOptOut(ctx, alice.ID, true))
+		require.NoError(t, tx.AddCoins(ctx, alice.ID, 50))
+		require.NoError(t, tx.UpdateCoinLot(ctx, &model.CoinLot{ID: lot.ID, Remaining: 0}))
+		_, err := tx.RedeemInvite(ctx, "code", time.Now())
+		require.NoError(t, err)
+		require.NoError(t, tx.RevokeInvite(ctx, "code", time.Now()))
+		_, err = tx.RecordLoginFailure(ctx, "alice")
+		require.NoError(t, err)
+		require.NoError(t, tx.LockLogin(ctx, "alice", time.Now().Add(time.Hour)))
+		_, err = tx.RecordLoginFailure(ctx, "bob")
+		require.NoError(t, err)
+		require.NoError(t, tx.CreateLoginAttempt(ctx, &model.LoginAttempt{Username: "alice", IP: "10.0.0.1", Result: model.LoginSuccess}))
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	got, err := repo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, got.Coins)
+	assert.Empty(t, got.Department)
+	assert.True(t, got.Active)
+	assert.False(t, got.LeaderboardOptOut)
+	lots, err := repo.GetCoinLotsByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, 100, lots[0].Remaining)
+	inv, err := repo.GetInvite(ctx, "code")
+	require.NoError(t, err)
+	assert.Zero(t, inv.Uses)
+	assert.Nil(t, inv.RevokedAt)
+	lockout, err := repo.GetLoginLockout(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, lockout.Failures)
+	assert.Nil(t, lockout.LockedUntil)
+	lockout, err = repo.GetLoginLockout(ctx, "bob")
+	require.NoError(t, err)
+	assert.Zero(t, lockout.Failures)
+	attempts, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Username: "alice"})
+	require.NoError(t, err)
+	assert.Empty(t, attempts)
+}
+
+func testConcurrentTransfers(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	createUser(t, repo, "alice", 1000)
+	createUser(t, repo, "bob", 1000)
+
+	const rounds = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*rounds)
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- service.TransferCoins(ctx, repo, "alice", "bob", 10)
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- service.TransferCoins(ctx, repo, "bob", "alice", 15)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	alice, err := repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := repo.GetUserByUsername(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, 1000+rounds*5, alice.Coins)
+	assert.Equal(t, 1000-rounds*5, bob.Coins)
+
+	history, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID})
+	require.NoError(t, err)
+	assert.Len(t, history, 2*rounds)
+	for _, user := range []*model.User{alice, bob} {
+		lots, err := repo.GetCoinLotsByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		remaining := 0
+		for _, lot := range lots {
+			remaining += lot.Remaining
+		}
+		assert.LessOrEqual(t, remaining, user.Coins, "lots never cover more than the balance")
+	}
+}
+
+// testConcurrentPurchases тратит баланс одновременными покупками: проходят
+// ровно те, на которые хватает монет, баланс не уходит в минус.
+func testConcurrentPurchases(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := createUser(t, repo, "alice", 500)
+
+	const workers = 12
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- service.PurchaseItem(ctx, repo, "alice", "t-shirt")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, model.ErrInsufficientCoins)
+	}
+	assert.Equal(t, 500/80, succeeded)
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 500-succeeded*80, got.Coins)
+	inventory, err := repo.GetInventoryByUserID(ctx, user.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []model.InventoryItem{{Type: "t-shirt", Quantity: succeeded}}, inventory)
+}
+
+func testLeaderboardOptOut(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := createUser(t, repo, "alice", 1000)
+	require.NoError(t, repo.SetLeaderboardOptOut(ctx, user.ID, true))
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, got.LeaderboardOptOut)
+}
+
+func testInventoryGroupedByItem(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 1000)
+	bob := createUser(t, repo, "bob", 1000)
+	purchase(t, repo, alice, "pen", 10)
+	purchase(t, repo, alice, "cup", 20)
+	purchase(t, repo, alice, "pen", 10)
+	purchase(t, repo, bob, "hoody", 300)
+
+	inventory, err := repo.GetInventoryByUserID(ctx, alice.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []model.InventoryItem{{Type: "cup", Quantity: 1}, {Type: "pen", Quantity: 2}}, inventory)
+
+	past := time.Now().Add(-24 * time.Hour)
+	inventory, err = repo.GetInventoryByUserID(ctx, alice.ID, &past)
+	require.NoError(t, err)
+	assert.Empty(t, inventory)
+
+	carol := createUser(t, repo, "carol", 1000)
+	inventory, err = repo.GetInventoryByUserID(ctx, carol.ID, nil)
+	require.NoError(t, err)
+	assert.Empty(t, inventory)
+}
+
+func testCoinHistory(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 1000)
+	bob := createUser(t, repo, "bob", 1000)
+	carol := createUser(t, repo, "carol", 1000)
+	transfer(t, repo, bob, alice, 10)
+	transfer(t, repo, carol, alice, 20)
+	transfer(t, repo, alice, bob, 30)
+	transfer(t, repo, bob, alice, 40)
+	grant(t, repo, alice, 100)
+	purchase(t, repo, alice, "pen", 10)
+
+	history, err := repo.GetCoinHistoryByUserID(ctx, alice.ID, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []model.CoinHistoryReceived{
+		{FromUser: "bob", Amount: 10}, {FromUser: "carol", Amount: 20}, {FromUser: "bob", Amount: 40},
+	}, history.Received)
+	assert.Equal(t, []model.CoinHistorySent{{ToUser: "bob", Amount: 30}}, history.Sent)
+
+	history, err = repo.GetCoinHistoryByUserID(ctx, alice.ID, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []model.CoinHistoryReceived{{FromUser: "carol", Amount: 20}, {FromUser: "bob", Amount: 40}}, history.Received)
+
+	past := time.Now().Add(-24 * time.Hour)
+	history, err = repo.GetCoinHistoryByUserID(ctx, alice.ID, 0, &past)
+	require.NoError(t, err)
+	assert.Empty(t, history.Received)
+	assert.Empty(t, history.Sent)
+}
+
+func testHistoryOrderAndFilters(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 1000)
+	bob := createUser(t, repo, "bob", 1000)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	transfer(t, repo, bob, alice, 40)
+	purchase(t, repo, alice, "pen", 10)
+	require.NoError(t, repo.CreateTransaction(ctx, &model.Transaction{
+		ToUserID: alice.ID, Amount: -5, Type: model.TransactionTypeAdjustment, Reason: "reconcile",
+	}))
+
+	entries, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	for i := 1; i < len(entries); i++ {
+		assert.Greater(t, entries[i-1].ID, entries[i].ID, "entries must be newest first")
+	}
+	assert.Equal(t, model.TransactionTypeAdjustment, entries[0].Type)
+	assert.Equal(t, model.DirectionOut, entries[0].Direction)
+	assert.Equal(t, 5, entries[0].Amount)
+	assert.Equal(t, "pen", entries[1].Reason)
+	assert.Equal(t, model.DirectionOut, entries[1].Direction)
+	assert.Equal(t, "", entries[1].Counterparty)
+	assert.Equal(t, "bob", entries[2].Counterparty)
+	assert.Equal(t, model.DirectionIn, entries[2].Direction)
+	assert.Equal(t, model.DirectionOut, entries[3].Direction)
+	assert.Equal(t, model.TransactionTypeGrant, entries[4].Type)
+	assert.Equal(t, model.DirectionIn, entries[4].Direction)
+
+	page, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, Limit: 2, BeforeID: entries[1].ID})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, entries[2].ID, page[0].ID)
+	assert.Equal(t, entries[3].ID, page[1].ID)
+
+	out, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, Direction: model.DirectionOut, Type: model.TransactionTypeTransfer})
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	assert.Equal(t, 30, out[0].Amount)
+
+	withBob, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, Counterparty: "bob"})
+	require.NoError(t, err)
+	assert.Len(t, withBob, 2)
+
+	future := time.Now().Add(24 * time.Hour)
+	none, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, From: &future})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	all, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, To: &future})
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	bobEntries, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: bob.ID})
+	require.NoError(t, err)
+	assert.Len(t, bobEntries, 2)
+}
+
+// testSelfTransferHistory проверяет, что перевод самому себе, оставшийся в
+// журнале от версий без проверки получателя, даёт движения out и in.
+func testSelfTransferHistory(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 100)
+	grant(t, repo, alice, 100)
+	self := transfer(t, repo, alice, alice, 30)
+
+	entries, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for i, direction := range []string{model.DirectionIn, model.DirectionOut} {
+		assert.Equal(t, self.ID, entries[i].ID)
+		assert.Equal(t, direction, entries[i].Direction)
+		assert.Equal(t, 30, entries[i].Amount)
+		assert.Equal(t, "alice", entries[i].Counterparty)
+	}
+
+	out, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, Direction: model.DirectionOut})
+	require.NoError(t, err)
+	assert.Len(t, out, 1)
+	page, err := repo.GetHistory(ctx, model.HistoryFilter{UserID: alice.ID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, model.DirectionIn, page[0].Direction)
+}
+
+func testBalanceAt(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	purchase(t, repo, alice, "pen", 10)
+
+	future := time.Now().Add(24 * time.Hour)
+	balance, err := repo.GetBalanceAt(ctx, alice.ID, future)
+	require.NoError(t, err)
+	assert.Equal(t, 60, balance)
+
+	balance, err = repo.GetBalanceAt(ctx, alice.ID, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, balance)
+}
+
+// testBalanceAtMatchesLedgerSummaries проверяет, что баланс по журналу и сверка
+// одинаково считают все виды движений, включая перевод самому себе.
+func testBalanceAtMatchesLedgerSummaries(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	transfer(t, repo, alice, alice, 20)
+	transfer(t, repo, bob, bob, 5)
+	purchase(t, repo, alice, "pen", 10)
+	for _, tx := range []*model.Transaction{
+		{ToUserID: alice.ID, Amount: 7, Type: model.TransactionTypeExpiry},
+		{ToUserID: bob.ID, Amount: -4, Type: model.TransactionTypeAdjustment},
+		{ToUserID: alice.ID, Amount: 3, Type: model.TransactionTypeAdjustment},
+	} {
+		require.NoError(t, repo.CreateTransaction(ctx, tx))
+	}
+
+	summaries, err := repo.ListLedgerSummaries(ctx)
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	future := time.Now().Add(24 * time.Hour)
+	for _, s := range summaries {
+		balance, err := repo.GetBalanceAt(ctx, s.UserID, future)
+		require.NoError(t, err)
+		assert.Equal(t, s.Granted+s.Received-s.Sent-s.Spent-s.Expired+s.Adjusted, balance, s.Username)
+	}
+}
+
+func testStreamLedger(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	purchase(t, repo, alice, "pen", 10)
+	self := transfer(t, repo, alice, alice, 20)
+
+	from, to := time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour)
+	var entries []*model.LedgerEntry
+	err := repo.StreamLedger(ctx, alice.ID, from, to, func(e *model.LedgerEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	assert.Less(t, entries[0].ID, entries[1].ID)
+	assert.Less(t, entries[1].ID, entries[2].ID)
+	// Перевод самому себе идёт парой: сначала списание, затем зачисление.
+	assert.Equal(t, self.ID, entries[3].ID)
+	assert.Equal(t, model.DirectionOut, entries[3].Direction)
+	assert.Equal(t, self.ID, entries[4].ID)
+	assert.Equal(t, model.DirectionIn, entries[4].Direction)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.StreamLedger(ctx, alice.ID, from, to, func(e *model.LedgerEntry) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func testLedgerSummaries(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	purchase(t, repo, alice, "pen", 10)
+	require.NoError(t, repo.CreateTransaction(ctx, &model.Transaction{ToUserID: bob.ID, Amount: 5, Type: model.TransactionTypeExpiry}))
+	require.NoError(t, repo.CreateTransaction(ctx, &model.Transaction{ToUserID: bob.ID, Amount: -2, Type: model.TransactionTypeAdjustment}))
+
+	summaries, err := repo.ListLedgerSummaries(ctx)
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, model.LedgerSummary{UserID: alice.ID, Username: "alice", Granted: 100, Sent: 30, Spent: 10}, *summaries[0])
+	assert.Equal(t, model.LedgerSummary{UserID: bob.ID, Username: "bob", Received: 30, Expired: 5, Adjusted: -2}, *summaries[1])
+}
+
+func testAuditEntry(t *testing.T, repo repository.Repository) {
+	e := &model.AuditEntry{Actor: "admin", Action: "grant", Details: `{"amount":10}`}
+	require.NoError(t, repo.CreateAuditEntry(context.Background(), e))
+	assert.NotZero(t, e.ID)
+	assert.False(t, e.CreatedAt.IsZero())
+}
+
+func testCoinLots(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := &model.CoinLot{UserID: alice.ID, Amount: 50, Remaining: 50, GrantedAt: base.AddDate(0, 1, 0), ExpiresAt: base.AddDate(1, 1, 0)}
+	early := &model.CoinLot{UserID: alice.ID, Amount: 30, Remaining: 30, GrantedAt: base, ExpiresAt: base.AddDate(1, 0, 0)}
+	spent := &model.CoinLot{UserID: alice.ID, Amount: 10, Remaining: 10, GrantedAt: base, ExpiresAt: base.AddDate(1, 0, 0)}
+	other := &model.CoinLot{UserID: bob.ID, Amount: 20, Remaining: 20, GrantedAt: base, ExpiresAt: base.AddDate(1, 0, 0)}
+	for _, l := range []*model.CoinLot{late, early, spent, other} {
+		require.NoError(t, repo.CreateCoinLot(ctx, l))
+		require.NotZero(t, l.ID)
+	}
+	spent.Remaining = 0
+	require.NoError(t, repo.UpdateCoinLot(ctx, spent))
+
+	lots, err := repo.GetCoinLotsByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, lots, 2)
+	assert.Equal(t, early.ID, lots[0].ID)
+	assert.Equal(t, late.ID, lots[1].ID)
+	assert.Equal(t, 30, lots[0].Remaining)
+	assert.True(t, lots[0].ExpiresAt.Equal(early.ExpiresAt))
+
+	expired, err := repo.GetExpiredCoinLots(ctx, base.AddDate(1, 0, 0))
+	require.NoError(t, err)
+	require.Len(t, expired, 2)
+	assert.Equal(t, early.ID, expired[0].ID)
+	assert.Equal(t, other.ID, expired[1].ID)
+}
+
+func testLeaderboard(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	carol := createUser(t, repo, "carol", 0)
+	transfer(t, repo, alice, bob, 30)
+	transfer(t, repo, carol, bob, 30)
+	transfer(t, repo, alice, carol, 10)
+	purchase(t, repo, carol, "hoody", 300)
+
+	givers, err := repo.GetLeaderboard(ctx, model.LeaderboardGivers, nil, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []model.LeaderboardEntry{
+		{Rank: 1, Username: "alice", Total: 40},
+		{Rank: 2, Username: "carol", Total: 30},
+	}, givers)
+
+	receivers, err := repo.GetLeaderboard(ctx, model.LeaderboardReceivers, nil, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []model.LeaderboardEntry{{Rank: 1, Username: "bob", Total: 60}}, receivers)
+
+	for _, u := range []*model.User{alice, bob} {
+		u.Department = "Design"
+		require.NoError(t, repo.UpdateUserProfile(ctx, u))
+	}
+	givers, err = repo.GetLeaderboard(ctx, model.LeaderboardGivers, nil, "design", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []model.LeaderboardEntry{{Rank: 1, Username: "alice", Total: 40}}, givers)
+	spenders, err := repo.GetLeaderboard(ctx, model.LeaderboardSpenders, nil, "Design", 10)
+	require.NoError(t, err)
+	assert.Empty(t, spenders)
+
+	require.NoError(t, repo.SetLeaderboardOptOut(ctx, carol.ID, true))
+	spenders, err = repo.GetLeaderboard(ctx, model.LeaderboardSpenders, nil, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, spenders)
+
+	future := time.Now().Add(24 * time.Hour)
+	givers, err = repo.GetLeaderboard(ctx, model.LeaderboardGivers, &future, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, givers)
+
+	_, err = repo.GetLeaderboard(ctx, "unknown", nil, "", 10)
+	assert.ErrorIs(t, err, model.ErrInvalidLeaderboard)
+}
+
+func testAnalytics(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := createUser(t, repo, "alice", 0)
+	bob := createUser(t, repo, "bob", 0)
+	grant(t, repo, alice, 100)
+	transfer(t, repo, alice, bob, 30)
+	transfer(t, repo, bob, alice, 5)
+	purchase(t, repo, alice, "pen", 10)
+	purchase(t, repo, alice, "pen", 10)
+
+	q := model.AnalyticsQuery{Bucket: model.BucketMonth, From: time.Now().Add(-24 * time.Hour), To: time.Now().Add(24 * time.Hour)}
+	sales, err := repo.GetItemSales(ctx, q)
+	require.NoError(t, err)
+	var purchases, revenue int
+	for _, p := range sales {
+		assert.Equal(t, "pen", p.Item)
+		purchases += p.Purchases
+		revenue += p.Revenue
+	}
+	assert.Equal(t, 2, purchases)
+	assert.Equal(t, 20, revenue)
+
+	opening, changes, err := repo.GetCoinSupplyChanges(ctx, q)
+	require.NoError(t, err)
+	assert.Equal(t, 0, opening)
+	total := 0
+	for _, c := range changes {
+		total += c.Value
+	}
+	assert.Equal(t, 80, total)
+
+	volume, err := repo.GetTransferVolume(ctx, q)
+	require.NoError(t, err)
+	var transfers, coins int
+	for _, p := range volume {
+		transfers += p.Transfers
+		coins += p.Volume
+	}
+	assert.Equal(t, 2, transfers)
+	assert.Equal(t, 35, coins)
+
+	active, err := repo.GetActiveUsers(ctx, q)
+	require.NoError(t, err)
+	require.NotEmpty(t, active)
+	for _, v := range active {
+		assert.LessOrEqual(t, v.Value, 2)
+	}
+
+	later := model.AnalyticsQuery{Bucket: model.BucketDay, From: q.To, To: q.To.Add(24 * time.Hour)}
+	opening, changes, err = repo.GetCoinSupplyChanges(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, 80, opening)
+	assert.Empty(t, changes)
+}
+
+func loginAttempt(t *testing.T, repo repository.Repository, username, ip, result string) {
+	t.Helper()
+	a := &model.LoginAttempt{Username: username, IP: ip, Result: result}
+	require.NoError(t, repo.CreateLoginAttempt(context.Background(), a))
+	require.NotZero(t, a.ID)
+}
+
+func testLoginAttempts(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+	loginAttempt(t, repo, "alice", "10.0.0.1", model.LoginSuccess)
+	loginAttempt(t, repo, "alice", "10.0.0.2", model.LoginInvalidCredentials)
+	loginAttempt(t, repo, "bob", "10.0.0.2", model.LoginLocked)
+
+	all, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, "bob", all[0].Username)
+	assert.Equal(t, model.LoginLocked, all[0].Result)
+	assert.True(t, all[0].CreatedAt.After(start))
+
+	byUser, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Username: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, byUser, 2)
+
+	failedFromIP, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{IP: "10.0.0.2", FailedOnly: true, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, failedFromIP, 1)
+	assert.Equal(t, "bob", failedFromIP[0].Username)
+
+	future := time.Now().Add(time.Hour)
+	none, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Since: &future})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testLoginActivity(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	since := time.Now().Add(-time.Hour)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		loginAttempt(t, repo, name, "10.0.0.9", model.LoginInvalidCredentials)
+	}
+	loginAttempt(t, repo, "alice", "10.0.0.1", model.LoginInvalidCredentials)
+	loginAttempt(t, repo, "alice", "10.0.0.1", model.LoginSuccess)
+
+	byIP, err := repo.GetLoginActivity(ctx, model.LoginActivityQuery{By: model.LoginActivityByIP, Since: since, MinFailures: 1})
+	require.NoError(t, err)
+	require.Len(t, byIP, 2)
+	assert.Equal(t, "10.0.0.9", byIP[0].IP)
+	assert.Empty(t, byIP[0].Username)
+	assert.Equal(t, 3, byIP[0].Failures)
+	assert.Equal(t, 0, byIP[0].Successes)
+	assert.Equal(t, 3, byIP[0].Usernames)
+	assert.Equal(t, 1, byIP[0].IPs)
+	assert.False(t, byIP[0].LastAttempt.IsZero())
+	assert.Equal(t, 1, byIP[1].Failures)
+	assert.Equal(t, 1, byIP[1].Successes)
+
+	byUser, err := repo.GetLoginActivity(ctx, model.LoginActivityQuery{By: model.LoginActivityByUsername, Since: since, MinFailures: 2, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, byUser, 1)
+	assert.Equal(t, "alice", byUser[0].Username)
+	assert.Equal(t, 2, byUser[0].Failures)
+	assert.Equal(t, 2, byUser[0].IPs)
+
+	_, err = repo.GetLoginActivity(ctx, model.LoginActivityQuery{By: "country", Since: since})
+	assert.ErrorIs(t, err, model.ErrInvalidGrouping)
+}
+
+func testLoginLockout(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+
+	l, err := repo.GetLoginLockout(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", l.Username)
+	assert.Zero(t, l.Failures)
+	assert.Nil(t, l.LockedUntil)
+
+	for want := 1; want <= 3; want++ {
+		failures, err := repo.RecordLoginFailure(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	until := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	require.NoError(t, repo.LockLogin(ctx, "alice", until))
+
+	l, err = repo.GetLoginLockout(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 3, l.Failures)
+	require.NotNil(t, l.LockedUntil)
+	assert.True(t, until.Equal(*l.LockedUntil), "locked until %v, want %v", *l.LockedUntil, until)
+	assert.True(t, l.Locked(time.Now()))
+
+	require.NoError(t, repo.ResetLoginFailures(ctx, "alice"))
+	l, err = repo.GetLoginLockout(ctx, "alice")
+	require.NoError(t, err)
+	assert.Zero(t, l.Failures)
+	assert.False(t, l.Locked(time.Now()))
+}
+
+func testInvites(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	now := time.Now()
+	expires := now.Add(time.Hour).Truncate(time.Second)
+
+	single := &model.Invite{Code: "single", Role: model.RoleUser, MaxUses: 1, ExpiresAt: expires, CreatedBy: "root"}
+	require.NoError(t, repo.CreateInvite(ctx, single))
+	require.NotZero(t, single.ID)
+	multi := &model.Invite{Code: "multi", Role: model.RoleAdmin, MaxUses: 2, ExpiresAt: expires, CreatedBy: "root"}
+	require.NoError(t, repo.CreateInvite(ctx, multi))
+	expired := &model.Invite{Code: "expired", Role: model.RoleUser, MaxUses: 5, ExpiresAt: now.Add(-time.Minute), CreatedBy: "root"}
+	require.NoError(t, repo.CreateInvite(ctx, expired))
+
+	got, err := repo.GetInvite(ctx, "multi")
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, got.Role)
+	assert.Equal(t, 2, got.MaxUses)
+	assert.Zero(t, got.Uses)
+	assert.True(t, expires.Equal(got.ExpiresAt), "expires at %v, want %v", got.ExpiresAt, expires)
+	assert.Equal(t, "root", got.CreatedBy)
+	assert.Nil(t, got.RevokedAt)
+	_, err = repo.GetInvite(ctx, "missing")
+	assert.ErrorIs(t, err, model.ErrInviteNotFound)
+
+	invites, err := repo.ListInvites(ctx)
+	require.NoError(t, err)
+	if assert.Len(t, invites, 3) {
+		assert.Equal(t, "expired", invites[0].Code)
+		assert.Equal(t, "single", invites[2].Code)
+	}
+
+	redeemed, err := repo.RedeemInvite(ctx, "single", now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, redeemed.Uses)
+	_, err = repo.RedeemInvite(ctx, "single", now)
+	assert.ErrorIs(t, err, model.ErrInvalidInvite)
+
+	for want := 1; want <= 2; want++ {
+		redeemed, err := repo.RedeemInvite(ctx, "multi", now)
+		require.NoError(t, err)
+		assert.Equal(t, want, redeemed.Uses)
+		assert.Equal(t, model.RoleAdmin, redeemed.Role)
+	}
+	_, err = repo.RedeemInvite(ctx, "multi", now)
+	assert.ErrorIs(t, err, model.ErrInvalidInvite)
+
+	_, err = repo.RedeemInvite(ctx, "expired", now)
+	assert.ErrorIs(t, err, model.ErrInvalidInvite)
+	_, err = repo.RedeemInvite(ctx, "missing", now)
+	assert.ErrorIs(t, err, model.ErrInvalidInvite)
+
+	revoke := &model.Invite{Code: "revoke", Role: model.RoleUser, MaxUses: 1, ExpiresAt: expires, CreatedBy: "root"}
+	require.NoError(t, repo.CreateInvite(ctx, revoke))
+	require.NoError(t, repo.RevokeInvite(ctx, "revoke", now))
+	_, err = repo.RedeemInvite(ctx, "revoke", now)
+	assert.ErrorIs(t, err, model.ErrInvalidInvite)
+	got, err = repo.GetInvite(ctx, "revoke")
+	require.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+	assert.ErrorIs(t, repo.RevokeInvite(ctx, "missing", now), model.ErrInviteNotFound)
+}
@@ -0,0 +1,926 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"merch-shop/internal/model"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteRepository хранит данные в файле SQLite для установок на одном сервере.
+// Запросы повторяют PostgresRepository. Время передаётся в базу в UTC, поэтому
+// сравнение меток времени как строк сохраняет их порядок.
+type SQLiteRepository struct {
+	db       dbtx
+	timeouts Timeouts
+}
+
+func NewSQLiteRepository(db *sql.DB, timeouts Timeouts) Repository {
+	return &SQLiteRepository{db: db, timeouts: timeouts}
+}
+
+func (r *SQLiteRepository) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// utc приводит необязательный момент времени к UTC; nil передаётся как NULL.
+func utc(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// sqliteBuckets — выражения SQLite, заменяющие date_trunc для интервалов аналитики.
+// Неделя начинается с понедельника.
+var sqliteBuckets = map[string]string{
+	model.BucketDay:   "date(created_at)",
+	model.BucketWeek:  "date(created_at, 'weekday 0', '-6 days')",
+	model.BucketMonth: "date(created_at, 'start of month')",
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func (r *SQLiteRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username)
+	var user model.User
+	if err := scanUser(row, &user); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *SQLiteRepository) CreateUser(ctx context.Context, user *model.User) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	query := `INSERT INTO users (username, password, coins, role, display_name, email, department, external_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	err := r.db.QueryRowContext(ctx, query, user.Username, user.Password, user.Coins, user.Role,
+		user.DisplayName, user.Email, user.Department, user.ExternalID, time.Now().UTC()).Scan(&user.ID)
+	if isSQLiteUniqueViolation(err) {
+		return model.ErrUsernameTaken
+	}
+	if err == nil {
+		user.Active = true
+	}
+	return err
+}
+
+func (r *SQLiteRepository) UpdateUserProfile(ctx context.Context, user *model.User) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `UPDATE users SET password = $1, display_name = $2, email = $3, department = $4, external_id = $5, active = $6
+		WHERE id = $7`
+	res, err := r.db.ExecContext(ctx, query, user.Password, user.DisplayName, user.Email, user.Department, user.ExternalID, user.Active, user.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		var user model.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+// ListUsersPage сравнивает строки без учёта регистра только для латиницы:
+// LOWER в SQLite не знает других алфавитов.
+func (r *SQLiteRepository) ListUsersPage(ctx context.Context, q model.UserQuery) ([]*model.User, int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return listUsersPage(ctx, r.db, q)
+}
+
+// GetCoinsInCirculation возвращает сумму балансов активных пользователей.
+func (r *SQLiteRepository) GetCoinsInCirculation(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(coins), 0) FROM users WHERE active").Scan(&total)
+	return total, err
+}
+
+// AddCoins атомарно изменяет баланс пользователя на delta.
+func (r *SQLiteRepository) AddCoins(ctx context.Context, userID int64, delta int) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET coins = coins + $1 WHERE id = $2", delta, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) DebitCoins(ctx context.Context, userID int64, amount int) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1", amount, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return model.ErrUserNotFound
+	}
+	return model.ErrInsufficientCoins
+}
+
+// WithTx выполняет fn в транзакции SQLite. Транзакция открывается как
+// BEGIN IMMEDIATE (_txlock=immediate в строке подключения) и сразу берёт
+// блокировку записи, поэтому одновременные транзакции выполняются по очереди,
+// а не падают с SQLITE_BUSY при попытке записи после чтения.
+func (r *SQLiteRepository) WithTx(ctx context.Context, fn func(repo Repository) error) error {
+	return withTx(ctx, r.db, func(tx dbtx) error {
+		return fn(&SQLiteRepository{db: tx, timeouts: r.timeouts})
+	})
+}
+
+func (r *SQLiteRepository) SetLeaderboardOptOut(ctx context.Context, userID int64, optOut bool) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET leaderboard_opt_out = $1 WHERE id = $2", optOut, userID)
+	return err
+}
+
+func (r *SQLiteRepository) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID)
+	var user model.User
+	if err := scanUser(row, &user); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LockUser читает пользователя. Отдельная блокировка строки не нужна:
+// транзакция SQLite уже держит блокировку записи на всю базу.
+func (r *SQLiteRepository) LockUser(ctx context.Context, userID int64) (*model.User, error) {
+	return r.GetUserByID(ctx, userID)
+}
+
+func (r *SQLiteRepository) CreateTransaction(ctx context.Context, t *model.Transaction) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO transactions (from_user_id, to_user_id, amount, type, reason, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, t.FromUserID, t.ToUserID, t.Amount, t.Type, t.Reason, time.Now().UTC()).Scan(&t.ID)
+}
+
+func (r *SQLiteRepository) CreatePurchase(ctx context.Context, p *model.Purchase) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO purchases (user_id, item, price, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, p.UserID, p.Item, p.Price, time.Now().UTC()).Scan(&p.ID)
+}
+
+// GetInventoryByUserID возвращает купленные пользователем товары с количеством.
+// Если at не nil, учитываются только покупки, сделанные до момента at.
+func (r *SQLiteRepository) GetInventoryByUserID(ctx context.Context, userID int64, at *time.Time) ([]model.InventoryItem, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT item, COUNT(*) FROM purchases
+		WHERE user_id = $1 AND ($2 IS NULL OR created_at < $2)
+		GROUP BY item ORDER BY item`, userID, utc(at))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inventory []model.InventoryItem
+	for rows.Next() {
+		var item model.InventoryItem
+		if err := rows.Scan(&item.Type, &item.Quantity); err != nil {
+			return nil, err
+		}
+		inventory = append(inventory, item)
+	}
+	return inventory, rows.Err()
+}
+
+// GetCoinHistoryByUserID возвращает переводы пользователя с уже подставленными
+// именами отправителей и получателей. limit > 0 оставляет в каждом списке только
+// последние limit переводов; порядок внутри списка — от старых к новым. Если at
+// не nil, учитываются только переводы, сделанные до момента at.
+func (r *SQLiteRepository) GetCoinHistoryByUserID(ctx context.Context, userID int64, limit int, at *time.Time) (*model.CoinHistory, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	// В SQLite отрицательный LIMIT означает «без ограничения».
+	lim := -1
+	if limit > 0 {
+		lim = limit
+	}
+
+	history := &model.CoinHistory{}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT username, amount FROM (
+			SELECT t.id, u.username, t.amount FROM transactions t
+			JOIN users u ON u.id = t.from_user_id
+			WHERE t.to_user_id = $1 AND t.type = 'transfer' AND ($3 IS NULL OR t.created_at < $3)
+			ORDER BY t.id DESC LIMIT $2
+		) h ORDER BY id`, userID, lim, utc(at))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h model.CoinHistoryReceived
+		if err := rows.Scan(&h.FromUser, &h.Amount); err != nil {
+			return nil, err
+		}
+		history.Received = append(history.Received, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT username, amount FROM (
+			SELECT t.id, u.username, t.amount FROM transactions t
+			JOIN users u ON u.id = t.to_user_id
+			WHERE t.from_user_id = $1 AND t.type = 'transfer' AND ($3 IS NULL OR t.created_at < $3)
+			ORDER BY t.id DESC LIMIT $2
+		) h ORDER BY id`, userID, lim, utc(at))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h model.CoinHistorySent
+		if err := rows.Scan(&h.ToUser, &h.Amount); err != nil {
+			return nil, err
+		}
+		history.Sent = append(history.Sent, h)
+	}
+	return history, rows.Err()
+}
+
+func (r *SQLiteRepository) ListLedgerSummaries(ctx context.Context) ([]*model.LedgerSummary, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query := `
+		SELECT u.id, u.username, u.coins,
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'grant'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'transfer'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE from_user_id = u.id AND type = 'transfer'), 0),
+			COALESCE((SELECT SUM(price) FROM purchases WHERE user_id = u.id), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'expiry'), 0),
+			COALESCE((SELECT SUM(amount) FROM transactions WHERE to_user_id = u.id AND type = 'adjustment'), 0)
+		FROM users u
+		ORDER BY u.id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*model.LedgerSummary
+	for rows.Next() {
+		var s model.LedgerSummary
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Coins, &s.Granted, &s.Received, &s.Sent, &s.Spent, &s.Expired, &s.Adjusted); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &s)
+	}
+	return summaries, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	e.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO audit_log (actor, action, details, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, e.Actor, e.Action, e.Details, e.CreatedAt).Scan(&e.ID)
+}
+
+func (r *SQLiteRepository) CreateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := "INSERT INTO coin_lots (user_id, amount, remaining, granted_at, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, l.UserID, l.Amount, l.Remaining, l.GrantedAt.UTC(), l.ExpiresAt.UTC()).Scan(&l.ID)
+}
+
+func (r *SQLiteRepository) UpdateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE coin_lots SET remaining = $1 WHERE id = $2", l.Remaining, l.ID)
+	return err
+}
+
+// GetCoinLotsByUserID возвращает непогашенные партии пользователя в порядке расходования.
+func (r *SQLiteRepository) GetCoinLotsByUserID(ctx context.Context, userID int64) ([]*model.CoinLot, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	return r.queryCoinLots(ctx, `
+		SELECT id, user_id, amount, remaining, granted_at, expires_at FROM coin_lots
+		WHERE user_id = $1 AND remaining > 0
+		ORDER BY expires_at, id`, userID)
+}
+
+// GetExpiredCoinLots возвращает непогашенные партии, срок которых истёк к моменту now.
+func (r *SQLiteRepository) GetExpiredCoinLots(ctx context.Context, now time.Time) ([]*model.CoinLot, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	return r.queryCoinLots(ctx, `
+		SELECT id, user_id, amount, remaining, granted_at, expires_at FROM coin_lots
+		WHERE remaining > 0 AND expires_at <= $1
+		ORDER BY expires_at, id`, now.UTC())
+}
+
+func (r *SQLiteRepository) queryCoinLots(ctx context.Context, query string, args ...interface{}) ([]*model.CoinLot, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*model.CoinLot
+	for rows.Next() {
+		var l model.CoinLot
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Amount, &l.Remaining, &l.GrantedAt, &l.ExpiresAt); err != nil {
+			return nil, err
+		}
+		lots = append(lots, &l)
+	}
+	return lots, rows.Err()
+}
+
+func (r *SQLiteRepository) GetHistory(ctx context.Context, f model.HistoryFilter) ([]*model.LedgerEntry, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query := "SELECT id, type, direction, amount, counterparty, reason, created_at FROM (" + ledgerEntriesQuery + ") h WHERE TRUE"
+	args := []interface{}{f.UserID}
+	addArg := func(cond string, v interface{}) {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if f.Direction != "" {
+		addArg("direction = $%d", f.Direction)
+	}
+	if f.Type != "" {
+		addArg("type = $%d", f.Type)
+	}
+	if f.Counterparty != "" {
+		addArg("counterparty = $%d", f.Counterparty)
+	}
+	if f.From != nil {
+		addArg("created_at >= $%d", f.From.UTC())
+	}
+	if f.To != nil {
+		addArg("created_at < $%d", f.To.UTC())
+	}
+	if f.BeforeID > 0 {
+		addArg("id < $%d", f.BeforeID)
+	}
+	query += " ORDER BY id DESC, direction"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*model.LedgerEntry
+	for rows.Next() {
+		e, err := scanSQLiteLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// scanSQLiteLedgerEntry читает движение из выборки по ledgerEntriesQuery. Столбец
+// created_at подзапроса не имеет объявленного типа, поэтому время разбирается вручную.
+func scanSQLiteLedgerEntry(rows *sql.Rows) (*model.LedgerEntry, error) {
+	var e model.LedgerEntry
+	var createdAt string
+	if err := rows.Scan(&e.ID, &e.Type, &e.Direction, &e.Amount, &e.Counterparty, &e.Reason, &createdAt); err != nil {
+		return nil, err
+	}
+	t, err := parseSQLiteTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	e.CreatedAt = t
+	return &e, nil
+}
+
+func parseSQLiteTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unexpected time value %q", s)
+}
+
+// GetBalanceAt восстанавливает баланс пользователя по журналу на момент at
+// (движения в момент at не учитываются). Перевод самому себе даёт списание и
+// зачисление, как в ListLedgerSummaries, поэтому итог сходится со сверкой.
+func (r *SQLiteRepository) GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query := "SELECT COALESCE(SUM(CASE WHEN direction = 'out' THEN -amount ELSE amount END), 0) FROM (" +
+		ledgerEntriesQuery + ") h WHERE created_at < $2"
+	var balance int
+	err := r.db.QueryRowContext(ctx, query, userID, at.UTC()).Scan(&balance)
+	return balance, err
+}
+
+// StreamLedger передаёт в fn движения пользователя за период [from, to) от старых
+// к новым, не загружая их в память целиком. Ошибка fn прерывает обход.
+func (r *SQLiteRepository) StreamLedger(ctx context.Context, userID int64, from, to time.Time, fn func(*model.LedgerEntry) error) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query := "SELECT id, type, direction, amount, counterparty, reason, created_at FROM (" +
+		ledgerEntriesQuery + ") h WHERE created_at >= $2 AND created_at < $3 ORDER BY created_at, id, direction DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanSQLiteLedgerEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var sqliteLeaderboardQueries = map[string]string{
+	model.LeaderboardGivers: `
+		SELECT u.username, SUM(t.amount) AS total FROM transactions t
+		JOIN users u ON u.id = t.from_user_id
+		WHERE t.type = 'transfer' AND NOT u.leaderboard_opt_out AND ($1 IS NULL OR t.created_at >= $1)
+			AND ($2 = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+	model.LeaderboardReceivers: `
+		SELECT u.username, SUM(t.amount) AS total FROM transactions t
+		JOIN users u ON u.id = t.to_user_id
+		WHERE t.type = 'transfer' AND NOT u.leaderboard_opt_out AND ($1 IS NULL OR t.created_at >= $1)
+			AND ($2 = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+	model.LeaderboardSpenders: `
+		SELECT u.username, SUM(p.price) AS total FROM purchases p
+		JOIN users u ON u.id = p.user_id
+		WHERE NOT u.leaderboard_opt_out AND ($1 IS NULL OR p.created_at >= $1)
+			AND ($2 = '' OR LOWER(u.department) = LOWER($2))
+		GROUP BY u.id, u.username`,
+}
+
+// GetLeaderboard возвращает первые limit участников рейтинга board с момента since
+// (nil — за всё время) среди сотрудников отдела department (пустая строка — все
+// отделы; регистр не учитывается). Пользователи, отказавшиеся от рейтингов, не
+// учитываются.
+func (r *SQLiteRepository) GetLeaderboard(ctx context.Context, board string, since *time.Time, department string, limit int) ([]model.LeaderboardEntry, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query, ok := sqliteLeaderboardQueries[board]
+	if !ok {
+		return nil, model.ErrInvalidLeaderboard
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY total DESC, u.username LIMIT $3", utc(since), department, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.LeaderboardEntry
+	for rows.Next() {
+		var e model.LeaderboardEntry
+		if err := rows.Scan(&e.Username, &e.Total); err != nil {
+			return nil, err
+		}
+		e.Rank = len(entries) + 1
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteRepository) GetItemSales(ctx context.Context, q model.AnalyticsQuery) ([]model.ItemSalesPoint, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	bucket, ok := sqliteBuckets[q.Bucket]
+	if !ok {
+		return nil, model.ErrInvalidBucket
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+bucket+` AS bucket, item, COUNT(*), SUM(price) FROM purchases
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY bucket, item
+		ORDER BY bucket, item`, q.From.UTC(), q.To.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.ItemSalesPoint
+	for rows.Next() {
+		var p model.ItemSalesPoint
+		var b string
+		if err := rows.Scan(&b, &p.Item, &p.Purchases, &p.Revenue); err != nil {
+			return nil, err
+		}
+		if p.Bucket, err = parseSQLiteTime(b); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// GetCoinSupplyChanges возвращает число монет в обращении на начало периода и
+// его изменение по интервалам.
+func (r *SQLiteRepository) GetCoinSupplyChanges(ctx context.Context, q model.AnalyticsQuery) (int, []model.BucketValue, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	bucket, ok := sqliteBuckets[q.Bucket]
+	if !ok {
+		return 0, nil, model.ErrInvalidBucket
+	}
+	var opening int
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM("+supplyDeltaSQL+"), 0) FROM transactions WHERE created_at < $1", q.From.UTC()).Scan(&opening); err != nil {
+		return 0, nil, err
+	}
+	changes, err := r.queryBucketValues(ctx, `
+		SELECT `+bucket+` AS bucket, SUM(`+supplyDeltaSQL+`) FROM transactions
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY bucket
+		ORDER BY bucket`, q.From.UTC(), q.To.UTC())
+	return opening, changes, err
+}
+
+// GetActiveUsers возвращает число пользователей, совершивших перевод или покупку
+// либо получивших перевод, по интервалам.
+func (r *SQLiteRepository) GetActiveUsers(ctx context.Context, q model.AnalyticsQuery) ([]model.BucketValue, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	bucket, ok := sqliteBuckets[q.Bucket]
+	if !ok {
+		return nil, model.ErrInvalidBucket
+	}
+	return r.queryBucketValues(ctx, `
+		SELECT `+bucket+` AS bucket, COUNT(DISTINCT user_id) FROM (
+			SELECT created_at, to_user_id AS user_id FROM transactions WHERE type IN ('transfer', 'purchase')
+			UNION ALL
+			SELECT created_at, from_user_id FROM transactions WHERE type = 'transfer'
+		) a
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY bucket
+		ORDER BY bucket`, q.From.UTC(), q.To.UTC())
+}
+
+func (r *SQLiteRepository) GetTransferVolume(ctx context.Context, q model.AnalyticsQuery) ([]model.TransferPoint, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	bucket, ok := sqliteBuckets[q.Bucket]
+	if !ok {
+		return nil, model.ErrInvalidBucket
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+bucket+` AS bucket, COUNT(*), SUM(amount) FROM transactions
+		WHERE type = 'transfer' AND created_at >= $1 AND created_at < $2
+		GROUP BY bucket
+		ORDER BY bucket`, q.From.UTC(), q.To.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.TransferPoint
+	for rows.Next() {
+		var p model.TransferPoint
+		var b string
+		if err := rows.Scan(&b, &p.Transfers, &p.Volume); err != nil {
+			return nil, err
+		}
+		if p.Bucket, err = parseSQLiteTime(b); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func (r *SQLiteRepository) queryBucketValues(ctx context.Context, query string, args ...interface{}) ([]model.BucketValue, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []model.BucketValue
+	for rows.Next() {
+		var v model.BucketValue
+		var b string
+		if err := rows.Scan(&b, &v.Value); err != nil {
+			return nil, err
+		}
+		if v.Bucket, err = parseSQLiteTime(b); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateLoginAttempt(ctx context.Context, a *model.LoginAttempt) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	a.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO login_attempts (username, ip, result, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, a.Username, a.IP, a.Result, a.CreatedAt).Scan(&a.ID)
+}
+
+func (r *SQLiteRepository) ListLoginAttempts(ctx context.Context, f model.LoginAttemptFilter) ([]*model.LoginAttempt, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	query, args := loginAttemptsQuery(f)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*model.LoginAttempt
+	for rows.Next() {
+		var a model.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.Username, &a.IP, &a.Result, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &a)
+	}
+	return attempts, rows.Err()
+}
+
+func (r *SQLiteRepository) GetLoginActivity(ctx context.Context, q model.LoginActivityQuery) ([]model.LoginActivity, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Report)
+	defer cancel()
+
+	query, args, err := loginActivityQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []model.LoginActivity
+	for rows.Next() {
+		var a model.LoginActivity
+		var key, last string
+		if err := rows.Scan(&key, &a.Failures, &a.Successes, &a.Usernames, &a.IPs, &last); err != nil {
+			return nil, err
+		}
+		if a.LastAttempt, err = parseSQLiteTime(last); err != nil {
+			return nil, err
+		}
+		setLoginActivityKey(&a, q.By, key)
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+func (r *SQLiteRepository) GetLoginLockout(ctx context.Context, username string) (*model.LoginLockout, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	l := &model.LoginLockout{Username: username}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, "SELECT failures, locked_until FROM login_lockouts WHERE username = $1", username).
+		Scan(&l.Failures, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		t := lockedUntil.Time.UTC()
+		l.LockedUntil = &t
+	}
+	return l, nil
+}
+
+// RecordLoginFailure атомарно увеличивает счётчик неудачных входов подряд и
+// возвращает новое значение.
+func (r *SQLiteRepository) RecordLoginFailure(ctx context.Context, username string) (int, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_lockouts (username, failures) VALUES ($1, 1)
+		ON CONFLICT (username) DO UPDATE SET failures = login_lockouts.failures + 1
+		RETURNING failures`, username).Scan(&failures)
+	return failures, err
+}
+
+func (r *SQLiteRepository) LockLogin(ctx context.Context, username string, until time.Time) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "UPDATE login_lockouts SET locked_until = $1 WHERE username = $2", until.UTC(), username)
+	return err
+}
+
+// ResetLoginFailures сбрасывает счётчик неудачных входов и снимает блокировку.
+func (r *SQLiteRepository) ResetLoginFailures(ctx context.Context, username string) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_lockouts WHERE username = $1", username)
+	return err
+}
+
+// scanSQLiteInvite читает приглашение и приводит его метки времени к UTC.
+func scanSQLiteInvite(row interface{ Scan(...interface{}) error }) (*model.Invite, error) {
+	inv, err := scanInvite(row)
+	if err != nil {
+		return nil, err
+	}
+	inv.ExpiresAt = inv.ExpiresAt.UTC()
+	inv.CreatedAt = inv.CreatedAt.UTC()
+	if inv.RevokedAt != nil {
+		t := inv.RevokedAt.UTC()
+		inv.RevokedAt = &t
+	}
+	return inv, nil
+}
+
+func (r *SQLiteRepository) CreateInvite(ctx context.Context, inv *model.Invite) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	inv.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO invites (code, role, max_uses, expires_at, created_by, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	return r.db.QueryRowContext(ctx, query, inv.Code, inv.Role, inv.MaxUses, inv.ExpiresAt.UTC(), inv.CreatedBy, inv.CreatedAt).Scan(&inv.ID)
+}
+
+func (r *SQLiteRepository) GetInvite(ctx context.Context, code string) (*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	inv, err := scanSQLiteInvite(r.db.QueryRowContext(ctx, "SELECT "+inviteColumns+" FROM invites WHERE code = $1", code))
+	if err == sql.ErrNoRows {
+		return nil, model.ErrInviteNotFound
+	}
+	return inv, err
+}
+
+func (r *SQLiteRepository) ListInvites(ctx context.Context) ([]*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+inviteColumns+" FROM invites ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*model.Invite
+	for rows.Next() {
+		inv, err := scanSQLiteInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+func (r *SQLiteRepository) RedeemInvite(ctx context.Context, code string, now time.Time) (*model.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	inv, err := scanSQLiteInvite(r.db.QueryRowContext(ctx, `
+		UPDATE invites SET uses = uses + 1
+		WHERE code = $1 AND revoked_at IS NULL AND uses < max_uses AND expires_at > $2
+		RETURNING `+inviteColumns, code, now.UTC()))
+	if err == sql.ErrNoRows {
+		return nil, model.ErrInvalidInvite
+	}
+	return inv, err
+}
+
+func (r *SQLiteRepository) RevokeInvite(ctx context.Context, code string, at time.Time) error {
+	ctx, cancel := r.withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "UPDATE invites SET revoked_at = COALESCE(revoked_at, $1) WHERE code = $2", at.UTC(), code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrInviteNotFound
+	}
+	return nil
+}
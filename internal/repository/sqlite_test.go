@@ -0,0 +1,86 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"merch-shop/internal/config"
+	"merch-shop/internal/database"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/repository/repotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteRepository(t *testing.T) repository.Repository {
+	db, err := database.ConnectSQLite(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "shop.db"), MaxOpenConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db, database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewSQLiteRepository(db, repository.DefaultTimeouts)
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	repotest.Run(t, newSQLiteRepository)
+}
+
+// TestSQLiteRepository_ImmediateTx проверяет, что WithTx берёт блокировку записи
+// в начале транзакции. Каждая транзакция читает баланс, а затем меняет его: при
+// BEGIN DEFERRED соединения читали бы одно и то же значение, и запись после
+// чтения падала бы с SQLITE_BUSY. С BEGIN IMMEDIATE транзакции идут по очереди
+// и каждая видит результат предыдущей.
+func TestSQLiteRepository_ImmediateTx(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepository(t)
+	user := &model.User{Username: "alice", Password: "secret"}
+	require.NoError(t, repo.CreateUser(ctx, user))
+
+	const workers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	seen := make(chan int, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.WithTx(ctx, func(tx repository.Repository) error {
+				got, err := tx.GetUserByID(ctx, user.ID)
+				if err != nil {
+					return err
+				}
+				seen <- got.Coins
+				// Даём другим соединениям время начать свои транзакции.
+				time.Sleep(5 * time.Millisecond)
+				return tx.AddCoins(ctx, user.ID, 1)
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(seen)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	balances := make(map[int]bool)
+	for coins := range seen {
+		assert.False(t, balances[coins], "two transactions read the same balance %d", coins)
+		balances[coins] = true
+	}
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, workers, got.Coins)
+}
@@ -0,0 +1,215 @@
+package scim
+
+import (
+	"strconv"
+	"strings"
+
+	"merch-shop/internal/model"
+)
+
+// Filter — условия вида `attribute eq value`, соединённые `and`. Поддерживается
+// только сравнение на равенство: так ищут пользователей системы управления
+// персоналом перед созданием и при сверке.
+type Filter struct {
+	Terms []Term
+}
+
+// Term — одно условие фильтра. Attribute хранится в нижнем регистре.
+type Term struct {
+	Attribute string
+	Value     string
+}
+
+// filterAttributes — атрибуты, по которым можно искать, в нижнем регистре.
+var filterAttributes = map[string]bool{
+	"username":                            true,
+	"externalid":                          true,
+	"displayname":                         true,
+	"emails":                              true,
+	"emails.value":                        true,
+	`emails[type eq "work"].value`:        true,
+	"active":                              true,
+	strings.ToLower(enterpriseDepartment): true,
+}
+
+// enterpriseDepartment — полный путь атрибута department расширения enterprise.
+const enterpriseDepartment = SchemaEnterpriseUser + ":department"
+
+// ParseFilter разбирает параметр filter. Пустая строка даёт фильтр, которому
+// соответствуют все пользователи.
+func ParseFilter(expr string) (*Filter, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+	f := &Filter{}
+	for {
+		term, rest, err := parseTerm(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.Terms = append(f.Terms, term)
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return f, nil
+		}
+		op, next, ok := strings.Cut(rest, " ")
+		if !ok || !strings.EqualFold(op, "and") {
+			return nil, model.ErrInvalidFilter
+		}
+		expr = strings.TrimSpace(next)
+	}
+}
+
+// parseTerm разбирает условие `attribute eq value` в начале expr и возвращает
+// остаток выражения после значения.
+func parseTerm(expr string) (Term, string, error) {
+	attr, rest, ok := cutAttribute(expr)
+	if !ok {
+		return Term{}, "", model.ErrInvalidFilter
+	}
+	op, rest, ok := strings.Cut(strings.TrimLeft(rest, " "), " ")
+	if !ok || !strings.EqualFold(op, "eq") {
+		return Term{}, "", model.ErrInvalidFilter
+	}
+	attr = strings.ToLower(attr)
+	if !filterAttributes[attr] {
+		return Term{}, "", model.ErrInvalidFilter
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	var value string
+	if strings.HasPrefix(rest, `"`) {
+		end := closingQuote(rest)
+		if end < 0 {
+			return Term{}, "", model.ErrInvalidFilter
+		}
+		unquoted, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return Term{}, "", model.ErrInvalidFilter
+		}
+		value, rest = unquoted, rest[end+1:]
+		if rest != "" && rest[0] != ' ' {
+			return Term{}, "", model.ErrInvalidFilter
+		}
+	} else {
+		value, rest, _ = strings.Cut(rest, " ")
+		if value != "true" && value != "false" {
+			return Term{}, "", model.ErrInvalidFilter
+		}
+	}
+	if (attr == "active") != (value == "true" || value == "false") {
+		return Term{}, "", model.ErrInvalidFilter
+	}
+	return Term{Attribute: attr, Value: value}, rest, nil
+}
+
+// closingQuote возвращает индекс кавычки, закрывающей строку в начале s, или -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// cutAttribute отделяет путь атрибута от остатка выражения по первому пробелу
+// вне квадратных скобок: путь может содержать вложенный фильтр, например
+// emails[type eq "work"].value.
+func cutAttribute(expr string) (attr, rest string, ok bool) {
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ' ':
+			if depth == 0 {
+				return expr[:i], expr[i+1:], true
+			}
+		}
+	}
+	return expr, "", false
+}
+
+// Match сообщает, соответствует ли пользователь всем условиям фильтра. Фильтр
+// nil соответствует всем. Строки, кроме externalId, сравниваются без учёта
+// регистра; сравнение с пустой строкой не проходит никогда.
+func (f *Filter) Match(u *model.User) bool {
+	if f == nil {
+		return true
+	}
+	for _, t := range f.Terms {
+		if !t.match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Term) match(u *model.User) bool {
+	if t.Attribute == "active" {
+		return u.Active == (t.Value == "true")
+	}
+	if t.Value == "" {
+		return false
+	}
+	switch t.Attribute {
+	case "username":
+		return strings.EqualFold(u.Username, t.Value)
+	case "externalid":
+		return u.ExternalID == t.Value
+	case "displayname":
+		return strings.EqualFold(u.DisplayName, t.Value)
+	case strings.ToLower(enterpriseDepartment):
+		return strings.EqualFold(u.Department, t.Value)
+	default:
+		return strings.EqualFold(u.Email, t.Value)
+	}
+}
+
+// Query переводит фильтр в выборку хранилища. ok == false, если фильтру не
+// может соответствовать ни один пользователь: условия на один атрибут
+// противоречат друг другу или значение пустое.
+func (f *Filter) Query() (q model.UserQuery, ok bool) {
+	if f == nil {
+		return q, true
+	}
+	set := func(field *string, value string, fold bool) bool {
+		if value == "" {
+			return false
+		}
+		if *field != "" && *field != value && !(fold && strings.EqualFold(*field, value)) {
+			return false
+		}
+		*field = value
+		return true
+	}
+	for _, t := range f.Terms {
+		switch t.Attribute {
+		case "username":
+			ok = set(&q.Username, t.Value, true)
+		case "externalid":
+			ok = set(&q.ExternalID, t.Value, false)
+		case "displayname":
+			ok = set(&q.DisplayName, t.Value, true)
+		case "active":
+			active := t.Value == "true"
+			ok = q.Active == nil || *q.Active == active
+			q.Active = &active
+		case strings.ToLower(enterpriseDepartment):
+			ok = set(&q.Department, t.Value, true)
+		default:
+			ok = set(&q.Email, t.Value, true)
+		}
+		if !ok {
+			return model.UserQuery{}, false
+		}
+	}
+	return q, true
+}
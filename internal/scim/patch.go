@@ -0,0 +1,141 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"merch-shop/internal/model"
+)
+
+// PatchOperation — операция PATCH: add, replace или remove. Без Path значение
+// Value — объект с атрибутами верхнего уровня.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyPatch применяет операции к пользователю u по порядку. Для add и replace
+// значения одинаковы, потому что все поддерживаемые атрибуты однозначные;
+// remove очищает атрибут. Неизвестный путь — ошибка, а неизвестные атрибуты в
+// операции без пути пропускаются, как при создании пользователя.
+func ApplyPatch(u *model.User, ops []PatchOperation) error {
+	for _, op := range ops {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if op.Path != "" {
+				if err := setAttribute(u, op.Path, op.Value); err != nil {
+					return err
+				}
+				continue
+			}
+			var attrs map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return model.BadRequest("patch value without path must be an object")
+			}
+			paths := make([]string, 0, len(attrs))
+			for path := range attrs {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				err := setAttribute(u, path, attrs[path])
+				if err != nil && !errors.Is(err, model.ErrInvalidPath) {
+					return err
+				}
+			}
+		case "remove":
+			if op.Path == "" {
+				return model.ErrInvalidPath
+			}
+			if err := setAttribute(u, op.Path, json.RawMessage("null")); err != nil {
+				return err
+			}
+		default:
+			return model.BadRequest("unsupported patch operation " + strconv.Quote(op.Op))
+		}
+	}
+	return nil
+}
+
+// setAttribute записывает в u значение атрибута path. null очищает атрибут.
+func setAttribute(u *model.User, path string, raw json.RawMessage) error {
+	var err error
+	switch strings.ToLower(path) {
+	case "username":
+		u.Username, err = stringValue(path, raw)
+	case "displayname", "name.formatted":
+		u.DisplayName, err = stringValue(path, raw)
+	case "externalid":
+		u.ExternalID, err = stringValue(path, raw)
+	case "password":
+		u.Password, err = stringValue(path, raw)
+	case "emails.value", `emails[type eq "work"].value`:
+		u.Email, err = stringValue(path, raw)
+	case strings.ToLower(enterpriseDepartment):
+		u.Department, err = stringValue(path, raw)
+	case "active":
+		u.Active, err = boolValue(path, raw)
+	case "emails":
+		var emails []Email
+		if err := json.Unmarshal(raw, &emails); err != nil {
+			return invalidValue(path)
+		}
+		u.Email = primaryEmail(emails)
+	case "name":
+		var name *Name
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return invalidValue(path)
+		}
+		u.DisplayName = ""
+		if name != nil {
+			u.DisplayName = name.displayName()
+		}
+	case strings.ToLower(SchemaEnterpriseUser):
+		var ext *EnterpriseUser
+		if err := json.Unmarshal(raw, &ext); err != nil {
+			return invalidValue(path)
+		}
+		u.Department = ""
+		if ext != nil {
+			u.Department = ext.Department
+		}
+	default:
+		return model.ErrInvalidPath
+	}
+	return err
+}
+
+func stringValue(path string, raw json.RawMessage) (string, error) {
+	var s *string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", invalidValue(path)
+	}
+	if s == nil {
+		return "", nil
+	}
+	return *s, nil
+}
+
+// boolValue принимает логическое значение и его строковую запись: некоторые
+// системы присылают "False" вместо false.
+func boolValue(path string, raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, invalidValue(path)
+}
+
+func invalidValue(path string) error {
+	return model.BadRequest("invalid value for " + path)
+}
@@ -0,0 +1,185 @@
+// Package scim переводит ресурсы SCIM 2.0 (RFC 7643, RFC 7644) в пользователей
+// магазина и обратно: разбирает фильтры и применяет операции PATCH.
+package scim
+
+import (
+	"net/http"
+	"strconv"
+
+	"merch-shop/internal/model"
+)
+
+const (
+	SchemaUser           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaEnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaListResponse   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError          = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// ContentType — тип содержимого ответов SCIM.
+const ContentType = "application/scim+json"
+
+// UsersPath — путь коллекции пользователей.
+const UsersPath = "/scim/v2/Users"
+
+// User — ресурс пользователя SCIM. Password только принимается и никогда не
+// возвращается; Active без значения при создании означает активного пользователя.
+type User struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Name        *Name           `json:"name,omitempty"`
+	Emails      []Email         `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Password    string          `json:"password,omitempty"`
+	Enterprise  *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type EnterpriseUser struct {
+	Department string `json:"department,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// ListResponse — страница результатов поиска; StartIndex считается с 1.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// PatchRequest — тело запроса PATCH.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations" binding:"required,min=1"`
+}
+
+// Error — тело ответа об ошибке SCIM. Status — HTTP-статус строкой.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// scimTypes сопоставляет коды доменных ошибок с типами ошибок SCIM.
+var scimTypes = map[string]string{
+	model.ErrUsernameTaken.Code:     "uniqueness",
+	model.ErrUsernameImmutable.Code: "mutability",
+	model.ErrInvalidFilter.Code:     "invalidFilter",
+	model.ErrInvalidPath.Code:       "invalidPath",
+	"invalid_request":               "invalidValue",
+}
+
+// NewError строит ответ об ошибке по статусу и коду доменной ошибки. SCIM не
+// использует 422, поэтому ошибки проверки значений отдаются как 400.
+func NewError(status int, code, detail string) (int, Error) {
+	if status == http.StatusUnprocessableEntity {
+		status = http.StatusBadRequest
+	}
+	return status, Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimTypes[code],
+		Detail:   detail,
+	}
+}
+
+// FromModel представляет пользователя магазина ресурсом SCIM.
+func FromModel(u *model.User) User {
+	id := strconv.FormatInt(u.ID, 10)
+	active := u.Active
+	res := User{
+		Schemas:     []string{SchemaUser},
+		ID:          id,
+		ExternalID:  u.ExternalID,
+		UserName:    u.Username,
+		DisplayName: u.DisplayName,
+		Active:      &active,
+		Meta:        &Meta{ResourceType: "User", Location: UsersPath + "/" + id},
+	}
+	if u.Email != "" {
+		res.Emails = []Email{{Value: u.Email, Type: "work", Primary: true}}
+	}
+	if u.Department != "" {
+		res.Schemas = append(res.Schemas, SchemaEnterpriseUser)
+		res.Enterprise = &EnterpriseUser{Department: u.Department}
+	}
+	return res
+}
+
+// ToModel возвращает нового пользователя магазина по ресурсу SCIM.
+func (u *User) ToModel() *model.User {
+	user := &model.User{
+		Username:    u.UserName,
+		Password:    u.Password,
+		DisplayName: u.DisplayName,
+		Email:       primaryEmail(u.Emails),
+		ExternalID:  u.ExternalID,
+		Active:      u.Active == nil || *u.Active,
+	}
+	if user.DisplayName == "" && u.Name != nil {
+		user.DisplayName = u.Name.displayName()
+	}
+	if u.Enterprise != nil {
+		user.Department = u.Enterprise.Department
+	}
+	return user
+}
+
+// ParseID разбирает идентификатор ресурса; неизвестный идентификатор даёт
+// model.ErrUserNotFound.
+func ParseID(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, model.ErrUserNotFound
+	}
+	return n, nil
+}
+
+func (n *Name) displayName() string {
+	if n.Formatted != "" {
+		return n.Formatted
+	}
+	switch {
+	case n.GivenName == "":
+		return n.FamilyName
+	case n.FamilyName == "":
+		return n.GivenName
+	}
+	return n.GivenName + " " + n.FamilyName
+}
+
+// primaryEmail возвращает основной адрес или первый из списка.
+func primaryEmail(emails []Email) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
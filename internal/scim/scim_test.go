@@ -0,0 +1,194 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"merch-shop/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromModel(t *testing.T) {
+	res := FromModel(&model.User{
+		ID:          7,
+		Username:    "alice",
+		Password:    "secret",
+		DisplayName: "Alice Liddell",
+		Email:       "alice@example.com",
+		Department:  "Design",
+		ExternalID:  "hr-1",
+		Active:      true,
+	})
+
+	data, err := json.Marshal(res)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+		"id": "7",
+		"externalId": "hr-1",
+		"userName": "alice",
+		"displayName": "Alice Liddell",
+		"emails": [{"value": "alice@example.com", "type": "work", "primary": true}],
+		"active": true,
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Design"},
+		"meta": {"resourceType": "User", "location": "/scim/v2/Users/7"}
+	}`, string(data))
+}
+
+func TestToModel(t *testing.T) {
+	var res User
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "bob",
+		"externalId": "hr-2",
+		"name": {"givenName": "Bob", "familyName": "Smith"},
+		"emails": [{"value": "home@example.com"}, {"value": "bob@example.com", "primary": true}],
+		"password": "secret",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Sales"}
+	}`), &res))
+
+	u := res.ToModel()
+	assert.Equal(t, "bob", u.Username)
+	assert.Equal(t, "secret", u.Password)
+	assert.Equal(t, "Bob Smith", u.DisplayName)
+	assert.Equal(t, "bob@example.com", u.Email)
+	assert.Equal(t, "Sales", u.Department)
+	assert.Equal(t, "hr-2", u.ExternalID)
+	assert.True(t, u.Active, "active по умолчанию")
+
+	inactive := false
+	res.Active = &inactive
+	assert.False(t, res.ToModel().Active)
+}
+
+func TestParseFilter(t *testing.T) {
+	alice := &model.User{Username: "alice", ExternalID: "hr-1", Email: "Alice@Example.com", Department: "Design", Active: true}
+
+	for _, tt := range []struct {
+		expr  string
+		match bool
+	}{
+		{`userName eq "ALICE"`, true},
+		{`userName eq "bob"`, false},
+		{`externalId eq "hr-1"`, true},
+		{`externalId eq "HR-1"`, false},
+		{`emails.value eq "alice@example.com"`, true},
+		{`emails[type eq "work"].value eq "alice@example.com"`, true},
+		{`active eq false`, false},
+		{`active eq true`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "design"`, true},
+		{`displayName eq "Alice Liddell"`, false},
+		{`userName eq "alice" and active eq true`, true},
+		{`userName eq "alice" AND externalId eq "hr-2"`, false},
+		{`emails.value eq "alice and bob@example.com" and active eq true`, false},
+		{`displayName eq ""`, false},
+	} {
+		f, err := ParseFilter(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			assert.Equal(t, tt.match, f.Match(alice), tt.expr)
+		}
+	}
+
+	f, err := ParseFilter("")
+	assert.NoError(t, err)
+	assert.True(t, f.Match(alice))
+
+	for _, expr := range []string{
+		`userName`,
+		`userName co "ali"`,
+		`title eq "x"`,
+		`userName eq alice`,
+		`userName eq "alice" or active eq true`,
+		`userName eq "alice" and`,
+		`userName eq "alice"active eq true`,
+		`active eq "yes"`,
+	} {
+		_, err := ParseFilter(expr)
+		assert.ErrorIs(t, err, model.ErrInvalidFilter, expr)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	f, err := ParseFilter(`userName eq "Alice" and active eq true and urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "Design"`)
+	require.NoError(t, err)
+	q, ok := f.Query()
+	require.True(t, ok)
+	assert.Equal(t, "Alice", q.Username)
+	assert.Equal(t, "Design", q.Department)
+	if assert.NotNil(t, q.Active) {
+		assert.True(t, *q.Active)
+	}
+
+	q, ok = (*Filter)(nil).Query()
+	assert.True(t, ok)
+	assert.Equal(t, model.UserQuery{}, q)
+
+	for _, expr := range []string{
+		`userName eq "alice" and userName eq "bob"`,
+		`active eq true and active eq false`,
+		`externalId eq "hr-1" and externalId eq "HR-1"`,
+		`emails.value eq ""`,
+	} {
+		f, err := ParseFilter(expr)
+		require.NoError(t, err, expr)
+		_, ok := f.Query()
+		assert.False(t, ok, expr)
+	}
+
+	f, err = ParseFilter(`userName eq "alice" and userName eq "ALICE"`)
+	require.NoError(t, err)
+	_, ok = f.Query()
+	assert.True(t, ok)
+}
+
+func TestApplyPatch(t *testing.T) {
+	u := &model.User{Username: "alice", DisplayName: "Alice", Email: "alice@example.com", Active: true}
+	var req PatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "alice@wonderland.example"},
+			{"op": "Replace", "value": {
+				"displayName": "Alice Liddell",
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department": "Research",
+				"name.givenName": "Alice"
+			}},
+			{"op": "add", "path": "externalId", "value": "hr-1"},
+			{"op": "replace", "path": "active", "value": "False"}
+		]
+	}`), &req))
+
+	require.NoError(t, ApplyPatch(u, req.Operations))
+	assert.Equal(t, "alice@wonderland.example", u.Email)
+	assert.Equal(t, "Alice Liddell", u.DisplayName)
+	assert.Equal(t, "Research", u.Department)
+	assert.Equal(t, "hr-1", u.ExternalID)
+	assert.False(t, u.Active)
+
+	require.NoError(t, ApplyPatch(u, []PatchOperation{{Op: "remove", Path: "externalId"}}))
+	assert.Empty(t, u.ExternalID)
+
+	err := ApplyPatch(u, []PatchOperation{{Op: "replace", Path: "title", Value: json.RawMessage(`"CEO"`)}})
+	assert.ErrorIs(t, err, model.ErrInvalidPath)
+	err = ApplyPatch(u, []PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`"maybe"`)}})
+	assert.Error(t, err)
+	err = ApplyPatch(u, []PatchOperation{{Op: "move", Path: "active"}})
+	assert.Error(t, err)
+	err = ApplyPatch(u, []PatchOperation{{Op: "remove"}})
+	assert.ErrorIs(t, err, model.ErrInvalidPath)
+}
+
+func TestNewError(t *testing.T) {
+	status, body := NewError(http.StatusConflict, model.ErrUsernameTaken.Code, "username is already taken")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "409", body.Status)
+	assert.Equal(t, "uniqueness", body.ScimType)
+	assert.Equal(t, []string{SchemaError}, body.Schemas)
+
+	status, body = NewError(http.StatusUnprocessableEntity, model.ErrUsernameImmutable.Code, "username cannot be changed")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "mutability", body.ScimType)
+}
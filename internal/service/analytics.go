@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	AnalyticsSeriesPurchases   = "purchases"
+	AnalyticsSeriesBalances    = "balances"
+	AnalyticsSeriesActiveUsers = "active-users"
+	AnalyticsSeriesTransfers   = "transfers"
+)
+
+// maxAnalyticsBuckets ограничивает длину ряда, чтобы запрос за годы по дням не
+// строил огромный ответ.
+const maxAnalyticsBuckets = 1000
+
+// GetAnalytics возвращает временной ряд series за период запроса. Все интервалы
+// считаются в UTC, неделя начинается с понедельника, как в date_trunc.
+func GetAnalytics(ctx context.Context, repo repository.Repository, series string, q model.AnalyticsQuery) (_ *model.AnalyticsResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetAnalytics", attribute.String("series", series))
+	defer tracing.End(span, &err)
+
+	q.From, q.To = q.From.UTC(), q.To.UTC()
+	buckets, err := analyticsBuckets(q)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &model.AnalyticsResponse{Series: series, Bucket: q.Bucket, From: q.From, To: q.To}
+	switch series {
+	case AnalyticsSeriesPurchases:
+		points, err := repo.GetItemSales(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if points == nil {
+			points = []model.ItemSalesPoint{}
+		}
+		resp.Points = points
+	case AnalyticsSeriesBalances:
+		resp.Points, err = coinSupply(ctx, repo, q, buckets)
+	case AnalyticsSeriesActiveUsers:
+		var active []model.BucketValue
+		active, err = repo.GetActiveUsers(ctx, q)
+		if err == nil {
+			resp.Points = fillBuckets(buckets, active)
+		}
+	case AnalyticsSeriesTransfers:
+		resp.Points, err = transferVolume(ctx, repo, q, buckets)
+	default:
+		return nil, model.ErrInvalidSeries
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// coinSupply возвращает число монет на руках у всех пользователей на конец каждого интервала.
+func coinSupply(ctx context.Context, repo repository.Repository, q model.AnalyticsQuery, buckets []time.Time) ([]model.BucketValue, error) {
+	supply, changes, err := repo.GetCoinSupplyChanges(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	points := fillBuckets(buckets, changes)
+	for i := range points {
+		supply += points[i].Value
+		points[i].Value = supply
+	}
+	return points, nil
+}
+
+func transferVolume(ctx context.Context, repo repository.Repository, q model.AnalyticsQuery, buckets []time.Time) ([]model.TransferPoint, error) {
+	supply, err := coinSupply(ctx, repo, q, buckets)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := repo.GetTransferVolume(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	byBucket := make(map[int64]model.TransferPoint, len(transfers))
+	for _, p := range transfers {
+		byBucket[p.Bucket.Unix()] = p
+	}
+
+	points := make([]model.TransferPoint, len(buckets))
+	for i, b := range buckets {
+		p := byBucket[b.Unix()]
+		p.Bucket = b
+		if supply[i].Value > 0 {
+			p.Velocity = float64(p.Volume) / float64(supply[i].Value)
+		}
+		points[i] = p
+	}
+	return points, nil
+}
+
+// fillBuckets раскладывает значения по интервалам, подставляя ноль там, где данных нет.
+func fillBuckets(buckets []time.Time, values []model.BucketValue) []model.BucketValue {
+	byBucket := make(map[int64]int, len(values))
+	for _, v := range values {
+		byBucket[v.Bucket.Unix()] = v.Value
+	}
+	points := make([]model.BucketValue, len(buckets))
+	for i, b := range buckets {
+		points[i] = model.BucketValue{Bucket: b, Value: byBucket[b.Unix()]}
+	}
+	return points
+}
+
+// analyticsBuckets перечисляет начала интервалов, пересекающихся с периодом запроса.
+func analyticsBuckets(q model.AnalyticsQuery) ([]time.Time, error) {
+	if !q.From.Before(q.To) {
+		return nil, model.ErrInvalidDateRange
+	}
+	start, err := model.TruncateBucket(q.From, q.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []time.Time
+	for b := start; b.Before(q.To); b = nextBucket(b, q.Bucket) {
+		if len(buckets) == maxAnalyticsBuckets {
+			return nil, model.ErrTooManyBuckets
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case model.BucketWeek:
+		return t.AddDate(0, 0, 7)
+	case model.BucketMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAnalyticsRepository отдаёт заранее подготовленные агрегаты по интервалам.
+type fakeAnalyticsRepository struct {
+	repository.Repository
+	openingSupply int
+	supply        []model.BucketValue
+	active        []model.BucketValue
+	transfers     []model.TransferPoint
+	sales         []model.ItemSalesPoint
+}
+
+func (r *fakeAnalyticsRepository) GetItemSales(ctx context.Context, q model.AnalyticsQuery) ([]model.ItemSalesPoint, error) {
+	return r.sales, nil
+}
+
+func (r *fakeAnalyticsRepository) GetCoinSupplyChanges(ctx context.Context, q model.AnalyticsQuery) (int, []model.BucketValue, error) {
+	return r.openingSupply, r.supply, nil
+}
+
+func (r *fakeAnalyticsRepository) GetActiveUsers(ctx context.Context, q model.AnalyticsQuery) ([]model.BucketValue, error) {
+	return r.active, nil
+}
+
+func (r *fakeAnalyticsRepository) GetTransferVolume(ctx context.Context, q model.AnalyticsQuery) ([]model.TransferPoint, error) {
+	return r.transfers, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestGetAnalytics_Balances(t *testing.T) {
+	repo := &fakeAnalyticsRepository{
+		Repository:    repository.NewMemoryRepository(),
+		openingSupply: 5000,
+		supply: []model.BucketValue{
+			{Bucket: day(2), Value: 1000},
+			{Bucket: day(4), Value: -80},
+		},
+	}
+
+	resp, err := GetAnalytics(context.Background(), repo, AnalyticsSeriesBalances, model.AnalyticsQuery{
+		Bucket: model.BucketDay, From: day(1), To: day(5),
+	})
+	assert.NoError(t, err)
+	points := resp.Points.([]model.BucketValue)
+	assert.Equal(t, []model.BucketValue{
+		{Bucket: day(1), Value: 5000},
+		{Bucket: day(2), Value: 6000},
+		{Bucket: day(3), Value: 6000},
+		{Bucket: day(4), Value: 5920},
+	}, points)
+}
+
+func TestGetAnalytics_TransfersVelocity(t *testing.T) {
+	repo := &fakeAnalyticsRepository{
+		Repository:    repository.NewMemoryRepository(),
+		openingSupply: 2000,
+		transfers: []model.TransferPoint{
+			{Bucket: day(2), Transfers: 3, Volume: 500},
+		},
+	}
+
+	resp, err := GetAnalytics(context.Background(), repo, AnalyticsSeriesTransfers, model.AnalyticsQuery{
+		Bucket: model.BucketDay, From: day(1), To: day(3),
+	})
+	assert.NoError(t, err)
+	points := resp.Points.([]model.TransferPoint)
+	assert.Len(t, points, 2)
+	assert.Equal(t, 0, points[0].Transfers)
+	assert.Equal(t, 3, points[1].Transfers)
+	assert.Equal(t, 500, points[1].Volume)
+	assert.InDelta(t, 0.25, points[1].Velocity, 1e-9)
+}
+
+func TestGetAnalytics_ActiveUsersWeekly(t *testing.T) {
+	repo := &fakeAnalyticsRepository{
+		Repository: repository.NewMemoryRepository(),
+		active:     []model.BucketValue{{Bucket: day(9), Value: 7}},
+	}
+
+	// 2026-03-04 — среда, первая неделя начинается в понедельник 2 марта.
+	resp, err := GetAnalytics(context.Background(), repo, AnalyticsSeriesActiveUsers, model.AnalyticsQuery{
+		Bucket: model.BucketWeek, From: day(4), To: day(20),
+	})
+	assert.NoError(t, err)
+	points := resp.Points.([]model.BucketValue)
+	assert.Equal(t, []model.BucketValue{
+		{Bucket: day(2), Value: 0},
+		{Bucket: day(9), Value: 7},
+		{Bucket: day(16), Value: 0},
+	}, points)
+}
+
+func TestGetAnalytics_Purchases(t *testing.T) {
+	repo := &fakeAnalyticsRepository{
+		Repository: repository.NewMemoryRepository(),
+		sales:      []model.ItemSalesPoint{{Bucket: day(1), Item: "cup", Purchases: 2, Revenue: 40}},
+	}
+
+	resp, err := GetAnalytics(context.Background(), repo, AnalyticsSeriesPurchases, model.AnalyticsQuery{
+		Bucket: model.BucketMonth, From: day(1), To: day(31),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, repo.sales, resp.Points)
+}
+
+func TestGetAnalytics_InvalidParams(t *testing.T) {
+	repo := &fakeAnalyticsRepository{Repository: repository.NewMemoryRepository()}
+
+	_, err := GetAnalytics(context.Background(), repo, "weather", model.AnalyticsQuery{Bucket: model.BucketDay, From: day(1), To: day(2)})
+	assert.EqualError(t, err, "invalid series")
+	_, err = GetAnalytics(context.Background(), repo, AnalyticsSeriesBalances, model.AnalyticsQuery{Bucket: "hour", From: day(1), To: day(2)})
+	assert.EqualError(t, err, "invalid bucket")
+	_, err = GetAnalytics(context.Background(), repo, AnalyticsSeriesBalances, model.AnalyticsQuery{Bucket: model.BucketDay, From: day(2), To: day(1)})
+	assert.EqualError(t, err, "invalid date range")
+	_, err = GetAnalytics(context.Background(), repo, AnalyticsSeriesBalances, model.AnalyticsQuery{
+		Bucket: model.BucketDay, From: day(1), To: day(1).AddDate(10, 0, 0),
+	})
+	assert.EqualError(t, err, "too many buckets")
+}
@@ -1,31 +1,234 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"merch-shop/internal/logging"
 	"merch-shop/internal/model"
 	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func AuthenticateUser(repo repository.Repository, req model.AuthRequest) (*model.User, error) {
-	user, err := repo.GetUserByUsername(req.Username)
+// WelcomeCoins начисляется каждому пользователю при регистрации.
+// Начисление записывается в журнал как транзакция типа grant.
+var WelcomeCoins = 1000
+
+// Режимы регистрации новых пользователей.
+const (
+	// RegistrationOpen — любой неизвестный пользователь регистрируется при первом входе.
+	RegistrationOpen = "open"
+	// RegistrationInvite — регистрация при первом входе только с кодом приглашения.
+	RegistrationInvite = "invite"
+	// RegistrationAdmin — пользователей заводят только администраторы.
+	RegistrationAdmin = "admin"
+)
+
+// RegistrationMode — действующий режим регистрации.
+var RegistrationMode = RegistrationOpen
+
+// LockoutPolicy задаёт блокировку входа после неудачных попыток подряд. После
+// Threshold-й неудачи вход блокируется на BaseDelay, каждая следующая неудача
+// удваивает блокировку, но не дольше MaxDelay. Нулевой Threshold отключает блокировку.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// LoginLockout — действующая политика блокировки входа.
+var LoginLockout = LockoutPolicy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+// Delay возвращает длительность блокировки после failures неудач подряд.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.Threshold; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// LockedError сообщает, что вход заблокирован до Until. Сравнивается через
+// errors.Is с model.ErrAccountLocked.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return model.ErrAccountLocked.Error()
+}
+
+func (e *LockedError) Unwrap() error {
+	return model.ErrAccountLocked
+}
+
+// AuthenticateUser проверяет пароль пользователя или регистрирует нового
+// пользователя при первом входе, если это разрешает RegistrationMode. Каждая
+// попытка записывается в журнал попыток входа вместе с адресом клиента ip. После
+// LoginLockout.Threshold неудач подряд вход под этим именем блокируется, и до
+// снятия блокировки пароль не проверяется.
+func AuthenticateUser(ctx context.Context, repo repository.Repository, req model.AuthRequest, ip string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.AuthenticateUser", attribute.String("username", req.Username))
+	defer tracing.End(span, &err)
+
+	now := time.Now()
+	lockout, err := repo.GetLoginLockout(ctx, req.Username)
 	if err != nil {
-		if err.Error() == "user not found" {
-			newUser := &model.User{
-				Username: req.Username,
-				Password: req.Password,
-				Coins:    1000,
-			}
-			if err := repo.CreateUser(newUser); err != nil {
-				return nil, err
-			}
-			return newUser, nil
+		return nil, err
+	}
+	if lockout.Locked(now) {
+		if err := recordLoginAttempt(ctx, repo, req.Username, ip, model.LoginLocked); err != nil {
+			return nil, err
 		}
+		logging.FromContext(ctx).Warn("login rejected: account locked",
+			"username", req.Username, "ip", ip, "locked_until", *lockout.LockedUntil)
+		return nil, &LockedError{Until: *lockout.LockedUntil}
+	}
+
+	user, err := repo.GetUserByUsername(ctx, req.Username)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return signUp(ctx, repo, req, ip, now)
+	}
+	if err != nil {
 		return nil, err
 	}
 
 	if user.Password != req.Password {
-		return nil, errors.New("invalid credentials")
+		if err := loginFailed(ctx, repo, req.Username, ip, now); err != nil {
+			return nil, err
+		}
+		return nil, model.ErrInvalidCredentials
+	}
+
+	if !user.Active {
+		if err := recordLoginAttempt(ctx, repo, req.Username, ip, model.LoginInactive); err != nil {
+			return nil, err
+		}
+		return nil, model.ErrAccountInactive
+	}
+	if lockout.Failures > 0 {
+		if err := repo.ResetLoginFailures(ctx, req.Username); err != nil {
+			return nil, err
+		}
+	}
+	if err := recordLoginAttempt(ctx, repo, req.Username, ip, model.LoginSuccess); err != nil {
+		return nil, err
 	}
 	return user, nil
 }
+
+// signUp регистрирует неизвестного пользователя при первом входе. Код
+// приглашения, если он передан, должен быть действующим и задаёт роль нового
+// пользователя; он погашается в одной транзакции с созданием пользователя, так
+// что неудачная регистрация не расходует приглашение. Если регистрация закрыта
+// или код недействителен, ответ не отличается от неверного пароля, чтобы по нему
+// нельзя было проверить существование учётной записи.
+func signUp(ctx context.Context, repo repository.Repository, req model.AuthRequest, ip string, now time.Time) (*model.User, error) {
+	if RegistrationMode == RegistrationAdmin || (RegistrationMode == RegistrationInvite && req.InviteCode == "") {
+		if err := loginFailed(ctx, repo, req.Username, ip, now); err != nil {
+			return nil, err
+		}
+		return nil, model.ErrInvalidCredentials
+	}
+
+	var newUser *model.User
+	var inviteID int64
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		role := model.RoleUser
+		if req.InviteCode != "" {
+			invite, err := repo.RedeemInvite(ctx, req.InviteCode, now)
+			if err != nil {
+				return err
+			}
+			role, inviteID = invite.Role, invite.ID
+		}
+		var err error
+		newUser, err = registerUser(ctx, repo, &model.User{Username: req.Username, Password: req.Password, Role: role})
+		return err
+	})
+	if errors.Is(err, model.ErrInvalidInvite) {
+		if err := loginFailed(ctx, repo, req.Username, ip, now); err != nil {
+			return nil, err
+		}
+		logging.FromContext(ctx).Warn("invalid invite", "username", req.Username, "ip", ip)
+		return nil, model.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inviteID != 0 {
+		logging.FromContext(ctx).Info("invite redeemed", "invite_id", inviteID, "username", newUser.Username)
+	}
+	if err := recordLoginAttempt(ctx, repo, req.Username, ip, model.LoginRegistered); err != nil {
+		return nil, err
+	}
+	return newUser, nil
+}
+
+// registerUser создаёт пользователя newUser и начисляет ему WelcomeCoins.
+// Пользователь, начисление и партия монет создаются в одной транзакции. Имя
+// системного счёта магазина считается занятым, даже если счёт ещё не заведён.
+func registerUser(ctx context.Context, repo repository.Repository, newUser *model.User) (*model.User, error) {
+	if newUser.Username == Offboarding.ShopAccount {
+		return nil, model.ErrUsernameTaken
+	}
+	newUser.Coins = WelcomeCoins
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CreateUser(ctx, newUser); err != nil {
+			return err
+		}
+		if WelcomeCoins <= 0 {
+			return nil
+		}
+		tx := &model.Transaction{
+			ToUserID:  newUser.ID,
+			Amount:    WelcomeCoins,
+			Type:      model.TransactionTypeGrant,
+			Reason:    model.WelcomeGrantReason,
+			CreatedAt: time.Now(),
+		}
+		if err := repo.CreateTransaction(ctx, tx); err != nil {
+			return err
+		}
+		return addCoinLot(ctx, repo, newUser.ID, WelcomeCoins, tx.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("user registered",
+		"user_id", newUser.ID, "username", newUser.Username, "role", newUser.Role, "welcome_coins", WelcomeCoins)
+	return newUser, nil
+}
+
+// loginFailed учитывает неудачный вход и при необходимости блокирует вход под
+// именем username.
+func loginFailed(ctx context.Context, repo repository.Repository, username, ip string, now time.Time) error {
+	if err := recordLoginAttempt(ctx, repo, username, ip, model.LoginInvalidCredentials); err != nil {
+		return err
+	}
+	failures, err := repo.RecordLoginFailure(ctx, username)
+	if err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx)
+	logger.Warn("login failed", "username", username, "ip", ip, "failures", failures)
+
+	if delay := LoginLockout.Delay(failures); delay > 0 {
+		until := now.Add(delay)
+		if err := repo.LockLogin(ctx, username, until); err != nil {
+			return err
+		}
+		logger.Warn("account locked", "username", username, "failures", failures, "locked_until", until)
+	}
+	return nil
+}
+
+func recordLoginAttempt(ctx context.Context, repo repository.Repository, username, ip, result string) error {
+	return repo.CreateLoginAttempt(ctx, &model.LoginAttempt{Username: username, IP: ip, Result: result})
+}
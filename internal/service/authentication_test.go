@@ -1,83 +1,81 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
 )
 
-// fakeAuthRepository реализует Repository для тестирования аутентификации.
-type fakeAuthRepository struct {
-	users map[string]*model.User
-}
-
-func newFakeAuthRepository() *fakeAuthRepository {
-	return &fakeAuthRepository{
-		users: make(map[string]*model.User),
+func TestAuthenticateUser_NewUser(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	req := model.AuthRequest{
+		Username: "newuser",
+		Password: "pass123",
 	}
-}
 
-func (r *fakeAuthRepository) GetUserByUsername(username string) (*model.User, error) {
-	user, ok := r.users[username]
-	if !ok {
-		return nil, errors.New("user not found")
-	}
-	return user, nil
-}
+	user, err := AuthenticateUser(context.Background(), repo, req, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "newuser", user.Username)
+	assert.Equal(t, "pass123", user.Password)
+	assert.Equal(t, 1000, user.Coins)
+	assert.NotZero(t, user.ID)
 
-func (r *fakeAuthRepository) CreateUser(user *model.User) error {
-	if _, exists := r.users[user.Username]; exists {
-		return errors.New("user already exists")
+	history, err := repo.GetHistory(context.Background(), model.HistoryFilter{UserID: user.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, model.TransactionTypeGrant, history[0].Type)
+		assert.Equal(t, model.WelcomeGrantReason, history[0].Reason)
+		assert.Equal(t, 1000, history[0].Amount)
 	}
-	user.ID = int64(len(r.users) + 1)
-	r.users[user.Username] = user
-	return nil
 }
 
-func (r *fakeAuthRepository) UpdateUser(user *model.User) error {
-	r.users[user.Username] = user
-	return nil
+func TestAuthenticateUser_ShopAccountName(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	_, err := AuthenticateUser(context.Background(), repo, model.AuthRequest{Username: Offboarding.ShopAccount, Password: "pass123"}, "127.0.0.1")
+	assert.ErrorIs(t, err, model.ErrUsernameTaken)
+	_, err = repo.GetUserByUsername(context.Background(), Offboarding.ShopAccount)
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
 }
 
-func (r *fakeAuthRepository) CreateTransaction(t *model.Transaction) error { return nil }
-func (r *fakeAuthRepository) CreatePurchase(p *model.Purchase) error         { return nil }
-func (r *fakeAuthRepository) GetUserByID(userID int64) (*model.User, error) {
-	for _, user := range r.users {
-		if user.ID == userID {
-			return user, nil
+func TestAuthenticateUser_ConcurrentFirstLogin(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	req := model.AuthRequest{Username: "newuser", Password: "pass123"}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := AuthenticateUser(context.Background(), repo, req, "127.0.0.1")
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			assert.ErrorIs(t, err, model.ErrUsernameTaken)
 		}
 	}
-	return nil, errors.New("user not found")
-}
-func (r *fakeAuthRepository) GetPurchasesByUserID(userID int64) ([]*model.Purchase, error) {
-	return nil, nil
-}
-func (r *fakeAuthRepository) GetTransactionsReceivedByUserID(userID int64) ([]*model.Transaction, error) {
-	return nil, nil
-}
-func (r *fakeAuthRepository) GetTransactionsSentByUserID(userID int64) ([]*model.Transaction, error) {
-	return nil, nil
+	users, err := repo.ListUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
 }
 
-func TestAuthenticateUser_NewUser(t *testing.T) {
-	repo := newFakeAuthRepository()
-	req := model.AuthRequest{
-		Username: "newuser",
-		Password: "pass123",
-	}
+func TestAuthenticateUser_NewUser_ConfiguredWelcomeCoins(t *testing.T) {
+	defer func(coins int) { WelcomeCoins = coins }(WelcomeCoins)
+	WelcomeCoins = 250
 
-	user, err := AuthenticateUser(repo, req)
+	repo := repository.NewMemoryRepository()
+	user, err := AuthenticateUser(context.Background(), repo, model.AuthRequest{Username: "newuser", Password: "pass123"}, "127.0.0.1")
 	assert.NoError(t, err)
-	assert.Equal(t, "newuser", user.Username)
-	assert.Equal(t, "pass123", user.Password)
-	assert.Equal(t, 1000, user.Coins)
-	assert.NotZero(t, user.ID)
+	assert.Equal(t, 250, user.Coins)
+	assert.Equal(t, model.RoleUser, user.Role)
 }
 
 func TestAuthenticateUser_ExistingUser_Success(t *testing.T) {
-	repo := newFakeAuthRepository()
+	repo := repository.NewMemoryRepository()
 	// Создаем пользователя заранее.
 	existing := &model.User{
 		ID:       1,
@@ -85,19 +83,19 @@ func TestAuthenticateUser_ExistingUser_Success(t *testing.T) {
 		Password: "secret",
 		Coins:    1200,
 	}
-	repo.users[existing.Username] = existing
+	assert.NoError(t, repo.CreateUser(context.Background(), existing))
 
 	req := model.AuthRequest{
 		Username: "existing",
 		Password: "secret",
 	}
-	user, err := AuthenticateUser(repo, req)
+	user, err := AuthenticateUser(context.Background(), repo, req, "127.0.0.1")
 	assert.NoError(t, err)
 	assert.Equal(t, existing, user)
 }
 
 func TestAuthenticateUser_InvalidCredentials(t *testing.T) {
-	repo := newFakeAuthRepository()
+	repo := repository.NewMemoryRepository()
 	// Создаем пользователя с паролем "secret".
 	existing := &model.User{
 		ID:       1,
@@ -105,13 +103,165 @@ func TestAuthenticateUser_InvalidCredentials(t *testing.T) {
 		Password: "secret",
 		Coins:    1200,
 	}
-	repo.users[existing.Username] = existing
+	assert.NoError(t, repo.CreateUser(context.Background(), existing))
 
 	req := model.AuthRequest{
 		Username: "existing",
 		Password: "wrongpass",
 	}
-	_, err := AuthenticateUser(repo, req)
-	assert.Error(t, err)
+	_, err := AuthenticateUser(context.Background(), repo, req, "127.0.0.1")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
 	assert.Equal(t, "invalid credentials", err.Error())
 }
+
+func TestAuthenticateUser_RecordsAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+
+	_, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.NoError(t, err)
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "wrong"}, "10.0.0.2")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.NoError(t, err)
+
+	attempts, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Username: "alice"})
+	assert.NoError(t, err)
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, model.LoginSuccess, attempts[0].Result)
+		assert.Equal(t, model.LoginInvalidCredentials, attempts[1].Result)
+		assert.Equal(t, "10.0.0.2", attempts[1].IP)
+		assert.Equal(t, model.LoginRegistered, attempts[2].Result)
+	}
+
+	// Успешный вход сбрасывает счётчик неудач.
+	lockout, err := repo.GetLoginLockout(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Zero(t, lockout.Failures)
+}
+
+func TestAuthenticateUser_LockoutAfterRepeatedFailures(t *testing.T) {
+	defer func(p LockoutPolicy) { LoginLockout = p }(LoginLockout)
+	LoginLockout = LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	assert.NoError(t, repo.CreateUser(ctx, &model.User{Username: "alice", Password: "secret"}))
+	wrong := model.AuthRequest{Username: "alice", Password: "wrong"}
+
+	for i := 0; i < 3; i++ {
+		_, err := AuthenticateUser(ctx, repo, wrong, "10.0.0.1")
+		assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+	}
+
+	// Пока вход заблокирован, верный пароль тоже не принимается.
+	start := time.Now()
+	_, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.ErrorIs(t, err, model.ErrAccountLocked)
+	var locked *LockedError
+	if assert.ErrorAs(t, err, &locked) {
+		assert.WithinDuration(t, start.Add(time.Minute), locked.Until, 5*time.Second)
+	}
+
+	attempts, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Username: "alice", Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, attempts, 1) {
+		assert.Equal(t, model.LoginLocked, attempts[0].Result)
+	}
+
+	lockout, err := UnlockLogin(ctx, repo, "admin", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lockout.Failures)
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	p := LockoutPolicy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	assert.Zero(t, p.Delay(4))
+	assert.Equal(t, time.Minute, p.Delay(5))
+	assert.Equal(t, 2*time.Minute, p.Delay(6))
+	assert.Equal(t, 8*time.Minute, p.Delay(8))
+	assert.Equal(t, 10*time.Minute, p.Delay(9))
+	assert.Equal(t, 10*time.Minute, p.Delay(100))
+	assert.Zero(t, LockoutPolicy{}.Delay(100))
+}
+
+func TestAuthenticateUser_ClosedRegistration(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	ctx := context.Background()
+
+	for _, mode := range []string{RegistrationInvite, RegistrationAdmin} {
+		RegistrationMode = mode
+		repo := repository.NewMemoryRepository()
+
+		_, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: "mallory", Password: "secret"}, "10.0.0.1")
+		assert.ErrorIs(t, err, model.ErrInvalidCredentials, mode)
+		_, err = repo.GetUserByUsername(ctx, "mallory")
+		assert.ErrorIs(t, err, model.ErrUserNotFound, mode)
+
+		attempts, err := repo.ListLoginAttempts(ctx, model.LoginAttemptFilter{Username: "mallory"})
+		assert.NoError(t, err)
+		if assert.Len(t, attempts, 1, mode) {
+			assert.Equal(t, model.LoginInvalidCredentials, attempts[0].Result)
+		}
+
+		// Существующие пользователи входят как обычно.
+		assert.NoError(t, repo.CreateUser(ctx, &model.User{Username: "alice", Password: "secret"}))
+		_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+		assert.NoError(t, err, mode)
+	}
+}
+
+func TestAuthenticateUser_InviteRegistration(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	RegistrationMode = RegistrationInvite
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	invite, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{Role: model.RoleAdmin})
+	assert.NoError(t, err)
+
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret", InviteCode: "bogus"}, "10.0.0.1")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	user, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, user.Role)
+	assert.Equal(t, WelcomeCoins, user.Coins)
+
+	// Одноразовое приглашение исчерпано, но уже зарегистрированный пользователь
+	// входит с тем же кодом в запросе.
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "bob", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestAuthenticateUser_InviteRedeemedWithRegistration(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	RegistrationMode = RegistrationInvite
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	invite, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{})
+	assert.NoError(t, err)
+
+	// Сбой при создании пользователя не расходует приглашение.
+	failing := &failingLotRepository{Repository: repo}
+	_, err = AuthenticateUser(ctx, failing, model.AuthRequest{Username: "alice", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.EqualError(t, err, "disk full")
+
+	stored, err := repo.GetInvite(ctx, invite.Code)
+	assert.NoError(t, err)
+	assert.Zero(t, stored.Uses)
+	_, err = repo.GetUserByUsername(ctx, "alice")
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.NoError(t, err)
+	stored, err = repo.GetInvite(ctx, invite.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stored.Uses)
+}
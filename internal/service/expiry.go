@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+)
+
+var (
+	// CoinLifetimeMonths — срок жизни начисленных монет в месяцах.
+	CoinLifetimeMonths = 12
+	// ExpiringSoonWindow определяет, какие партии попадают в раздел expiringSoon в /api/info.
+	ExpiringSoonWindow = 30 * 24 * time.Hour
+)
+
+// addCoinLot заводит новую партию монет, начисленную в момент grantedAt.
+func addCoinLot(ctx context.Context, repo repository.Repository, userID int64, amount int, grantedAt time.Time) error {
+	return repo.CreateCoinLot(ctx, &model.CoinLot{
+		UserID:    userID,
+		Amount:    amount,
+		Remaining: amount,
+		GrantedAt: grantedAt,
+		ExpiresAt: grantedAt.AddDate(0, CoinLifetimeMonths, 0),
+	})
+}
+
+// consumeCoinLots списывает amount монет из партий пользователя, начиная с тех,
+// что сгорят раньше всех. Возвращает списанные доли партий. Монеты, которые не
+// покрыты партиями (баланс, накопленный до их появления), возвращаются долей без
+// дат и нулевым ID.
+func consumeCoinLots(ctx context.Context, repo repository.Repository, userID int64, amount int) ([]model.CoinLot, error) {
+	lots, err := repo.GetCoinLotsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var consumed []model.CoinLot
+	for _, lot := range lots {
+		if amount == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > amount {
+			take = amount
+		}
+		lot.Remaining -= take
+		if err := repo.UpdateCoinLot(ctx, lot); err != nil {
+			return nil, err
+		}
+		portion := *lot
+		portion.Amount = take
+		portion.Remaining = take
+		consumed = append(consumed, portion)
+		amount -= take
+	}
+	if amount > 0 {
+		consumed = append(consumed, model.CoinLot{UserID: userID, Amount: amount, Remaining: amount})
+	}
+	return consumed, nil
+}
+
+// moveCoinLots передаёт списанные доли партий получателю с сохранением исходных
+// дат, чтобы перевод не продлевал срок жизни монет.
+func moveCoinLots(ctx context.Context, repo repository.Repository, portions []model.CoinLot, toUserID int64, now time.Time) error {
+	for _, portion := range portions {
+		if portion.ID == 0 {
+			if err := addCoinLot(ctx, repo, toUserID, portion.Amount, now); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := repo.CreateCoinLot(ctx, &model.CoinLot{
+			UserID:    toUserID,
+			Amount:    portion.Amount,
+			Remaining: portion.Amount,
+			GrantedAt: portion.GrantedAt,
+			ExpiresAt: portion.ExpiresAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillCoinLots заводит партию для той части баланса, которая не покрыта
+// партиями, например для монет, начисленных до появления срока жизни. Баланс и
+// партии каждого пользователя перечитываются в отдельной транзакции под
+// блокировкой его баланса, поэтому перевод или покупка, прошедшие после чтения
+// списка пользователей, не приводят к партиям сверх баланса.
+func BackfillCoinLots(ctx context.Context, repo repository.Repository, now time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "service.BackfillCoinLots")
+	defer tracing.End(span, &err)
+
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		err := repo.WithTx(ctx, func(repo repository.Repository) error {
+			locked, err := repo.LockUser(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			lots, err := repo.GetCoinLotsByUserID(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			tracked := 0
+			for _, lot := range lots {
+				tracked += lot.Remaining
+			}
+			if locked.Coins <= tracked {
+				return nil
+			}
+			return addCoinLot(ctx, repo, user.ID, locked.Coins-tracked, now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireCoins гасит все партии, срок которых истёк к моменту now, списывает их
+// остаток с баланса и записывает по каждой партии транзакцию типа expiry.
+// Партии каждого пользователя гасятся в отдельной транзакции под блокировкой
+// его баланса; списывается не больше, чем осталось на балансе, поэтому
+// расхождение партий с балансом не уводит его в минус. Прерванный запуск
+// оставляет погашенными партии только тех пользователей, чьи транзакции
+// зафиксированы, остальные догасит следующий запуск.
+func ExpireCoins(ctx context.Context, repo repository.Repository, now time.Time) (_ *model.ExpiryReport, err error) {
+	ctx, span := tracing.Start(ctx, "service.ExpireCoins")
+	defer tracing.End(span, &err)
+
+	lots, err := repo.GetExpiredCoinLots(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []int64
+	seen := make(map[int64]bool)
+	for _, lot := range lots {
+		if !seen[lot.UserID] {
+			seen[lot.UserID] = true
+			userIDs = append(userIDs, lot.UserID)
+		}
+	}
+
+	report := &model.ExpiryReport{}
+	for _, userID := range userIDs {
+		var expiredLots, expiredCoins int
+		err := repo.WithTx(ctx, func(repo repository.Repository) error {
+			expiredLots, expiredCoins = 0, 0
+			user, err := repo.LockUser(ctx, userID)
+			if err != nil {
+				return err
+			}
+			lots, err := repo.GetCoinLotsByUserID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			balance := user.Coins
+			for _, lot := range lots {
+				if lot.ExpiresAt.After(now) {
+					break
+				}
+				amount := lot.Remaining
+				if amount > balance {
+					amount = balance
+				}
+				lot.Remaining = 0
+				if err := repo.UpdateCoinLot(ctx, lot); err != nil {
+					return err
+				}
+				expiredLots++
+				if amount == 0 {
+					continue
+				}
+				if err := repo.DebitCoins(ctx, userID, amount); err != nil {
+					return err
+				}
+				tx := &model.Transaction{
+					ToUserID:  userID,
+					Amount:    amount,
+					Type:      model.TransactionTypeExpiry,
+					Reason:    fmt.Sprintf("lot %d granted %s", lot.ID, lot.GrantedAt.Format("2006-01-02")),
+					CreatedAt: now,
+				}
+				if err := repo.CreateTransaction(ctx, tx); err != nil {
+					return err
+				}
+				balance -= amount
+				expiredCoins += amount
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if expiredLots > 0 {
+			report.ExpiredLots += expiredLots
+			report.ExpiredCoins += expiredCoins
+			report.Users++
+		}
+	}
+	return report, nil
+}
+
+// expiringSoon возвращает партии пользователя, которые сгорят в течение ExpiringSoonWindow.
+func expiringSoon(ctx context.Context, repo repository.Repository, userID int64, now time.Time) ([]model.ExpiringCoins, error) {
+	lots, err := repo.GetCoinLotsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	deadline := now.Add(ExpiringSoonWindow)
+	expiring := []model.ExpiringCoins{}
+	for _, lot := range lots {
+		if lot.ExpiresAt.After(deadline) {
+			break
+		}
+		expiring = append(expiring, model.ExpiringCoins{Amount: lot.Remaining, ExpiresAt: lot.ExpiresAt})
+	}
+	return expiring, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLot(repo *testRepository, userID int64, amount int, expiresAt time.Time) *model.CoinLot {
+	lot := &model.CoinLot{
+		UserID:    userID,
+		Amount:    amount,
+		Remaining: amount,
+		GrantedAt: expiresAt.AddDate(0, -CoinLifetimeMonths, 0),
+		ExpiresAt: expiresAt,
+	}
+	repo.CreateCoinLot(context.Background(), lot)
+	return lot
+}
+
+// lotRemaining возвращает текущий непогашенный остаток партии.
+func lotRemaining(t *testing.T, repo *testRepository, lot *model.CoinLot) int {
+	t.Helper()
+	lots, err := repo.GetCoinLotsByUserID(context.Background(), lot.UserID)
+	assert.NoError(t, err)
+	for _, l := range lots {
+		if l.ID == lot.ID {
+			return l.Remaining
+		}
+	}
+	return 0
+}
+
+func TestTransferCoins_MovesLotsFIFO(t *testing.T) {
+	repo := newTestRepository()
+	sender := repo.createUser(t, "sender", 1000)
+	recipient := repo.createUser(t, "recipient", 0)
+	now := time.Now()
+	late := newLot(repo, sender.ID, 700, now.AddDate(0, 11, 0))
+	early := newLot(repo, sender.ID, 300, now.AddDate(0, 1, 0))
+
+	err := TransferCoins(context.Background(), repo, "sender", "recipient", 400)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, lotRemaining(t, repo, early))
+	assert.Equal(t, 600, lotRemaining(t, repo, late))
+
+	lots, _ := repo.GetCoinLotsByUserID(context.Background(), recipient.ID)
+	assert.Len(t, lots, 2)
+	assert.Equal(t, 300, lots[0].Remaining)
+	assert.Equal(t, early.ExpiresAt, lots[0].ExpiresAt)
+	assert.Equal(t, 100, lots[1].Remaining)
+	assert.Equal(t, late.ExpiresAt, lots[1].ExpiresAt)
+}
+
+func TestTransferCoins_UntrackedBalanceGetsNewLot(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
+	recipient := repo.createUser(t, "recipient", 0)
+
+	err := TransferCoins(context.Background(), repo, "sender", "recipient", 100)
+	assert.NoError(t, err)
+
+	lots, _ := repo.GetCoinLotsByUserID(context.Background(), recipient.ID)
+	assert.Len(t, lots, 1)
+	assert.Equal(t, 100, lots[0].Remaining)
+	assert.True(t, lots[0].ExpiresAt.After(time.Now().AddDate(0, CoinLifetimeMonths-1, 0)))
+}
+
+func TestPurchaseItem_ConsumesOldestLot(t *testing.T) {
+	repo := newTestRepository()
+	buyer := repo.createUser(t, "buyer", 1000)
+	now := time.Now()
+	late := newLot(repo, buyer.ID, 950, now.AddDate(0, 6, 0))
+	early := newLot(repo, buyer.ID, 50, now.AddDate(0, 0, 10))
+
+	err := PurchaseItem(context.Background(), repo, "buyer", "t-shirt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, lotRemaining(t, repo, early))
+	assert.Equal(t, 920, lotRemaining(t, repo, late))
+}
+
+func TestExpireCoins(t *testing.T) {
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 1000)
+	now := time.Now()
+	expired := newLot(repo, alice.ID, 200, now.Add(-time.Hour))
+	active := newLot(repo, alice.ID, 800, now.AddDate(0, 3, 0))
+
+	report, err := ExpireCoins(context.Background(), repo, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ExpiredLots)
+	assert.Equal(t, 200, report.ExpiredCoins)
+	assert.Equal(t, 1, report.Users)
+
+	assert.Equal(t, 800, repo.coins(t, "alice"))
+	assert.Equal(t, 0, lotRemaining(t, repo, expired))
+	assert.Equal(t, 800, lotRemaining(t, repo, active))
+
+	entries := repo.ledger(t, "alice")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, model.TransactionTypeExpiry, entries[0].Type)
+		assert.Equal(t, model.DirectionOut, entries[0].Direction)
+		assert.Equal(t, 200, entries[0].Amount)
+	}
+}
+
+func TestExpireCoins_CappedAtBalance(t *testing.T) {
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 150)
+	now := time.Now()
+	first := newLot(repo, alice.ID, 100, now.Add(-2*time.Hour))
+	second := newLot(repo, alice.ID, 100, now.Add(-time.Hour))
+
+	report, err := ExpireCoins(context.Background(), repo, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.ExpiredLots)
+	assert.Equal(t, 150, report.ExpiredCoins)
+	assert.Equal(t, 1, report.Users)
+
+	assert.Equal(t, 0, repo.coins(t, "alice"))
+	assert.Equal(t, 0, lotRemaining(t, repo, first))
+	assert.Equal(t, 0, lotRemaining(t, repo, second))
+
+	entries := repo.ledger(t, "alice")
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, 50, entries[0].Amount)
+		assert.Equal(t, 100, entries[1].Amount)
+	}
+
+	report, err = ExpireCoins(context.Background(), repo, now)
+	assert.NoError(t, err)
+	assert.Zero(t, report.ExpiredLots)
+}
+
+func TestBackfillCoinLots(t *testing.T) {
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 1000)
+	now := time.Now()
+	newLot(repo, alice.ID, 400, now.AddDate(0, 3, 0))
+
+	err := BackfillCoinLots(context.Background(), repo, now)
+	assert.NoError(t, err)
+
+	lots, _ := repo.GetCoinLotsByUserID(context.Background(), alice.ID)
+	total := 0
+	for _, l := range lots {
+		total += l.Remaining
+	}
+	assert.Equal(t, 1000, total)
+}
+
+// spendAfterListRepository списывает монеты сразу после чтения списка
+// пользователей, как покупка, прошедшая между чтением и записью партии.
+type spendAfterListRepository struct {
+	*testRepository
+	userID int64
+	amount int
+}
+
+func (r *spendAfterListRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
+	users, err := r.testRepository.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return users, r.AddCoins(ctx, r.userID, -r.amount)
+}
+
+func TestBackfillCoinLots_UsesLockedBalance(t *testing.T) {
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 1000)
+
+	err := BackfillCoinLots(context.Background(), &spendAfterListRepository{testRepository: repo, userID: alice.ID, amount: 400}, time.Now())
+	assert.NoError(t, err)
+
+	lots, _ := repo.GetCoinLotsByUserID(context.Background(), alice.ID)
+	total := 0
+	for _, l := range lots {
+		total += l.Remaining
+	}
+	assert.Equal(t, 600, total)
+	assert.Equal(t, 600, repo.coins(t, "alice"))
+}
+
+func TestExpiringSoon(t *testing.T) {
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 1000)
+	now := time.Now()
+	newLot(repo, alice.ID, 100, now.AddDate(0, 0, 7))
+	newLot(repo, alice.ID, 900, now.AddDate(0, 6, 0))
+
+	expiring, err := expiringSoon(context.Background(), repo, alice.ID, now)
+	assert.NoError(t, err)
+	assert.Len(t, expiring, 1)
+	assert.Equal(t, 100, expiring[0].Amount)
+}
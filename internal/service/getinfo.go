@@ -1,67 +1,62 @@
 package service
 
 import (
+	"context"
+	"time"
+
 	"merch-shop/internal/model"
 	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func GetInfo(repo repository.Repository, userID int64) (*model.InfoResponse, error) {
-	user, err := repo.GetUserByID(userID)
+// InfoOptions управляет содержимым ответа /api/info.
+type InfoOptions struct {
+	// HistoryLimit ограничивает число последних записей в каждом из списков
+	// coinHistory.received и coinHistory.sent. Ноль — без ограничения.
+	HistoryLimit int
+	// At восстанавливает состояние на указанный момент по журналу: баланс,
+	// инвентарь и историю без движений, сделанных начиная с At. Раздел
+	// expiringSoon для прошлых моментов не заполняется.
+	At *time.Time
+}
+
+func GetInfo(ctx context.Context, repo repository.Repository, userID int64, opts InfoOptions) (_ *model.InfoResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetInfo", attribute.Int64("user_id", userID))
+	defer tracing.End(span, &err)
+
+	user, err := repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	purchases, err := repo.GetPurchasesByUserID(userID)
+	inventory, err := repo.GetInventoryByUserID(ctx, userID, opts.At)
 	if err != nil {
 		return nil, err
 	}
-	inventoryMap := make(map[string]int)
-	for _, p := range purchases {
-		inventoryMap[p.Item]++
-	}
-	var inventory []model.InventoryItem
-	for item, count := range inventoryMap {
-		inventory = append(inventory, model.InventoryItem{Type: item, Quantity: count})
-	}
 
-	receivedTxs, err := repo.GetTransactionsReceivedByUserID(userID)
+	history, err := repo.GetCoinHistoryByUserID(ctx, userID, opts.HistoryLimit, opts.At)
 	if err != nil {
 		return nil, err
 	}
-	var received []model.CoinHistoryReceived
-	for _, tx := range receivedTxs {
-		if tx.FromUserID != nil {
-			sender, err := repo.GetUserByID(*tx.FromUserID)
-			if err != nil {
-				continue
-			}
-			received = append(received, model.CoinHistoryReceived{
-				FromUser: sender.Username,
-				Amount:   tx.Amount,
-			})
-		}
-	}
 
-	sentTxs, err := repo.GetTransactionsSentByUserID(userID)
+	coins := user.Coins
+	expiring := []model.ExpiringCoins{}
+	if opts.At != nil {
+		coins, err = repo.GetBalanceAt(ctx, userID, *opts.At)
+	} else {
+		expiring, err = expiringSoon(ctx, repo, userID, time.Now())
+	}
 	if err != nil {
 		return nil, err
 	}
-	var sent []model.CoinHistorySent
-	for _, tx := range sentTxs {
-		recipient, err := repo.GetUserByID(tx.ToUserID)
-		if err != nil {
-			continue
-		}
-		sent = append(sent, model.CoinHistorySent{
-			ToUser: recipient.Username,
-			Amount: tx.Amount,
-		})
-	}
 
 	info := &model.InfoResponse{
-		Coins:       user.Coins,
-		Inventory:   inventory,
-		CoinHistory: model.CoinHistory{Received: received, Sent: sent},
+		Coins:        coins,
+		Inventory:    inventory,
+		CoinHistory:  *history,
+		ExpiringSoon: expiring,
 	}
 	return info, nil
 }
@@ -1,143 +1,318 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"merch-shop/internal/config"
+	"merch-shop/internal/database"
 	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
 
 	"github.com/stretchr/testify/assert"
 )
 
-type fakeInfoRepository struct {
-	users       map[int64]*model.User
-	purchases   map[int64][]*model.Purchase
-	receivedTxs map[int64][]*model.Transaction
-	sentTxs     map[int64][]*model.Transaction
+// countingRepository считает обращения к хранилищу, которые делает GetInfo,
+// чтобы тест замечал лишние запросы.
+type countingRepository struct {
+	repository.Repository
+	queries int
 }
 
-func newFakeInfoRepository() *fakeInfoRepository {
-	return &fakeInfoRepository{
-		users:       make(map[int64]*model.User),
-		purchases:   make(map[int64][]*model.Purchase),
-		receivedTxs: make(map[int64][]*model.Transaction),
-		sentTxs:     make(map[int64][]*model.Transaction),
-	}
+func (r *countingRepository) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	r.queries++
+	return r.Repository.GetUserByID(ctx, userID)
 }
 
-func (r *fakeInfoRepository) GetUserByUsername(username string) (*model.User, error) {
-	for _, user := range r.users {
-		if user.Username == username {
-			return user, nil
-		}
-	}
-	return nil, errors.New("user not found")
+func (r *countingRepository) GetInventoryByUserID(ctx context.Context, userID int64, at *time.Time) ([]model.InventoryItem, error) {
+	r.queries++
+	return r.Repository.GetInventoryByUserID(ctx, userID, at)
 }
 
-func (r *fakeInfoRepository) CreateUser(user *model.User) error {
-	user.ID = int64(len(r.users) + 1)
-	r.users[user.ID] = user
-	return nil
+func (r *countingRepository) GetCoinHistoryByUserID(ctx context.Context, userID int64, limit int, at *time.Time) (*model.CoinHistory, error) {
+	r.queries++
+	return r.Repository.GetCoinHistoryByUserID(ctx, userID, limit, at)
 }
 
-func (r *fakeInfoRepository) UpdateUser(user *model.User) error {
-	r.users[user.ID] = user
-	return nil
+func (r *countingRepository) GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error) {
+	r.queries++
+	return r.Repository.GetBalanceAt(ctx, userID, at)
 }
 
-func (r *fakeInfoRepository) CreateTransaction(t *model.Transaction) error {
-	// Для теста не требуется реализация.
-	return nil
+func (r *countingRepository) GetCoinLotsByUserID(ctx context.Context, userID int64) ([]*model.CoinLot, error) {
+	r.queries++
+	return r.Repository.GetCoinLotsByUserID(ctx, userID)
 }
 
-func (r *fakeInfoRepository) CreatePurchase(p *model.Purchase) error {
-	r.purchases[p.UserID] = append(r.purchases[p.UserID], p)
-	return nil
+func TestGetInfo_Success(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+	user := repo.createUser(t, "user1", 1000)
+	repo.createUser(t, "sender", 1000)
+	repo.createUser(t, "recipient", 1000)
+
+	assert.NoError(t, PurchaseItem(ctx, repo, "user1", "t-shirt"))
+	assert.NoError(t, PurchaseItem(ctx, repo, "user1", "t-shirt"))
+	assert.NoError(t, PurchaseItem(ctx, repo, "user1", "cup"))
+	assert.NoError(t, TransferCoins(ctx, repo, "sender", "user1", 50))
+	assert.NoError(t, TransferCoins(ctx, repo, "user1", "recipient", 30))
+
+	info, err := GetInfo(ctx, repo, user.ID, InfoOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 840, info.Coins)
+
+	invMap := make(map[string]int)
+	for _, item := range info.Inventory {
+		invMap[item.Type] = item.Quantity
+	}
+	assert.Equal(t, 2, invMap["t-shirt"])
+	assert.Equal(t, 1, invMap["cup"])
+
+	assert.Len(t, info.CoinHistory.Received, 1)
+	assert.Equal(t, "sender", info.CoinHistory.Received[0].FromUser)
+	assert.Equal(t, 50, info.CoinHistory.Received[0].Amount)
+
+	assert.Len(t, info.CoinHistory.Sent, 1)
+	assert.Equal(t, "recipient", info.CoinHistory.Sent[0].ToUser)
+	assert.Equal(t, 30, info.CoinHistory.Sent[0].Amount)
 }
 
-func (r *fakeInfoRepository) GetUserByID(userID int64) (*model.User, error) {
-	user, exists := r.users[userID]
-	if !exists {
-		return nil, errors.New("user not found")
+func TestGetInfo_HistoryLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+	user := repo.createUser(t, "user1", 1000)
+	repo.createUser(t, "recipient", 1000)
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, TransferCoins(ctx, repo, "user1", "recipient", i))
 	}
-	return user, nil
+
+	info, err := GetInfo(ctx, repo, user.ID, InfoOptions{HistoryLimit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, info.CoinHistory.Sent, 2)
+	assert.Equal(t, 4, info.CoinHistory.Sent[0].Amount)
+	assert.Equal(t, 5, info.CoinHistory.Sent[1].Amount)
 }
 
-func (r *fakeInfoRepository) GetPurchasesByUserID(userID int64) ([]*model.Purchase, error) {
-	return r.purchases[userID], nil
+func TestGetInfo_At(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+	user := repo.createUser(t, "user1", 0)
+	repo.createUser(t, "peer", 1000)
+	_, err := GrantCoins(ctx, repo, "admin", []string{"user1"}, 1000, "welcome")
+	assert.NoError(t, err)
+	assert.NoError(t, PurchaseItem(ctx, repo, "user1", "cup"))
+	assert.NoError(t, TransferCoins(ctx, repo, "user1", "peer", 30))
+
+	at := time.Now()
+	assert.NoError(t, PurchaseItem(ctx, repo, "user1", "t-shirt"))
+	assert.NoError(t, TransferCoins(ctx, repo, "user1", "peer", 70))
+
+	info, err := GetInfo(ctx, repo, user.ID, InfoOptions{At: &at})
+	assert.NoError(t, err)
+	assert.Equal(t, 950, info.Coins)
+	assert.Equal(t, []model.InventoryItem{{Type: "cup", Quantity: 1}}, info.Inventory)
+	assert.Len(t, info.CoinHistory.Sent, 1)
+	assert.Equal(t, 30, info.CoinHistory.Sent[0].Amount)
+	assert.Empty(t, info.ExpiringSoon)
 }
 
-func (r *fakeInfoRepository) GetTransactionsReceivedByUserID(userID int64) ([]*model.Transaction, error) {
-	return r.receivedTxs[userID], nil
+func TestGetInfo_UserNotFound(t *testing.T) {
+	repo := newTestRepository()
+	_, err := GetInfo(context.Background(), repo, 999, InfoOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, "user not found", err.Error())
 }
 
-func (r *fakeInfoRepository) GetTransactionsSentByUserID(userID int64) ([]*model.Transaction, error) {
-	return r.sentTxs[userID], nil
+func TestGetInfo_ConstantQueryCount(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+	user := repo.createUser(t, "user", 1000)
+	for i := 0; i < 1000; i++ {
+		peer := fmt.Sprintf("peer%d", i)
+		repo.createUser(t, peer, 1000)
+		assert.NoError(t, TransferCoins(ctx, repo, peer, "user", 1))
+		assert.NoError(t, TransferCoins(ctx, repo, "user", peer, 1))
+	}
+
+	counting := &countingRepository{Repository: repo}
+	info, err := GetInfo(ctx, counting, user.ID, InfoOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, info.CoinHistory.Received, 1000)
+	assert.Len(t, info.CoinHistory.Sent, 1000)
+	assert.Equal(t, 4, counting.queries)
 }
 
-func TestGetInfo_Success(t *testing.T) {
-	repo := newFakeInfoRepository()
+// benchInfoPeers — число коллег, с каждым из которых у пользователя по одному
+// входящему и исходящему переводу.
+const benchInfoPeers = 200
+
+// BenchmarkGetInfo сравнивает GetInfo, которому хватает фиксированного числа
+// запросов, с прежней реализацией, запрашивавшей имя контрагента отдельно для
+// каждой транзакции. SQLite проверяется всегда, Postgres — если задана
+// TEST_DATABASE_DSN.
+func BenchmarkGetInfo(b *testing.B) {
+	for _, dialect := range []string{database.SQLite, database.Postgres} {
+		b.Run(dialect, func(b *testing.B) {
+			db, repo := newBenchStore(b, dialect)
+			userID := seedBenchInfo(b, repo)
 
-		user := &model.User{
-		ID:       1,
-		Username: "user1",
-		Password: "pass",
-		Coins:    900,
+			b.Run("aggregated", func(b *testing.B) {
+				counting := &countingRepository{Repository: repo}
+				for i := 0; i < b.N; i++ {
+					if _, err := GetInfo(context.Background(), counting, userID, InfoOptions{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(counting.queries)/float64(b.N), "queries/op")
+			})
+			b.Run("per_transaction", func(b *testing.B) {
+				counting := &countingRepository{Repository: repo}
+				for i := 0; i < b.N; i++ {
+					if _, err := getInfoPerTransaction(context.Background(), db, counting, userID); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(counting.queries)/float64(b.N), "queries/op")
+			})
+		})
 	}
-	repo.users[user.ID] = user
+}
 
-	repo.purchases[user.ID] = []*model.Purchase{
-		{ID: 1, UserID: user.ID, Item: "t-shirt", Price: 80, CreatedAt: time.Now()},
-		{ID: 2, UserID: user.ID, Item: "t-shirt", Price: 80, CreatedAt: time.Now()},
-		{ID: 3, UserID: user.ID, Item: "cup", Price: 20, CreatedAt: time.Now()},
+// newBenchStore открывает базу с применёнными миграциями: SQLite во временном
+// каталоге или Postgres из TEST_DATABASE_DSN, очищенную перед запуском.
+func newBenchStore(b *testing.B, dialect string) (*sql.DB, repository.Repository) {
+	b.Helper()
+	var db *sql.DB
+	var err error
+	switch dialect {
+	case database.SQLite:
+		db, err = database.ConnectSQLite(config.SQLiteConfig{Path: filepath.Join(b.TempDir(), "shop.db"), MaxOpenConns: 4})
+	case database.Postgres:
+		dsn := os.Getenv("TEST_DATABASE_DSN")
+		if dsn == "" {
+			b.Skip("TEST_DATABASE_DSN is not set")
+		}
+		db, err = sql.Open("postgres", dsn)
+	}
+	if err != nil {
+		b.Fatal(err)
 	}
+	b.Cleanup(func() { db.Close() })
 
-	sender := &model.User{
-		ID:       2,
-		Username: "sender",
-		Password: "pass",
-		Coins:    1000,
+	migrator, err := database.NewMigrator(db, dialect)
+	if err != nil {
+		b.Fatal(err)
 	}
-	repo.users[sender.ID] = sender
-	repo.receivedTxs[user.ID] = []*model.Transaction{
-		{ID: 1, FromUserID: &sender.ID, ToUserID: user.ID, Amount: 50, Type: "transfer", CreatedAt: time.Now()},
+	if _, err := migrator.Up(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	if dialect == database.Postgres {
+		_, err := db.Exec("TRUNCATE users, transactions, purchases, audit_log, coin_lots, login_attempts, login_lockouts, invites RESTART IDENTITY CASCADE")
+		if err != nil {
+			b.Fatal(err)
+		}
+		return db, repository.NewPostgresRepository(db, repository.DefaultTimeouts)
 	}
+	return db, repository.NewSQLiteRepository(db, repository.DefaultTimeouts)
+}
 
-	recipient := &model.User{
-		ID:       3,
-		Username: "recipient",
-		Password: "pass",
-		Coins:    1100,
+// seedBenchInfo заводит пользователя с benchInfoPeers входящими и исходящими
+// переводами от разных коллег и возвращает его ID.
+func seedBenchInfo(b *testing.B, repo repository.Repository) int64 {
+	b.Helper()
+	ctx := context.Background()
+	user := &model.User{Username: "user", Password: "secret", Coins: 1000}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		b.Fatal(err)
 	}
-	repo.users[recipient.ID] = recipient
-	repo.sentTxs[user.ID] = []*model.Transaction{
-		{ID: 2, FromUserID: &user.ID, ToUserID: recipient.ID, Amount: 30, Type: "transfer", CreatedAt: time.Now()},
+	for i := 0; i < benchInfoPeers; i++ {
+		peer := &model.User{Username: fmt.Sprintf("peer%d", i), Password: "secret", Coins: 1000}
+		if err := repo.CreateUser(ctx, peer); err != nil {
+			b.Fatal(err)
+		}
+		if err := TransferCoins(ctx, repo, peer.Username, user.Username, 1); err != nil {
+			b.Fatal(err)
+		}
+		if err := TransferCoins(ctx, repo, user.Username, peer.Username, 1); err != nil {
+			b.Fatal(err)
+		}
 	}
+	return user.ID
+}
 
-	info, err := GetInfo(repo, user.ID)
-	assert.NoError(t, err)
-	assert.Equal(t, 900, info.Coins)
+// getInfoPerTransaction воспроизводит прежнюю реализацию GetInfo: переводы
+// выбираются без имён контрагентов, и каждое имя запрашивается через
+// GetUserByID. Нужна только для сравнения в бенчмарке.
+func getInfoPerTransaction(ctx context.Context, db *sql.DB, repo *countingRepository, userID int64) (*model.InfoResponse, error) {
+	user, err := repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := repo.GetInventoryByUserID(ctx, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &model.InfoResponse{Coins: user.Coins, Inventory: inventory}
 
-	invMap := make(map[string]int)
-	for _, item := range info.Inventory {
-		invMap[item.Type] = item.Quantity
+	received, err := benchTransfers(ctx, db, repo,
+		"SELECT from_user_id, amount FROM transactions WHERE to_user_id = $1 AND type = 'transfer' ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range received {
+		sender, err := repo.GetUserByID(ctx, t.peerID)
+		if err != nil {
+			return nil, err
+		}
+		info.CoinHistory.Received = append(info.CoinHistory.Received, model.CoinHistoryReceived{FromUser: sender.Username, Amount: t.amount})
 	}
-	assert.Equal(t, 2, invMap["t-shirt"])
-	assert.Equal(t, 1, invMap["cup"])
 
-	assert.Len(t, info.CoinHistory.Received, 1)
-	assert.Equal(t, "sender", info.CoinHistory.Received[0].FromUser)
-	assert.Equal(t, 50, info.CoinHistory.Received[0].Amount)
+	sent, err := benchTransfers(ctx, db, repo,
+		"SELECT to_user_id, amount FROM transactions WHERE from_user_id = $1 AND type = 'transfer' ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range sent {
+		recipient, err := repo.GetUserByID(ctx, t.peerID)
+		if err != nil {
+			return nil, err
+		}
+		info.CoinHistory.Sent = append(info.CoinHistory.Sent, model.CoinHistorySent{ToUser: recipient.Username, Amount: t.amount})
+	}
 
-	assert.Len(t, info.CoinHistory.Sent, 1)
-	assert.Equal(t, "recipient", info.CoinHistory.Sent[0].ToUser)
-	assert.Equal(t, 30, info.CoinHistory.Sent[0].Amount)
+	info.ExpiringSoon, err = expiringSoon(ctx, repo, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
-func TestGetInfo_UserNotFound(t *testing.T) {
-	repo := newFakeInfoRepository()
-	_, err := GetInfo(repo, 999) 
-	assert.Error(t, err)
-	assert.Equal(t, "user not found", err.Error())
+type benchTransfer struct {
+	peerID int64
+	amount int
+}
+
+// benchTransfers выполняет запрос query переводов пользователя userID и
+// учитывает его в счётчике repo.
+func benchTransfers(ctx context.Context, db *sql.DB, repo *countingRepository, query string, userID int64) ([]benchTransfer, error) {
+	repo.queries++
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var transfers []benchTransfer
+	for rows.Next() {
+		var t benchTransfer
+		if err := rows.Scan(&t.peerID, &t.amount); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
 }
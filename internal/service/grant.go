@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GrantCoins начисляет amount монет каждому из перечисленных пользователей.
+// Проверка получателей и все начисления выполняются в одной транзакции, поэтому
+// опечатка в одном имени, отключённый получатель или сбой записи не приводят к
+// частичной выдаче.
+func GrantCoins(ctx context.Context, repo repository.Repository, actor string, usernames []string, amount int, reason string) (_ *model.GrantResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.GrantCoins", attribute.Int("amount", amount))
+	defer tracing.End(span, &err)
+
+	return grant(ctx, repo, actor, amount, reason, func(repo repository.Repository) ([]*model.User, error) {
+		recipients := make([]*model.User, 0, len(usernames))
+		seen := make(map[string]bool, len(usernames))
+		for _, username := range usernames {
+			if seen[username] {
+				continue
+			}
+			seen[username] = true
+			user, err := repo.GetUserByUsername(ctx, username)
+			if err != nil {
+				return nil, err
+			}
+			if !user.Active {
+				return nil, model.ErrRecipientInactive
+			}
+			recipients = append(recipients, user)
+		}
+		return recipients, nil
+	})
+}
+
+// GrantCoinsToAll начисляет amount монет всем активным пользователям.
+func GrantCoinsToAll(ctx context.Context, repo repository.Repository, actor string, amount int, reason string) (_ *model.GrantResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.GrantCoinsToAll", attribute.Int("amount", amount))
+	defer tracing.End(span, &err)
+
+	return grant(ctx, repo, actor, amount, reason, func(repo repository.Repository) ([]*model.User, error) {
+		users, err := repo.ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		active := make([]*model.User, 0, len(users))
+		for _, user := range users {
+			if user.Active {
+				active = append(active, user)
+			}
+		}
+		return active, nil
+	})
+}
+
+// grant начисляет amount монет получателям, которых возвращает recipients, и
+// записывает действие в журнал аудита. Всё выполняется в одной транзакции.
+func grant(ctx context.Context, repo repository.Repository, actor string, amount int, reason string, recipients func(repo repository.Repository) ([]*model.User, error)) (*model.GrantResponse, error) {
+	if amount <= 0 {
+		return nil, model.ErrInvalidAmount
+	}
+	if reason == "" {
+		return nil, model.ErrReasonRequired
+	}
+
+	var result *model.GrantResponse
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		users, err := recipients(repo)
+		if err != nil {
+			return err
+		}
+
+		result = &model.GrantResponse{
+			Amount:         amount,
+			Reason:         reason,
+			TransactionIDs: []int64{},
+		}
+		usernames := make([]string, 0, len(users))
+		for _, user := range users {
+			if err := repo.AddCoins(ctx, user.ID, amount); err != nil {
+				return err
+			}
+			tx := &model.Transaction{
+				ToUserID:  user.ID,
+				Amount:    amount,
+				Type:      model.TransactionTypeGrant,
+				Reason:    reason,
+				CreatedAt: time.Now(),
+			}
+			if err := repo.CreateTransaction(ctx, tx); err != nil {
+				return err
+			}
+			if err := addCoinLot(ctx, repo, user.ID, amount, tx.CreatedAt); err != nil {
+				return err
+			}
+			result.Recipients++
+			result.Total += amount
+			result.TransactionIDs = append(result.TransactionIDs, tx.ID)
+			usernames = append(usernames, user.Username)
+		}
+
+		return audit(ctx, repo, actor, "grant", map[string]interface{}{
+			"recipients":     usernames,
+			"amount":         amount,
+			"reason":         reason,
+			"transactionIds": result.TransactionIDs,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("coins granted",
+		"actor", actor, "recipients", result.Recipients, "amount", amount,
+		"total", result.Total, "reason", reason)
+	return result, nil
+}
+
+// audit записывает действие администратора в журнал аудита.
+func audit(ctx context.Context, repo repository.Repository, actor, action string, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return repo.CreateAuditEntry(ctx, &model.AuditEntry{
+		Actor:     actor,
+		Action:    action,
+		Details:   string(data),
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingLotRepository отказывает в создании партии после failAfter успешных.
+type failingLotRepository struct {
+	repository.Repository
+	failAfter int
+}
+
+func (r *failingLotRepository) WithTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	return r.Repository.WithTx(ctx, func(tx repository.Repository) error {
+		view := &failingLotRepository{Repository: tx, failAfter: r.failAfter}
+		err := fn(view)
+		r.failAfter = view.failAfter
+		return err
+	})
+}
+
+func (r *failingLotRepository) CreateCoinLot(ctx context.Context, l *model.CoinLot) error {
+	if r.failAfter == 0 {
+		return errors.New("disk full")
+	}
+	r.failAfter--
+	return r.Repository.CreateCoinLot(ctx, l)
+}
+
+func TestGrantCoins_Success(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+	repo.createUser(t, "bob", 500)
+
+	result, err := GrantCoins(context.Background(), repo, "admin", []string{"alice", "bob", "alice"}, 100, "Q1 bonus")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Recipients)
+	assert.Equal(t, 200, result.Total)
+	assert.Len(t, result.TransactionIDs, 2)
+
+	assert.Equal(t, 1100, repo.coins(t, "alice"))
+	assert.Equal(t, 600, repo.coins(t, "bob"))
+
+	for _, name := range []string{"alice", "bob"} {
+		entries := repo.ledger(t, name)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, model.TransactionTypeGrant, entries[0].Type)
+			assert.Equal(t, "Q1 bonus", entries[0].Reason)
+			assert.Empty(t, entries[0].Counterparty)
+			assert.Equal(t, 100, entries[0].Amount)
+		}
+	}
+
+	assert.Len(t, repo.audits, 1)
+	assert.Equal(t, "admin", repo.audits[0].Actor)
+	assert.Equal(t, "grant", repo.audits[0].Action)
+	assert.Contains(t, repo.audits[0].Details, "Q1 bonus")
+}
+
+func TestGrantCoins_UnknownRecipient(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+
+	_, err := GrantCoins(context.Background(), repo, "admin", []string{"alice", "nonexistent"}, 100, "bonus")
+	assert.Error(t, err)
+	assert.Equal(t, "user not found", err.Error())
+
+	assert.Equal(t, 1000, repo.coins(t, "alice"))
+	assert.Empty(t, repo.ledger(t, "alice"))
+	assert.Len(t, repo.audits, 0)
+}
+
+func TestGrantCoins_ReasonRequired(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+
+	_, err := GrantCoins(context.Background(), repo, "admin", []string{"alice"}, 100, "")
+	assert.Error(t, err)
+	assert.Equal(t, 1000, repo.coins(t, "alice"))
+}
+
+func TestGrantCoinsToAll(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+	repo.createUser(t, "bob", 500)
+	repo.createUser(t, "carol", 0)
+
+	result, err := GrantCoinsToAll(context.Background(), repo, "admin", 50, "quarterly top-up")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Recipients)
+	assert.Equal(t, 150, result.Total)
+
+	assert.Equal(t, 1050, repo.coins(t, "alice"))
+	assert.Equal(t, 550, repo.coins(t, "bob"))
+	assert.Equal(t, 50, repo.coins(t, "carol"))
+	for _, name := range []string{"alice", "bob", "carol"} {
+		assert.Len(t, repo.ledger(t, name), 1)
+	}
+	assert.Len(t, repo.audits, 1)
+}
+
+func TestGrantCoins_InactiveRecipients(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+	repo.deactivate(t, repo.createUser(t, "leaver", 0))
+
+	_, err := GrantCoins(context.Background(), repo, "admin", []string{"alice", "leaver"}, 100, "bonus")
+	assert.ErrorIs(t, err, model.ErrRecipientInactive)
+	assert.Equal(t, 1000, repo.coins(t, "alice"))
+	assert.Empty(t, repo.ledger(t, "alice"))
+
+	result, err := GrantCoinsToAll(context.Background(), repo, "admin", 50, "quarterly top-up")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Recipients)
+	assert.Equal(t, 1050, repo.coins(t, "alice"))
+	assert.Equal(t, 0, repo.coins(t, "leaver"))
+}
+
+func TestGrantCoins_WriteFailureRollsBack(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 1000)
+	repo.createUser(t, "bob", 500)
+	failing := &failingLotRepository{Repository: repo, failAfter: 1}
+
+	_, err := GrantCoins(context.Background(), failing, "admin", []string{"alice", "bob"}, 100, "bonus")
+	assert.EqualError(t, err, "disk full")
+
+	assert.Equal(t, 1000, repo.coins(t, "alice"))
+	assert.Equal(t, 500, repo.coins(t, "bob"))
+	assert.Empty(t, repo.ledger(t, "alice"))
+	assert.Empty(t, repo.ledger(t, "bob"))
+	assert.Len(t, repo.audits, 0)
+
+	_, err = GrantCoinsToAll(context.Background(), &failingLotRepository{Repository: repo, failAfter: 1}, "admin", 50, "top-up")
+	assert.EqualError(t, err, "disk full")
+	assert.Equal(t, 1000, repo.coins(t, "alice"))
+	assert.Empty(t, repo.ledger(t, "alice"))
+}
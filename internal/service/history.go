@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var historyTypes = map[string]bool{
+	model.TransactionTypeTransfer:   true,
+	model.TransactionTypePurchase:   true,
+	model.TransactionTypeAdjustment: true,
+	model.TransactionTypeGrant:      true,
+	model.TransactionTypeExpiry:     true,
+}
+
+// GetHistory возвращает страницу истории движений пользователя от новых к старым.
+// cursor — значение NextCursor из предыдущей страницы или пустая строка.
+func GetHistory(ctx context.Context, repo repository.Repository, f model.HistoryFilter, cursor string) (_ *model.HistoryResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetHistory", attribute.Int64("user_id", f.UserID))
+	defer tracing.End(span, &err)
+
+	if f.Direction != "" && f.Direction != model.DirectionIn && f.Direction != model.DirectionOut {
+		return nil, model.ErrInvalidDirection
+	}
+	if f.Type != "" && !historyTypes[f.Type] {
+		return nil, model.ErrInvalidType
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, model.ErrInvalidDateRange
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultHistoryLimit
+	}
+	if f.Limit > maxHistoryLimit {
+		f.Limit = maxHistoryLimit
+	}
+	if cursor != "" {
+		beforeID, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.BeforeID = beforeID
+	}
+
+	// Перевод самому себе даёт два движения с одним номером, а курсор — номер
+	// движения, поэтому такая пара не разрывается между страницами: запрашивается
+	// на два движения больше, и вторая половина пары остаётся на этой странице.
+	limit := f.Limit
+	f.Limit += 2
+	entries, err := repo.GetHistory(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &model.HistoryResponse{Entries: []model.LedgerEntry{}}
+	if len(entries) > limit && entries[limit].ID == entries[limit-1].ID {
+		limit++
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		resp.NextCursor = encodeCursor(entries[limit-1].ID)
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, *e)
+	}
+	return resp, nil
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, model.ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, model.ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHistoryRepository хранит записи истории от новых к старым и применяет курсор и лимит.
+type fakeHistoryRepository struct {
+	repository.Repository
+	entries    []*model.LedgerEntry
+	lastFilter model.HistoryFilter
+}
+
+func (r *fakeHistoryRepository) GetHistory(ctx context.Context, f model.HistoryFilter) ([]*model.LedgerEntry, error) {
+	r.lastFilter = f
+	var result []*model.LedgerEntry
+	for _, e := range r.entries {
+		if f.BeforeID > 0 && e.ID >= f.BeforeID {
+			continue
+		}
+		if f.Direction != "" && e.Direction != f.Direction {
+			continue
+		}
+		result = append(result, e)
+		if len(result) == f.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+func newFakeHistoryRepository(n int) *fakeHistoryRepository {
+	repo := &fakeHistoryRepository{Repository: repository.NewMemoryRepository()}
+	for id := n; id >= 1; id-- {
+		direction := model.DirectionIn
+		if id%2 == 0 {
+			direction = model.DirectionOut
+		}
+		repo.entries = append(repo.entries, &model.LedgerEntry{
+			ID:        int64(id),
+			Type:      model.TransactionTypeTransfer,
+			Direction: direction,
+			Amount:    id,
+			CreatedAt: time.Now(),
+		})
+	}
+	return repo
+}
+
+func TestGetHistory_Pagination(t *testing.T) {
+	repo := newFakeHistoryRepository(5)
+
+	page, err := GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 2}, "")
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 2)
+	assert.Equal(t, int64(5), page.Entries[0].ID)
+	assert.Equal(t, int64(4), page.Entries[1].ID)
+	assert.NotEmpty(t, page.NextCursor)
+
+	page, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 2}, page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Entries[0].ID)
+	assert.Equal(t, int64(2), page.Entries[1].ID)
+
+	page, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 2}, page.NextCursor)
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+	assert.Equal(t, int64(1), page.Entries[0].ID)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestGetHistory_SelfTransferOnPageBoundary(t *testing.T) {
+	repo := newFakeHistoryRepository(4)
+	// Перевод самому себе с номером 3 даёт два движения.
+	self := *repo.entries[1]
+	self.Direction = model.DirectionOut
+	repo.entries = append(repo.entries[:2], append([]*model.LedgerEntry{&self}, repo.entries[2:]...)...)
+
+	page, err := GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 2}, "")
+	assert.NoError(t, err)
+	if assert.Len(t, page.Entries, 3) {
+		assert.Equal(t, int64(3), page.Entries[1].ID)
+		assert.Equal(t, int64(3), page.Entries[2].ID)
+	}
+
+	page, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 2}, page.NextCursor)
+	assert.NoError(t, err)
+	if assert.Len(t, page.Entries, 2) {
+		assert.Equal(t, int64(2), page.Entries[0].ID)
+		assert.Equal(t, int64(1), page.Entries[1].ID)
+	}
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestGetHistory_DefaultAndMaxLimit(t *testing.T) {
+	repo := newFakeHistoryRepository(1)
+
+	_, err := GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultHistoryLimit+2, repo.lastFilter.Limit)
+
+	_, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Limit: 10000}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, maxHistoryLimit+2, repo.lastFilter.Limit)
+}
+
+func TestGetHistory_Filters(t *testing.T) {
+	repo := newFakeHistoryRepository(4)
+
+	page, err := GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Direction: model.DirectionIn}, "")
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 2)
+	for _, e := range page.Entries {
+		assert.Equal(t, model.DirectionIn, e.Direction)
+	}
+}
+
+func TestGetHistory_InvalidParams(t *testing.T) {
+	repo := newFakeHistoryRepository(1)
+	from := time.Now()
+	to := from.Add(-time.Hour)
+
+	_, err := GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Direction: "sideways"}, "")
+	assert.EqualError(t, err, "invalid direction")
+	_, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, Type: "gift"}, "")
+	assert.EqualError(t, err, "invalid type")
+	_, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1, From: &from, To: &to}, "")
+	assert.EqualError(t, err, "invalid date range")
+	_, err = GetHistory(context.Background(), repo, model.HistoryFilter{UserID: 1}, "not-a-cursor")
+	assert.EqualError(t, err, "invalid cursor")
+}
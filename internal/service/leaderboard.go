@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LeaderboardSize — сколько участников каждого рейтинга хранится в кэше.
+const LeaderboardSize = 100
+
+var (
+	leaderboardBoards  = []string{model.LeaderboardGivers, model.LeaderboardReceivers, model.LeaderboardSpenders}
+	leaderboardPeriods = []string{model.PeriodWeek, model.PeriodMonth, model.PeriodQuarter, model.PeriodAll}
+)
+
+// periodStart возвращает начало текущей календарной недели, месяца или квартала
+// относительно now. Для периода all возвращает nil.
+func periodStart(period string, now time.Time) (*time.Time, error) {
+	y, m, d := now.Date()
+	var start time.Time
+	switch period {
+	case model.PeriodWeek:
+		offset := (int(now.Weekday()) + 6) % 7 // неделя начинается с понедельника
+		start = time.Date(y, m, d-offset, 0, 0, 0, 0, now.Location())
+	case model.PeriodMonth:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	case model.PeriodQuarter:
+		start = time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, now.Location())
+	case model.PeriodAll:
+		return nil, nil
+	default:
+		return nil, model.ErrInvalidPeriod
+	}
+	return &start, nil
+}
+
+// LeaderboardCache хранит готовые рейтинги, чтобы запросы пользователей не
+// выполняли агрегирующие запросы к базе. Обновляется методом Refresh из фоновой задачи.
+type LeaderboardCache struct {
+	repo repository.Repository
+
+	mu     sync.RWMutex
+	boards map[string]*model.Leaderboard
+}
+
+func NewLeaderboardCache(repo repository.Repository) *LeaderboardCache {
+	return &LeaderboardCache{repo: repo, boards: make(map[string]*model.Leaderboard)}
+}
+
+// Refresh пересчитывает все рейтинги за все периоды. Кэш заменяется целиком
+// только при успехе, так что при ошибке продолжают отдаваться прежние данные.
+func (c *LeaderboardCache) Refresh(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "service.LeaderboardCache.Refresh")
+	defer tracing.End(span, &err)
+
+	now := time.Now()
+	boards := make(map[string]*model.Leaderboard, len(leaderboardBoards)*len(leaderboardPeriods))
+	for _, board := range leaderboardBoards {
+		for _, period := range leaderboardPeriods {
+			since, err := periodStart(period, now)
+			if err != nil {
+				return err
+			}
+			entries, err := c.repo.GetLeaderboard(ctx, board, since, "", LeaderboardSize)
+			if err != nil {
+				return err
+			}
+			if entries == nil {
+				entries = []model.LeaderboardEntry{}
+			}
+			boards[board+"/"+period] = &model.Leaderboard{
+				Board:     board,
+				Period:    period,
+				Since:     since,
+				UpdatedAt: now,
+				Entries:   entries,
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.boards = boards
+	c.mu.Unlock()
+	return nil
+}
+
+// Get возвращает первые limit участников рейтинга из кэша. Рейтинг отдела
+// department (пустая строка — все отделы) строится запросом к базе при первом
+// обращении после Refresh и хранится в кэше до следующего обновления. Пустые
+// рейтинги не кэшируются, чтобы запросы с произвольными названиями отделов не
+// занимали память.
+func (c *LeaderboardCache) Get(ctx context.Context, board, period, department string, limit int) (*model.Leaderboard, error) {
+	key := board + "/" + period
+	c.mu.RLock()
+	lb, ok := c.boards[key]
+	c.mu.RUnlock()
+	if !ok {
+		if _, err := periodStart(period, time.Now()); err != nil {
+			return nil, err
+		}
+		for _, b := range leaderboardBoards {
+			if b == board {
+				return nil, model.ErrLeaderboardNotReady
+			}
+		}
+		return nil, model.ErrInvalidLeaderboard
+	}
+	if department != "" {
+		var err error
+		lb, err = c.department(ctx, key, lb, department)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := *lb
+	if limit > 0 && len(result.Entries) > limit {
+		result.Entries = result.Entries[:limit]
+	}
+	return &result, nil
+}
+
+// department возвращает рейтинг отдела за тот же период, что и общий рейтинг
+// all, хранящийся в кэше под ключом key.
+func (c *LeaderboardCache) department(ctx context.Context, key string, all *model.Leaderboard, department string) (*model.Leaderboard, error) {
+	departmentKey := key + "/" + strings.ToLower(department)
+	c.mu.RLock()
+	lb, ok := c.boards[departmentKey]
+	c.mu.RUnlock()
+	if ok {
+		return lb, nil
+	}
+
+	entries, err := c.repo.GetLeaderboard(ctx, all.Board, all.Since, department, LeaderboardSize)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []model.LeaderboardEntry{}
+	}
+	lb = &model.Leaderboard{
+		Board:      all.Board,
+		Period:     all.Period,
+		Department: department,
+		Since:      all.Since,
+		UpdatedAt:  time.Now(),
+		Entries:    entries,
+	}
+	if len(entries) > 0 {
+		c.mu.Lock()
+		// Если кэш успели обновить, рейтинг посчитан за устаревший период.
+		if c.boards[key] == all {
+			c.boards[departmentKey] = lb
+		}
+		c.mu.Unlock()
+	}
+	return lb, nil
+}
+
+func SetLeaderboardOptOut(ctx context.Context, repo repository.Repository, userID int64, optOut bool) (err error) {
+	ctx, span := tracing.Start(ctx, "service.SetLeaderboardOptOut", attribute.Int64("user_id", userID))
+	defer tracing.End(span, &err)
+
+	return repo.SetLeaderboardOptOut(ctx, userID, optOut)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLeaderboardRepository считает агрегирующие запросы и отдаёт фиксированный рейтинг.
+type fakeLeaderboardRepository struct {
+	repository.Repository
+	calls int
+	err   error
+}
+
+func (r *fakeLeaderboardRepository) GetLeaderboard(ctx context.Context, board string, since *time.Time, department string, limit int) ([]model.LeaderboardEntry, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	if department == "Nobody" {
+		return nil, nil
+	}
+	if department != "" {
+		return []model.LeaderboardEntry{{Rank: 1, Username: department + "-" + board, Total: 50}}, nil
+	}
+	return []model.LeaderboardEntry{
+		{Rank: 1, Username: board + "-1", Total: 300},
+		{Rank: 2, Username: board + "-2", Total: 200},
+		{Rank: 3, Username: board + "-3", Total: 100},
+	}, nil
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2026, 8, 20, 15, 30, 0, 0, time.UTC) // четверг
+
+	week, err := periodStart(model.PeriodWeek, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC), *week)
+
+	month, err := periodStart(model.PeriodMonth, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), *month)
+
+	quarter, err := periodStart(model.PeriodQuarter, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), *quarter)
+
+	all, err := periodStart(model.PeriodAll, now)
+	assert.NoError(t, err)
+	assert.Nil(t, all)
+
+	sunday := time.Date(2026, 8, 23, 10, 0, 0, 0, time.UTC)
+	week, _ = periodStart(model.PeriodWeek, sunday)
+	assert.Equal(t, time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC), *week)
+
+	_, err = periodStart("decade", now)
+	assert.EqualError(t, err, "invalid period")
+}
+
+func TestLeaderboardCache_ServesFromCache(t *testing.T) {
+	repo := &fakeLeaderboardRepository{Repository: repository.NewMemoryRepository()}
+	cache := NewLeaderboardCache(repo)
+
+	_, err := cache.Get(context.Background(), model.LeaderboardGivers, model.PeriodMonth, "", 10)
+	assert.EqualError(t, err, "leaderboard is not ready")
+
+	assert.NoError(t, cache.Refresh(context.Background()))
+	assert.Equal(t, 12, repo.calls)
+
+	lb, err := cache.Get(context.Background(), model.LeaderboardGivers, model.PeriodMonth, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 12, repo.calls)
+	assert.Len(t, lb.Entries, 2)
+	assert.Equal(t, "givers-1", lb.Entries[0].Username)
+	assert.NotNil(t, lb.Since)
+
+	lb, err = cache.Get(context.Background(), model.LeaderboardSpenders, model.PeriodAll, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, lb.Entries, 3)
+	assert.Nil(t, lb.Since)
+}
+
+func TestLeaderboardCache_Department(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeLeaderboardRepository{Repository: repository.NewMemoryRepository()}
+	cache := NewLeaderboardCache(repo)
+	assert.NoError(t, cache.Refresh(ctx))
+	assert.Equal(t, 12, repo.calls)
+
+	lb, err := cache.Get(ctx, model.LeaderboardGivers, model.PeriodMonth, "Design", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 13, repo.calls)
+	assert.Equal(t, "Design", lb.Department)
+	assert.NotNil(t, lb.Since)
+	assert.Equal(t, []model.LeaderboardEntry{{Rank: 1, Username: "Design-givers", Total: 50}}, lb.Entries)
+
+	// Рейтинг отдела берётся из кэша независимо от регистра названия.
+	_, err = cache.Get(ctx, model.LeaderboardGivers, model.PeriodMonth, "design", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 13, repo.calls)
+	all, err := cache.Get(ctx, model.LeaderboardGivers, model.PeriodMonth, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, all.Entries, 3)
+
+	// Пустой рейтинг не кэшируется.
+	for i := 0; i < 2; i++ {
+		lb, err = cache.Get(ctx, model.LeaderboardGivers, model.PeriodMonth, "Nobody", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, lb.Entries)
+	}
+	assert.Equal(t, 15, repo.calls)
+
+	// Обновление кэша сбрасывает рейтинги отделов.
+	assert.NoError(t, cache.Refresh(ctx))
+	_, err = cache.Get(ctx, model.LeaderboardGivers, model.PeriodMonth, "Design", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 28, repo.calls)
+}
+
+func TestLeaderboardCache_KeepsDataOnRefreshError(t *testing.T) {
+	repo := &fakeLeaderboardRepository{Repository: repository.NewMemoryRepository()}
+	cache := NewLeaderboardCache(repo)
+	assert.NoError(t, cache.Refresh(context.Background()))
+
+	repo.err = errors.New("db is down")
+	assert.Error(t, cache.Refresh(context.Background()))
+
+	lb, err := cache.Get(context.Background(), model.LeaderboardReceivers, model.PeriodWeek, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, lb.Entries, 3)
+}
+
+func TestLeaderboardCache_InvalidParams(t *testing.T) {
+	repo := &fakeLeaderboardRepository{Repository: repository.NewMemoryRepository()}
+	cache := NewLeaderboardCache(repo)
+	assert.NoError(t, cache.Refresh(context.Background()))
+
+	_, err := cache.Get(context.Background(), "hoarders", model.PeriodMonth, "", 10)
+	assert.EqualError(t, err, "invalid leaderboard")
+	_, err = cache.Get(context.Background(), model.LeaderboardGivers, "decade", "", 10)
+	assert.EqualError(t, err, "invalid period")
+}
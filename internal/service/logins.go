@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultLoginAttemptsLimit = 100
+	maxLoginAttemptsLimit     = 1000
+	// defaultLoginActivityWindow — период сводки попыток входа по умолчанию.
+	defaultLoginActivityWindow = 24 * time.Hour
+)
+
+// ListLoginAttempts возвращает попытки входа по фильтру f, от новых к старым.
+// Без лимита возвращается 100 попыток, больше 1000 за раз не отдаётся.
+func ListLoginAttempts(ctx context.Context, repo repository.Repository, f model.LoginAttemptFilter) (_ []*model.LoginAttempt, err error) {
+	ctx, span := tracing.Start(ctx, "service.ListLoginAttempts")
+	defer tracing.End(span, &err)
+
+	f.Limit = clampLimit(f.Limit, defaultLoginAttemptsLimit, maxLoginAttemptsLimit)
+	attempts, err := repo.ListLoginAttempts(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if attempts == nil {
+		attempts = []*model.LoginAttempt{}
+	}
+	return attempts, nil
+}
+
+// GetSuspiciousLogins группирует попытки входа по IP или по имени пользователя и
+// возвращает группы, в которых неудачных попыток не меньше q.MinFailures (по
+// умолчанию — порог блокировки), начиная с наиболее подозрительных. Без q.Since
+// учитываются последние 24 часа.
+func GetSuspiciousLogins(ctx context.Context, repo repository.Repository, q model.LoginActivityQuery) (_ []model.LoginActivity, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetSuspiciousLogins", attribute.String("by", q.By))
+	defer tracing.End(span, &err)
+
+	if q.Since.IsZero() {
+		q.Since = time.Now().Add(-defaultLoginActivityWindow)
+	}
+	if q.MinFailures <= 0 {
+		q.MinFailures = max(LoginLockout.Threshold, 1)
+	}
+	q.Limit = clampLimit(q.Limit, defaultLoginAttemptsLimit, maxLoginAttemptsLimit)
+	activity, err := repo.GetLoginActivity(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if activity == nil {
+		activity = []model.LoginActivity{}
+	}
+	return activity, nil
+}
+
+// UnlockLogin сбрасывает счётчик неудачных входов пользователя username и
+// снимает блокировку входа. Действие записывается в журнал аудита от имени actor.
+func UnlockLogin(ctx context.Context, repo repository.Repository, actor, username string) (_ *model.LoginLockout, err error) {
+	ctx, span := tracing.Start(ctx, "service.UnlockLogin")
+	defer tracing.End(span, &err)
+
+	if _, err := repo.GetUserByUsername(ctx, username); err != nil {
+		return nil, err
+	}
+	lockout, err := repo.GetLoginLockout(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.ResetLoginFailures(ctx, username); err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, repo, actor, "unlock_login", map[string]interface{}{
+		"username":    username,
+		"failures":    lockout.Failures,
+		"lockedUntil": lockout.LockedUntil,
+	}); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("login unlocked",
+		"actor", actor, "username", username, "failures", lockout.Failures)
+	return lockout, nil
+}
+
+// clampLimit возвращает def для неположительного limit и не больше maxLimit.
+func clampLimit(limit, def, maxLimit int) int {
+	if limit <= 0 {
+		return def
+	}
+	return min(limit, maxLimit)
+}
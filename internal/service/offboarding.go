@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Способы расчёта с уходящим сотрудником.
+const (
+	// SettlementForfeit — остаток монет переводится на системный счёт магазина.
+	SettlementForfeit = "forfeit"
+	// SettlementDonate — остаток монет переводится коллеге или общему фонду.
+	SettlementDonate = "donate"
+)
+
+// OffboardingPolicy задаёт расчёт по умолчанию: он применяется, когда запрос не
+// указывает способ, и при отключении пользователя через SCIM. Recipient —
+// получатель остатка для SettlementDonate. ShopAccount — имя системного счёта
+// магазина, на который переводится остаток при SettlementForfeit.
+type OffboardingPolicy struct {
+	Settlement  string
+	Recipient   string
+	ShopAccount string
+}
+
+// Offboarding — действующая политика расчёта с уходящими сотрудниками.
+var Offboarding = OffboardingPolicy{Settlement: SettlementForfeit, ShopAccount: "shop"}
+
+// offboardingReason — основание транзакции, которой закрывается баланс.
+const offboardingReason = "offboarding"
+
+// OffboardUser отключает пользователя username и закрывает его баланс способом
+// из req. Отключённый пользователь не может войти, его токены перестают
+// действовать, переводы ему отклоняются. Повторный вызов для отключённого
+// пользователя закрывает остаток, если он появился. Действие записывается в
+// журнал аудита от имени actor.
+func OffboardUser(ctx context.Context, repo repository.Repository, actor, username string, req model.OffboardRequest) (_ *model.OffboardResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.OffboardUser",
+		attribute.String("username", username), attribute.String("settlement", req.Settlement))
+	defer tracing.End(span, &err)
+
+	user, err := repo.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return offboard(ctx, repo, actor, user, req)
+}
+
+// offboard деактивирует user и закрывает его баланс. Отключение, расчёт и записи
+// аудита выполняются в одной транзакции, поэтому ошибка в запросе не оставит
+// пользователя отключённым без расчёта. Списывается баланс из заблокированной
+// строки пользователя, а не прочитанный до транзакции.
+func offboard(ctx context.Context, repo repository.Repository, actor string, user *model.User, req model.OffboardRequest) (*model.OffboardResponse, error) {
+	if req.Settlement == "" {
+		req = model.OffboardRequest{Settlement: Offboarding.Settlement, Recipient: Offboarding.Recipient}
+	}
+	switch req.Settlement {
+	case SettlementForfeit:
+		req.Recipient = ""
+	case SettlementDonate:
+		if req.Recipient == "" {
+			return nil, model.ErrRecipientRequired
+		}
+		if req.Recipient == user.Username {
+			return nil, model.ErrInvalidRecipient
+		}
+	default:
+		return nil, model.ErrInvalidSettlement
+	}
+
+	resp := &model.OffboardResponse{
+		Username:   user.Username,
+		Settlement: req.Settlement,
+		Recipient:  req.Recipient,
+	}
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		var recipient *model.User
+		var err error
+		if req.Settlement == SettlementDonate {
+			recipient, err = repo.GetUserByUsername(ctx, req.Recipient)
+			if err != nil {
+				return err
+			}
+			if !recipient.Active {
+				return model.ErrRecipientInactive
+			}
+		} else {
+			recipient, err = shopAccount(ctx, repo)
+			if err != nil {
+				return err
+			}
+			if recipient.ID == user.ID {
+				return model.ErrInvalidRecipient
+			}
+		}
+
+		locked, err := lockPair(ctx, repo, user.ID, recipient.ID)
+		if err != nil {
+			return err
+		}
+		if locked.Active {
+			updated := *locked
+			updated.Active = false
+			if err := updateProfile(ctx, repo, actor, locked, &updated); err != nil {
+				return err
+			}
+			locked = &updated
+		}
+
+		resp.Amount = locked.Coins
+		if locked.Coins > 0 {
+			tx, err := settleBalance(ctx, repo, locked, recipient, time.Now())
+			if err != nil {
+				return err
+			}
+			resp.TransactionID = &tx.ID
+		}
+
+		return audit(ctx, repo, actor, "offboard_user", map[string]interface{}{
+			"userId":        user.ID,
+			"username":      user.Username,
+			"settlement":    resp.Settlement,
+			"recipient":     resp.Recipient,
+			"amount":        resp.Amount,
+			"transactionId": resp.TransactionID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Settlement == SettlementDonate {
+		metrics.CoinsTransferred.Add(float64(resp.Amount))
+	}
+	logging.FromContext(ctx).Info("user offboarded",
+		"actor", actor, "username", user.Username, "settlement", resp.Settlement,
+		"recipient", resp.Recipient, "amount", resp.Amount)
+	return resp, nil
+}
+
+// EnsureShopAccount заводит отключённый системный счёт магазина
+// Offboarding.ShopAccount, если его ещё нет: войти под ним нельзя, а переводы
+// ему от пользователей отклоняются. Сервер вызывает её при запуске, чтобы имя
+// счёта не занял обычный пользователь. Повторный вызов ничего не
+// меняет; если счёт одновременно завёл другой экземпляр, используется он.
+func EnsureShopAccount(ctx context.Context, repo repository.Repository) (err error) {
+	ctx, span := tracing.Start(ctx, "service.EnsureShopAccount")
+	defer tracing.End(span, &err)
+
+	_, err = repo.GetUserByUsername(ctx, Offboarding.ShopAccount)
+	if err == nil {
+		_, err = shopAccount(ctx, repo)
+		return err
+	}
+	if !errors.Is(err, model.ErrUserNotFound) {
+		return err
+	}
+
+	shop := &model.User{Username: Offboarding.ShopAccount, Role: model.RoleUser}
+	err = repo.WithTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CreateUser(ctx, shop); err != nil {
+			return err
+		}
+		shop.Active = false
+		return repo.UpdateUserProfile(ctx, shop)
+	})
+	if errors.Is(err, model.ErrUsernameTaken) {
+		_, err = shopAccount(ctx, repo)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("shop account created", "user_id", shop.ID, "username", shop.Username)
+	return nil
+}
+
+// shopAccount возвращает системный счёт магазина Offboarding.ShopAccount,
+// заведённый EnsureShopAccount. Счёт должен быть отключён, иначе под его именем
+// работает обычный пользователь и переводить ему остатки нельзя.
+func shopAccount(ctx context.Context, repo repository.Repository) (*model.User, error) {
+	shop, err := repo.GetUserByUsername(ctx, Offboarding.ShopAccount)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return nil, fmt.Errorf("shop account %q does not exist", Offboarding.ShopAccount)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shop.Active {
+		return nil, fmt.Errorf("shop account %q is an active user", shop.Username)
+	}
+	return shop, nil
+}
+
+// lockPair блокирует строки пользователей userID и otherID в порядке возрастания
+// ID, как moveCoins, и возвращает заблокированную строку userID.
+func lockPair(ctx context.Context, repo repository.Repository, userID, otherID int64) (*model.User, error) {
+	if otherID < userID {
+		if _, err := repo.LockUser(ctx, otherID); err != nil {
+			return nil, err
+		}
+	}
+	user, err := repo.LockUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if otherID > userID {
+		if _, err := repo.LockUser(ctx, otherID); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// settleBalance переводит весь баланс user получателю recipient вместе с датами
+// сгорания партий. Вызывается в транзакции, где строка user заблокирована.
+func settleBalance(ctx context.Context, repo repository.Repository, user, recipient *model.User, now time.Time) (*model.Transaction, error) {
+	amount := user.Coins
+	if err := moveCoins(ctx, repo, user.ID, recipient.ID, amount); err != nil {
+		return nil, err
+	}
+	portions, err := consumeCoinLots(ctx, repo, user.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveCoinLots(ctx, repo, portions, recipient.ID, now); err != nil {
+		return nil, err
+	}
+
+	tx := &model.Transaction{
+		FromUserID: &user.ID,
+		ToUserID:   recipient.ID,
+		Amount:     amount,
+		Type:       model.TransactionTypeTransfer,
+		Reason:     offboardingReason,
+		CreatedAt:  now,
+	}
+	if err := repo.CreateTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	user.Coins = 0
+	return tx, nil
+}
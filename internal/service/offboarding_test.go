@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffboardUser_Forfeit(t *testing.T) {
+	repo := newTestRepository()
+	assert.NoError(t, EnsureShopAccount(context.Background(), repo))
+	alice := repo.createUser(t, "alice", 300)
+	lot := newLot(repo, alice.ID, 300, time.Now().AddDate(0, CoinLifetimeMonths, 0))
+
+	resp, err := OffboardUser(context.Background(), repo, "admin", "alice", model.OffboardRequest{Settlement: SettlementForfeit})
+	assert.NoError(t, err)
+	assert.Equal(t, SettlementForfeit, resp.Settlement)
+	assert.Equal(t, 300, resp.Amount)
+	assert.Empty(t, resp.Recipient)
+
+	alice, err = repo.GetUserByUsername(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.False(t, alice.Active)
+	assert.Equal(t, 0, alice.Coins)
+	assert.Equal(t, 0, lotRemaining(t, repo, lot))
+
+	// Остаток зачислен на отключённый счёт магазина и выбыл из обращения.
+	shop, err := repo.GetUserByUsername(context.Background(), "shop")
+	assert.NoError(t, err)
+	assert.False(t, shop.Active)
+	assert.Equal(t, 300, shop.Coins)
+	circulation, err := repo.GetCoinsInCirculation(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, circulation)
+
+	entries := repo.ledger(t, "alice")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, *resp.TransactionID, entries[0].ID)
+		assert.Equal(t, model.TransactionTypeTransfer, entries[0].Type)
+		assert.Equal(t, model.DirectionOut, entries[0].Direction)
+		assert.Equal(t, 300, entries[0].Amount)
+		assert.Equal(t, "offboarding", entries[0].Reason)
+		assert.Equal(t, "shop", entries[0].Counterparty)
+	}
+	if entries := repo.ledger(t, "shop"); assert.Len(t, entries, 1) {
+		assert.Equal(t, model.DirectionIn, entries[0].Direction)
+		assert.Equal(t, "alice", entries[0].Counterparty)
+	}
+
+	if assert.Len(t, repo.audits, 2) {
+		assert.Equal(t, "deactivate_user", repo.audits[0].Action)
+		assert.Equal(t, "offboard_user", repo.audits[1].Action)
+		assert.Equal(t, "admin", repo.audits[1].Actor)
+		assert.Contains(t, repo.audits[1].Details, `"settlement":"forfeit"`)
+	}
+
+	// Повторный вызов не создаёт пустых транзакций.
+	resp, err = OffboardUser(context.Background(), repo, "admin", "alice", model.OffboardRequest{Settlement: SettlementForfeit})
+	assert.NoError(t, err)
+	assert.Zero(t, resp.Amount)
+	assert.Nil(t, resp.TransactionID)
+	assert.Len(t, repo.ledger(t, "alice"), 1)
+}
+
+func TestEnsureShopAccount(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+
+	assert.NoError(t, EnsureShopAccount(ctx, repo))
+	shop, err := repo.GetUserByUsername(ctx, "shop")
+	assert.NoError(t, err)
+	assert.False(t, shop.Active)
+
+	// Повторный запуск использует уже заведённый счёт.
+	assert.NoError(t, EnsureShopAccount(ctx, repo))
+	users, err := repo.ListUsers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestOffboardUser_SettlesLockedBalance(t *testing.T) {
+	repo := newTestRepository()
+	assert.NoError(t, EnsureShopAccount(context.Background(), repo))
+	alice := repo.createUser(t, "alice", 300)
+
+	// Баланс изменился после того, как пользователь был прочитан: списывается
+	// актуальный остаток.
+	assert.NoError(t, repo.AddCoins(context.Background(), alice.ID, 200))
+	resp, err := offboard(context.Background(), repo, "admin", alice, model.OffboardRequest{Settlement: SettlementForfeit})
+	assert.NoError(t, err)
+	assert.Equal(t, 500, resp.Amount)
+	assert.Zero(t, repo.coins(t, "alice"))
+	assert.Equal(t, 500, repo.coins(t, "shop"))
+}
+
+func TestOffboardUser_ActiveShopAccount(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 300)
+	repo.createUser(t, "shop", 0)
+
+	_, err := OffboardUser(context.Background(), repo, "admin", "alice", model.OffboardRequest{Settlement: SettlementForfeit})
+	assert.Error(t, err)
+
+	alice, err := repo.GetUserByUsername(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.True(t, alice.Active)
+	assert.Equal(t, 300, alice.Coins)
+	assert.Empty(t, repo.audits)
+}
+
+func TestOffboardUser_Donate(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	for _, name := range []string{"alice", "pool"} {
+		_, err := ProvisionUser(ctx, repo, "admin", &model.User{Username: name, Password: "secret"})
+		assert.NoError(t, err)
+	}
+	before, err := repo.GetCoinsInCirculation(ctx)
+	assert.NoError(t, err)
+
+	resp, err := OffboardUser(ctx, repo, "admin", "alice", model.OffboardRequest{Settlement: SettlementDonate, Recipient: "pool"})
+	assert.NoError(t, err)
+	assert.Equal(t, WelcomeCoins, resp.Amount)
+	assert.Equal(t, "pool", resp.Recipient)
+	assert.NotNil(t, resp.TransactionID)
+
+	alice, err := repo.GetUserByUsername(ctx, "alice")
+	assert.NoError(t, err)
+	assert.False(t, alice.Active)
+	assert.Zero(t, alice.Coins)
+	pool, err := repo.GetUserByUsername(ctx, "pool")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*WelcomeCoins, pool.Coins)
+
+	lots, err := repo.GetCoinLotsByUserID(ctx, pool.ID)
+	assert.NoError(t, err)
+	remaining := 0
+	for _, lot := range lots {
+		remaining += lot.Remaining
+	}
+	assert.Equal(t, 2*WelcomeCoins, remaining)
+
+	after, err := repo.GetCoinsInCirculation(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// Переводы отключённому пользователю отклоняются.
+	err = TransferCoins(ctx, repo, "pool", "alice", 10)
+	assert.ErrorIs(t, err, model.ErrRecipientInactive)
+}
+
+func TestOffboardUser_Validation(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	assert.NoError(t, EnsureShopAccount(ctx, repo))
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := ProvisionUser(ctx, repo, "admin", &model.User{Username: name, Password: "secret"})
+		assert.NoError(t, err)
+	}
+	_, err := OffboardUser(ctx, repo, "admin", "carol", model.OffboardRequest{Settlement: SettlementForfeit})
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		req model.OffboardRequest
+		err error
+	}{
+		{model.OffboardRequest{Settlement: "burn"}, model.ErrInvalidSettlement},
+		{model.OffboardRequest{Settlement: SettlementDonate}, model.ErrRecipientRequired},
+		{model.OffboardRequest{Settlement: SettlementDonate, Recipient: "alice"}, model.ErrInvalidRecipient},
+		{model.OffboardRequest{Settlement: SettlementDonate, Recipient: "carol"}, model.ErrRecipientInactive},
+		{model.OffboardRequest{Settlement: SettlementDonate, Recipient: "dave"}, model.ErrUserNotFound},
+	} {
+		_, err := OffboardUser(ctx, repo, "admin", "alice", tt.req)
+		assert.ErrorIs(t, err, tt.err, tt.req)
+	}
+
+	alice, err := repo.GetUserByUsername(ctx, "alice")
+	assert.NoError(t, err)
+	assert.True(t, alice.Active)
+	assert.Equal(t, WelcomeCoins, alice.Coins)
+
+	_, err = OffboardUser(ctx, repo, "admin", "dave", model.OffboardRequest{})
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+}
+
+func TestOffboardUser_DefaultPolicy(t *testing.T) {
+	defer func(p OffboardingPolicy) { Offboarding = p }(Offboarding)
+	Offboarding = OffboardingPolicy{Settlement: SettlementDonate, Recipient: "pool"}
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	for _, name := range []string{"alice", "bob", "pool"} {
+		_, err := ProvisionUser(ctx, repo, "admin", &model.User{Username: name, Password: "secret"})
+		assert.NoError(t, err)
+	}
+
+	resp, err := OffboardUser(ctx, repo, "admin", "alice", model.OffboardRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, SettlementDonate, resp.Settlement)
+	assert.Equal(t, "pool", resp.Recipient)
+
+	// Отключение через SCIM закрывает баланс по той же политике.
+	bob, err := repo.GetUserByUsername(ctx, "bob")
+	assert.NoError(t, err)
+	assert.NoError(t, DeactivateSCIMUser(ctx, repo, strconv.FormatInt(bob.ID, 10)))
+	bob, err = repo.GetUserByID(ctx, bob.ID)
+	assert.NoError(t, err)
+	assert.False(t, bob.Active)
+	assert.Zero(t, bob.Coins)
+
+	pool, err := repo.GetUserByUsername(ctx, "pool")
+	assert.NoError(t, err)
+	assert.Equal(t, 3*WelcomeCoins, pool.Coins)
+}
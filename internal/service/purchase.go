@@ -1,11 +1,17 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
 	"merch-shop/internal/model"
 	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var merchCatalog = map[string]int{
@@ -21,41 +27,83 @@ var merchCatalog = map[string]int{
 	"pink-hoody": 500,
 }
 
-func PurchaseItem(repo repository.Repository, username, item string) error {
-	price, exists := merchCatalog[item]
-	if !exists {
-		return errors.New("item not found")
-	}
+// PurchaseItem списывает стоимость товара item с баланса пользователя и
+// записывает покупку. Неудачные попытки учитываются в метрике по коду ошибки.
+func PurchaseItem(ctx context.Context, repo repository.Repository, username, item string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.PurchaseItem", attribute.String("item", item))
+	defer tracing.End(span, &err)
 
-	user, err := repo.GetUserByUsername(username)
+	err = purchaseItem(ctx, repo, username, item)
 	if err != nil {
-		return err
-	}
-	if user.Coins < price {
-		return errors.New("insufficient coins")
+		metrics.PurchaseFailures.WithLabelValues(failureReason(err)).Inc()
 	}
+	return err
+}
 
-	user.Coins -= price
-	if err := repo.UpdateUser(user); err != nil {
-		return err
+// purchaseItem списывает стоимость, погашает партии и записывает покупку в
+// одной транзакции.
+func purchaseItem(ctx context.Context, repo repository.Repository, username, item string) error {
+	price, exists := merchCatalog[item]
+	if !exists {
+		return model.ErrItemNotFound
 	}
 
+	var user *model.User
 	purchase := &model.Purchase{
-		UserID:    user.ID,
-		Item:      item,
-		Price:     price,
-		CreatedAt: time.Now(),
+		Item:  item,
+		Price: price,
 	}
-	if err := repo.CreatePurchase(purchase); err != nil {
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		var err error
+		user, err = repo.GetUserByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		if err := repo.DebitCoins(ctx, user.ID, price); err != nil {
+			return err
+		}
+		if _, err := consumeCoinLots(ctx, repo, user.ID, price); err != nil {
+			return err
+		}
+
+		purchase.UserID = user.ID
+		purchase.CreatedAt = time.Now()
+		if err := repo.CreatePurchase(ctx, purchase); err != nil {
+			return err
+		}
+
+		tx := &model.Transaction{
+			FromUserID: nil,
+			ToUserID:   user.ID,
+			Amount:     price,
+			Type:       "purchase",
+			Reason:     item,
+			CreatedAt:  time.Now(),
+		}
+		return repo.CreateTransaction(ctx, tx)
+	})
+	if err != nil {
 		return err
 	}
 
-	tx := &model.Transaction{
-		FromUserID: nil, 
-		ToUserID:   user.ID,
-		Amount:     price,
-		Type:       "purchase",
-		CreatedAt:  time.Now(),
+	metrics.Purchases.WithLabelValues(item).Inc()
+	logging.FromContext(ctx).Info("item purchased",
+		"item", item, "price", price, "balance", user.Coins-price, "purchase_id", purchase.ID)
+	return nil
+}
+
+// failureReason возвращает метку причины ошибки для метрик: код доменной
+// ошибки, timeout, canceled или internal_error.
+func failureReason(err error) string {
+	var domainErr *model.Error
+	switch {
+	case errors.As(err, &domainErr):
+		return domainErr.Code
+	case repository.IsTimeout(err):
+		return "timeout"
+	case repository.IsCanceled(err):
+		return "canceled"
+	default:
+		return "internal_error"
 	}
-	return repo.CreateTransaction(tx)
 }
@@ -1,55 +1,74 @@
 package service
 
 import (
+	"context"
 	"testing"
 
+	"merch-shop/internal/metrics"
 	"merch-shop/internal/model"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestPurchaseItem_Success(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["buyer"] = &model.User{ID: 1, Username: "buyer", Password: "pass", Coins: 1000}
+	repo := newTestRepository()
+	buyer := repo.createUser(t, "buyer", 1000)
 
-	err := PurchaseItem(repo, "buyer", "t-shirt")
+	err := PurchaseItem(context.Background(), repo, "buyer", "t-shirt")
 	assert.NoError(t, err, "purchase should succeed")
 
-	buyer, _ := repo.GetUserByUsername("buyer")
-	assert.Equal(t, 920, buyer.Coins, "Buyer balance should be reduced by 80")
+	assert.Equal(t, 920, repo.coins(t, "buyer"), "Buyer balance should be reduced by 80")
 
-	assert.Len(t, repo.purchases, 1)
-	purchase := repo.purchases[0]
-	assert.Equal(t, "t-shirt", purchase.Item)
-	assert.Equal(t, 80, purchase.Price)
+	inventory, err := repo.GetInventoryByUserID(context.Background(), buyer.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.InventoryItem{{Type: "t-shirt", Quantity: 1}}, inventory)
 
-	assert.Len(t, repo.transactions, 1)
-	tx := repo.transactions[0]
-	assert.Equal(t, "purchase", tx.Type)
-	assert.Equal(t, 80, tx.Amount)
+	entries := repo.ledger(t, "buyer")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "purchase", entries[0].Type)
+		assert.Equal(t, 80, entries[0].Amount)
+	}
 }
 
-
 func TestPurchaseItem_InsufficientCoins(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["buyer"] = &model.User{ID: 1, Username: "buyer", Password: "pass", Coins: 50}
+	repo := newTestRepository()
+	buyer := repo.createUser(t, "buyer", 50)
 
-	err := PurchaseItem(repo, "buyer", "t-shirt")
-	assert.Error(t, err)
+	err := PurchaseItem(context.Background(), repo, "buyer", "t-shirt")
+	assert.ErrorIs(t, err, model.ErrInsufficientCoins)
 	assert.Equal(t, "insufficient coins", err.Error())
 
-	buyer, _ := repo.GetUserByUsername("buyer")
-	assert.Equal(t, 50, buyer.Coins)
+	assert.Equal(t, 50, repo.coins(t, "buyer"))
 
-	assert.Len(t, repo.purchases, 0)
-	assert.Len(t, repo.transactions, 0)
+	inventory, err := repo.GetInventoryByUserID(context.Background(), buyer.ID, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, inventory)
+	assert.Empty(t, repo.ledger(t, "buyer"))
 }
 
 func TestPurchaseItem_ItemNotFound(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["buyer"] = &model.User{ID: 1, Username: "buyer", Password: "pass", Coins: 1000}
+	repo := newTestRepository()
+	repo.createUser(t, "buyer", 1000)
 
-	err := PurchaseItem(repo, "buyer", "nonexistent")
-	assert.Error(t, err)
+	err := PurchaseItem(context.Background(), repo, "buyer", "nonexistent")
+	assert.ErrorIs(t, err, model.ErrItemNotFound)
 	assert.Equal(t, "item not found", err.Error())
 }
+
+func TestPurchaseItem_Metrics(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "buyer", 30)
+
+	cups := testutil.ToFloat64(metrics.Purchases.WithLabelValues("cup"))
+	noCoins := testutil.ToFloat64(metrics.PurchaseFailures.WithLabelValues("insufficient_coins"))
+	noItem := testutil.ToFloat64(metrics.PurchaseFailures.WithLabelValues("item_not_found"))
+
+	assert.NoError(t, PurchaseItem(context.Background(), repo, "buyer", "cup"))
+	assert.Error(t, PurchaseItem(context.Background(), repo, "buyer", "cup"))
+	assert.Error(t, PurchaseItem(context.Background(), repo, "buyer", "yacht"))
+
+	assert.Equal(t, cups+1, testutil.ToFloat64(metrics.Purchases.WithLabelValues("cup")))
+	assert.Equal(t, noCoins+1, testutil.ToFloat64(metrics.PurchaseFailures.WithLabelValues("insufficient_coins")))
+	assert.Equal(t, noItem+1, testutil.ToFloat64(metrics.PurchaseFailures.WithLabelValues("item_not_found")))
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Reconcile пересчитывает ожидаемый баланс каждого пользователя по таблицам
+// transactions и purchases и сравнивает его с users.coins. При fix = true на
+// каждое расхождение записывается корректирующая транзакция типа adjustment,
+// после которой журнал снова сходится с балансом.
+func Reconcile(ctx context.Context, repo repository.Repository, fix bool) (_ *model.ReconcileReport, err error) {
+	ctx, span := tracing.Start(ctx, "service.Reconcile", attribute.Bool("fix", fix))
+	defer tracing.End(span, &err)
+
+	summaries, err := repo.ListLedgerSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ReconcileReport{
+		CheckedUsers:  len(summaries),
+		Fixed:         fix,
+		Discrepancies: []model.BalanceDiscrepancy{},
+	}
+	for _, s := range summaries {
+		expected := s.Granted + s.Received - s.Sent - s.Spent - s.Expired + s.Adjusted
+		if expected == s.Coins {
+			continue
+		}
+
+		d := model.BalanceDiscrepancy{
+			UserID:   s.UserID,
+			Username: s.Username,
+			Actual:   s.Coins,
+			Expected: expected,
+			Drift:    s.Coins - expected,
+			Granted:  s.Granted,
+			Received: s.Received,
+			Sent:     s.Sent,
+			Spent:    s.Spent,
+			Expired:  s.Expired,
+			Adjusted: s.Adjusted,
+		}
+		if fix {
+			id, err := adjustBalance(ctx, repo, s.UserID, d.Drift)
+			if err != nil {
+				return nil, err
+			}
+			d.AdjustmentID = &id
+			logging.FromContext(ctx).Warn("ledger adjusted",
+				"user_id", s.UserID, "username", s.Username, "drift", d.Drift, "transaction_id", id)
+		}
+		report.TotalDrift += d.Drift
+		if d.Drift < 0 {
+			report.AbsoluteDrift -= d.Drift
+		} else {
+			report.AbsoluteDrift += d.Drift
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	return report, nil
+}
+
+// adjustBalance записывает корректировку на drift монет. Отрицательная
+// корректировка означает, что монет на балансе меньше, чем по журналу; на
+// столько же гасятся партии, иначе они покрывали бы несуществующие монеты и
+// сгорали бы сверх баланса.
+func adjustBalance(ctx context.Context, repo repository.Repository, userID int64, drift int) (int64, error) {
+	tx := &model.Transaction{
+		FromUserID: nil,
+		ToUserID:   userID,
+		Amount:     drift,
+		Type:       model.TransactionTypeAdjustment,
+		CreatedAt:  time.Now(),
+	}
+	err := repo.WithTx(ctx, func(repo repository.Repository) error {
+		if drift < 0 {
+			if _, err := repo.LockUser(ctx, userID); err != nil {
+				return err
+			}
+			if _, err := consumeCoinLots(ctx, repo, userID, -drift); err != nil {
+				return err
+			}
+		}
+		return repo.CreateTransaction(ctx, tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tx.ID, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReconcileRepository проводит по журналу начисления, перевод и покупку:
+// у alice 820 монет, у bob 1100.
+func newReconcileRepository(t *testing.T) *testRepository {
+	ctx := context.Background()
+	repo := newTestRepository()
+	repo.createUser(t, "alice", 0)
+	repo.createUser(t, "bob", 0)
+	_, err := GrantCoins(ctx, repo, "admin", []string{"alice", "bob"}, 1000, "welcome")
+	assert.NoError(t, err)
+	assert.NoError(t, TransferCoins(ctx, repo, "alice", "bob", 100))
+	assert.NoError(t, PurchaseItem(ctx, repo, "alice", "t-shirt"))
+	return repo
+}
+
+func TestReconcile_NoDrift(t *testing.T) {
+	repo := newReconcileRepository(t)
+
+	report, err := Reconcile(context.Background(), repo, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.CheckedUsers)
+	assert.Empty(t, report.Discrepancies)
+	assert.Len(t, repo.ledger(t, "alice"), 3)
+}
+
+func TestReconcile_ReportsDrift(t *testing.T) {
+	repo := newReconcileRepository(t)
+	alice, _ := repo.GetUserByUsername(context.Background(), "alice")
+	assert.NoError(t, repo.AddCoins(context.Background(), alice.ID, 80))
+
+	report, err := Reconcile(context.Background(), repo, false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Discrepancies, 1)
+	d := report.Discrepancies[0]
+	assert.Equal(t, "alice", d.Username)
+	assert.Equal(t, 820, d.Expected)
+	assert.Equal(t, 900, d.Actual)
+	assert.Equal(t, 80, d.Drift)
+	assert.Nil(t, d.AdjustmentID)
+	assert.Equal(t, 80, report.TotalDrift)
+	assert.Len(t, repo.ledger(t, "alice"), 3)
+}
+
+func TestReconcile_OffsettingDrifts(t *testing.T) {
+	repo := newReconcileRepository(t)
+	alice, _ := repo.GetUserByUsername(context.Background(), "alice")
+	bob, _ := repo.GetUserByUsername(context.Background(), "bob")
+	assert.NoError(t, repo.AddCoins(context.Background(), alice.ID, 50))
+	assert.NoError(t, repo.AddCoins(context.Background(), bob.ID, -50))
+
+	report, err := Reconcile(context.Background(), repo, false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Discrepancies, 2)
+	assert.Zero(t, report.TotalDrift)
+	assert.Equal(t, 100, report.AbsoluteDrift)
+}
+
+func TestReconcile_FixWritesAdjustment(t *testing.T) {
+	repo := newReconcileRepository(t)
+	alice, _ := repo.GetUserByUsername(context.Background(), "alice")
+	assert.NoError(t, repo.AddCoins(context.Background(), alice.ID, -120))
+
+	report, err := Reconcile(context.Background(), repo, true)
+	assert.NoError(t, err)
+	assert.True(t, report.Fixed)
+	assert.Len(t, report.Discrepancies, 1)
+	assert.NotNil(t, report.Discrepancies[0].AdjustmentID)
+
+	entries := repo.ledger(t, "alice")
+	if assert.Len(t, entries, 4) {
+		assert.Equal(t, *report.Discrepancies[0].AdjustmentID, entries[0].ID)
+		assert.Equal(t, model.TransactionTypeAdjustment, entries[0].Type)
+		assert.Equal(t, model.DirectionOut, entries[0].Direction)
+		assert.Equal(t, 120, entries[0].Amount)
+	}
+
+	// Партии погашены на величину корректировки и снова покрывают баланс.
+	lots, err := repo.GetCoinLotsByUserID(context.Background(), alice.ID)
+	assert.NoError(t, err)
+	remaining := 0
+	for _, lot := range lots {
+		remaining += lot.Remaining
+	}
+	assert.Equal(t, 700, remaining)
+
+	report, err = Reconcile(context.Background(), repo, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Discrepancies)
+
+	// Сгорание после корректировки не уводит баланс в минус.
+	expiry, err := ExpireCoins(context.Background(), repo, time.Now().AddDate(0, CoinLifetimeMonths+1, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 700+1100, expiry.ExpiredCoins)
+	assert.Equal(t, 0, repo.coins(t, "alice"))
+	assert.Equal(t, 0, repo.coins(t, "bob"))
+}
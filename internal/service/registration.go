@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultInviteTTL — срок действия приглашения, если он не задан.
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// CreateInvite выпускает код приглашения. По умолчанию приглашение
+// одноразовое, действует неделю и даёт роль user. Действие записывается в
+// журнал аудита от имени actor.
+func CreateInvite(ctx context.Context, repo repository.Repository, actor string, req model.CreateInviteRequest) (_ *model.Invite, err error) {
+	ctx, span := tracing.Start(ctx, "service.CreateInvite")
+	defer tracing.End(span, &err)
+
+	now := time.Now()
+	invite := &model.Invite{
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: now.Add(defaultInviteTTL),
+		CreatedBy: actor,
+	}
+	if invite.Role == "" {
+		invite.Role = model.RoleUser
+	}
+	if !validRole(invite.Role) {
+		return nil, model.ErrInvalidRole
+	}
+	if invite.MaxUses == 0 {
+		invite.MaxUses = 1
+	}
+	if invite.MaxUses < 0 {
+		return nil, model.ErrInvalidMaxUses
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return nil, model.ErrInvalidExpiry
+		}
+		invite.ExpiresAt = *req.ExpiresAt
+	}
+	if invite.Code, err = newInviteCode(); err != nil {
+		return nil, err
+	}
+
+	if err := repo.CreateInvite(ctx, invite); err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, repo, actor, "create_invite", map[string]interface{}{
+		"inviteId":  invite.ID,
+		"role":      invite.Role,
+		"maxUses":   invite.MaxUses,
+		"expiresAt": invite.ExpiresAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("invite created",
+		"actor", actor, "invite_id", invite.ID, "role", invite.Role, "max_uses", invite.MaxUses)
+	return invite, nil
+}
+
+// ListInvites возвращает все приглашения, новые первыми.
+func ListInvites(ctx context.Context, repo repository.Repository) (_ []*model.Invite, err error) {
+	ctx, span := tracing.Start(ctx, "service.ListInvites")
+	defer tracing.End(span, &err)
+
+	invites, err := repo.ListInvites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if invites == nil {
+		invites = []*model.Invite{}
+	}
+	return invites, nil
+}
+
+// RevokeInvite отзывает приглашение code: зарегистрироваться по нему больше
+// нельзя, уже зарегистрированные пользователи остаются. Действие записывается
+// в журнал аудита от имени actor.
+func RevokeInvite(ctx context.Context, repo repository.Repository, actor, code string) (_ *model.Invite, err error) {
+	ctx, span := tracing.Start(ctx, "service.RevokeInvite")
+	defer tracing.End(span, &err)
+
+	if err := repo.RevokeInvite(ctx, code, time.Now()); err != nil {
+		return nil, err
+	}
+	invite, err := repo.GetInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, repo, actor, "revoke_invite", map[string]interface{}{
+		"inviteId": invite.ID,
+		"uses":     invite.Uses,
+	}); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("invite revoked", "actor", actor, "invite_id", invite.ID)
+	return invite, nil
+}
+
+// ProvisionUser заводит учётную запись user от имени администратора или
+// системы учёта персонала actor в любом режиме регистрации. Пользователь
+// получает приветственное начисление, как при самостоятельной регистрации.
+// Действие записывается в журнал аудита.
+func ProvisionUser(ctx context.Context, repo repository.Repository, actor string, user *model.User) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.ProvisionUser", attribute.String("username", user.Username))
+	defer tracing.End(span, &err)
+
+	if user.Username == "" {
+		return nil, model.BadRequest("username is required")
+	}
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	if !validRole(user.Role) {
+		return nil, model.ErrInvalidRole
+	}
+
+	user, err = registerUser(ctx, repo, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, repo, actor, "create_user", map[string]interface{}{
+		"userId":   user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func validRole(role string) bool {
+	return role == model.RoleUser || role == model.RoleAdmin
+}
+
+// newInviteCode возвращает случайный код приглашения из 24 шестнадцатеричных символов.
+func newInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateInvite_Defaults(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+
+	start := time.Now()
+	invite, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, invite.Code, 24)
+	assert.Equal(t, model.RoleUser, invite.Role)
+	assert.Equal(t, 1, invite.MaxUses)
+	assert.WithinDuration(t, start.Add(7*24*time.Hour), invite.ExpiresAt, 5*time.Second)
+	assert.Equal(t, "root", invite.CreatedBy)
+
+	other, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, invite.Code, other.Code)
+}
+
+func TestCreateInvite_Validation(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	past := time.Now().Add(-time.Minute)
+
+	_, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{Role: "superuser"})
+	assert.ErrorIs(t, err, model.ErrInvalidRole)
+	_, err = CreateInvite(ctx, repo, "root", model.CreateInviteRequest{MaxUses: -1})
+	assert.ErrorIs(t, err, model.ErrInvalidMaxUses)
+	_, err = CreateInvite(ctx, repo, "root", model.CreateInviteRequest{ExpiresAt: &past})
+	assert.ErrorIs(t, err, model.ErrInvalidExpiry)
+
+	invites, err := ListInvites(ctx, repo)
+	assert.NoError(t, err)
+	assert.Empty(t, invites)
+}
+
+func TestInvite_MultiUseAndRevoke(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	RegistrationMode = RegistrationInvite
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	invite, err := CreateInvite(ctx, repo, "root", model.CreateInviteRequest{MaxUses: 3})
+	assert.NoError(t, err)
+
+	for _, username := range []string{"alice", "bob"} {
+		_, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: username, Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+		assert.NoError(t, err)
+	}
+
+	revoked, err := RevokeInvite(ctx, repo, "root", invite.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, revoked.Uses)
+	assert.NotNil(t, revoked.RevokedAt)
+
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "carol", Password: "secret", InviteCode: invite.Code}, "10.0.0.1")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = RevokeInvite(ctx, repo, "root", "missing")
+	assert.ErrorIs(t, err, model.ErrInviteNotFound)
+}
+
+func TestProvisionUser(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	RegistrationMode = RegistrationAdmin
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+
+	user, err := ProvisionUser(ctx, repo, "root", &model.User{Username: "alice", Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleUser, user.Role)
+	assert.Equal(t, WelcomeCoins, user.Coins)
+
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.NoError(t, err)
+
+	_, err = ProvisionUser(ctx, repo, "root", &model.User{Username: "alice", Password: "other"})
+	assert.ErrorIs(t, err, model.ErrUsernameTaken)
+	_, err = ProvisionUser(ctx, repo, "root", &model.User{Username: "bob", Password: "secret", Role: "owner"})
+	assert.ErrorIs(t, err, model.ErrInvalidRole)
+	// Имя системного счёта магазина занято, даже пока счёт не заведён.
+	_, err = ProvisionUser(ctx, repo, "root", &model.User{Username: Offboarding.ShopAccount, Password: "secret"})
+	assert.ErrorIs(t, err, model.ErrUsernameTaken)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+
+	"merch-shop/internal/logging"
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/scim"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SCIMActor — имя, от которого изменения через SCIM записываются в журнал аудита.
+const SCIMActor = "scim"
+
+const (
+	defaultSCIMCount = 100
+	maxSCIMCount     = 1000
+)
+
+// ListSCIMUsers возвращает страницу пользователей, подходящих под фильтр
+// filter, начиная с позиции startIndex (с 1). Фильтр и страница выбираются
+// запросом к хранилищу, без чтения всех пользователей. Без count отдаётся 100
+// пользователей, больше 1000 за раз не отдаётся; count=0 возвращает только
+// общее число.
+func ListSCIMUsers(ctx context.Context, repo repository.Repository, filter string, startIndex int, count *int) (_ *scim.ListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.ListSCIMUsers", attribute.String("filter", filter))
+	defer tracing.End(span, &err)
+
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultSCIMCount
+	if count != nil {
+		limit = min(max(*count, 0), maxSCIMCount)
+	}
+	startIndex = max(startIndex, 1)
+	resp := &scim.ListResponse{
+		Schemas:    []string{scim.SchemaListResponse},
+		StartIndex: startIndex,
+		Resources:  []scim.User{},
+	}
+	q, ok := f.Query()
+	if !ok {
+		return resp, nil
+	}
+	q.Offset, q.Limit = startIndex-1, limit
+	users, total, err := repo.ListUsersPage(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		resp.Resources = append(resp.Resources, scim.FromModel(u))
+	}
+	resp.TotalResults = total
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp, nil
+}
+
+// GetSCIMUser возвращает пользователя по идентификатору ресурса SCIM.
+func GetSCIMUser(ctx context.Context, repo repository.Repository, id string) (_ *scim.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetSCIMUser")
+	defer tracing.End(span, &err)
+
+	user, err := getSCIMUser(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	res := scim.FromModel(user)
+	return &res, nil
+}
+
+// CreateSCIMUser заводит пользователя по ресурсу SCIM с ролью user и
+// приветственным начислением. Ресурс с active=false создаёт сразу
+// деактивированного пользователя.
+func CreateSCIMUser(ctx context.Context, repo repository.Repository, req scim.User) (_ *scim.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.CreateSCIMUser", attribute.String("username", req.UserName))
+	defer tracing.End(span, &err)
+
+	user := req.ToModel()
+	active := user.Active
+	user, err = ProvisionUser(ctx, repo, SCIMActor, user)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		updated := *user
+		updated.Active = false
+		if err := updateProfile(ctx, repo, SCIMActor, user, &updated); err != nil {
+			return nil, err
+		}
+		user = &updated
+	}
+	res := scim.FromModel(user)
+	return &res, nil
+}
+
+// PatchSCIMUser применяет операции PATCH к пользователю. Имя пользователя
+// изменить нельзя: оно записано в выданных токенах и в истории переводов.
+// Деактивация через active=false закрывает баланс по политике Offboarding в той
+// же транзакции, что и изменение профиля.
+func PatchSCIMUser(ctx context.Context, repo repository.Repository, id string, ops []scim.PatchOperation) (_ *scim.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.PatchSCIMUser")
+	defer tracing.End(span, &err)
+
+	user, err := getSCIMUser(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	updated := *user
+	if err := scim.ApplyPatch(&updated, ops); err != nil {
+		return nil, err
+	}
+	if updated.Username != user.Username {
+		return nil, model.ErrUsernameImmutable
+	}
+	deactivate := user.Active && !updated.Active
+	if deactivate {
+		updated.Active = true
+	}
+	err = repo.WithTx(ctx, func(repo repository.Repository) error {
+		if err := updateProfile(ctx, repo, SCIMActor, user, &updated); err != nil {
+			return err
+		}
+		if deactivate {
+			if _, err := offboard(ctx, repo, SCIMActor, &updated, model.OffboardRequest{}); err != nil {
+				return err
+			}
+			updated.Active = false
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := scim.FromModel(&updated)
+	return &res, nil
+}
+
+// DeactivateSCIMUser деактивирует пользователя по запросу DELETE и закрывает
+// его баланс по политике Offboarding. Учётная запись и её история сохраняются.
+func DeactivateSCIMUser(ctx context.Context, repo repository.Repository, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.DeactivateSCIMUser")
+	defer tracing.End(span, &err)
+
+	user, err := getSCIMUser(ctx, repo, id)
+	if err != nil {
+		return err
+	}
+	if !user.Active {
+		return nil
+	}
+	_, err = offboard(ctx, repo, SCIMActor, user, model.OffboardRequest{})
+	return err
+}
+
+func getSCIMUser(ctx context.Context, repo repository.Repository, id string) (*model.User, error) {
+	userID, err := scim.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetUserByID(ctx, userID)
+}
+
+// updateProfile сохраняет профиль after и записывает в журнал аудита действие
+// update_user, deactivate_user или reactivate_user от имени actor. Пароль в
+// журнал не попадает.
+func updateProfile(ctx context.Context, repo repository.Repository, actor string, before, after *model.User) error {
+	if *before == *after {
+		return nil
+	}
+	if err := repo.UpdateUserProfile(ctx, after); err != nil {
+		return err
+	}
+
+	action := "update_user"
+	switch {
+	case before.Active && !after.Active:
+		action = "deactivate_user"
+	case !before.Active && after.Active:
+		action = "reactivate_user"
+	}
+	if err := audit(ctx, repo, actor, action, map[string]interface{}{
+		"userId":          after.ID,
+		"username":        after.Username,
+		"displayName":     after.DisplayName,
+		"email":           after.Email,
+		"department":      after.Department,
+		"externalId":      after.ExternalID,
+		"active":          after.Active,
+		"passwordChanged": before.Password != after.Password,
+	}); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("user updated",
+		"actor", actor, "action", action, "user_id", after.ID, "username", after.Username)
+	return nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/scim"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	defer func(mode string) { RegistrationMode = mode }(RegistrationMode)
+	RegistrationMode = RegistrationAdmin
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+
+	created, err := CreateSCIMUser(ctx, repo, scim.User{
+		UserName:    "alice",
+		Password:    "secret",
+		DisplayName: "Alice Liddell",
+		Emails:      []scim.Email{{Value: "alice@example.com", Primary: true}},
+		ExternalID:  "hr-1",
+		Enterprise:  &scim.EnterpriseUser{Department: "Design"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", created.ID)
+	assert.True(t, *created.Active)
+
+	user, err := AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, WelcomeCoins, user.Coins)
+	assert.Equal(t, model.RoleUser, user.Role)
+
+	_, err = CreateSCIMUser(ctx, repo, scim.User{UserName: "alice"})
+	assert.ErrorIs(t, err, model.ErrUsernameTaken)
+
+	assert.NoError(t, EnsureShopAccount(ctx, repo))
+
+	patched, err := PatchSCIMUser(ctx, repo, created.ID, []scim.PatchOperation{
+		{Op: "replace", Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", Value: json.RawMessage(`"Research"`)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Research", patched.Enterprise.Department)
+	assert.Equal(t, "Alice Liddell", patched.DisplayName)
+
+	_, err = PatchSCIMUser(ctx, repo, created.ID, []scim.PatchOperation{
+		{Op: "replace", Path: "userName", Value: json.RawMessage(`"alicia"`)},
+	})
+	assert.ErrorIs(t, err, model.ErrUsernameImmutable)
+
+	assert.NoError(t, DeactivateSCIMUser(ctx, repo, created.ID))
+	got, err := GetSCIMUser(ctx, repo, created.ID)
+	assert.NoError(t, err)
+	assert.False(t, *got.Active)
+
+	// Деактивированный пользователь не входит даже с верным паролем.
+	_, err = AuthenticateUser(ctx, repo, model.AuthRequest{Username: "alice", Password: "secret"}, "10.0.0.1")
+	assert.ErrorIs(t, err, model.ErrAccountInactive)
+
+	reactivated, err := PatchSCIMUser(ctx, repo, created.ID, []scim.PatchOperation{
+		{Op: "replace", Value: json.RawMessage(`{"active": true}`)},
+	})
+	assert.NoError(t, err)
+	assert.True(t, *reactivated.Active)
+
+	_, err = GetSCIMUser(ctx, repo, "42")
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+	_, err = GetSCIMUser(ctx, repo, "alice")
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
+}
+
+func TestCreateSCIMUser_Inactive(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	inactive := false
+
+	created, err := CreateSCIMUser(ctx, repo, scim.User{UserName: "bob", Password: "secret", Active: &inactive})
+	assert.NoError(t, err)
+	assert.False(t, *created.Active)
+
+	user, err := repo.GetUserByUsername(ctx, "bob")
+	assert.NoError(t, err)
+	assert.False(t, user.Active)
+}
+
+func TestListSCIMUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := CreateSCIMUser(ctx, repo, scim.User{UserName: name, ExternalID: "hr-" + name})
+		assert.NoError(t, err)
+	}
+
+	all, err := ListSCIMUsers(ctx, repo, "", 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, all.TotalResults)
+	assert.Equal(t, 3, all.ItemsPerPage)
+
+	count := 1
+	page, err := ListSCIMUsers(ctx, repo, "", 2, &count)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.TotalResults)
+	assert.Equal(t, 2, page.StartIndex)
+	if assert.Len(t, page.Resources, 1) {
+		assert.Equal(t, "bob", page.Resources[0].UserName)
+	}
+
+	found, err := ListSCIMUsers(ctx, repo, `externalId eq "hr-carol"`, 1, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, found.Resources, 1) {
+		assert.Equal(t, "carol", found.Resources[0].UserName)
+	}
+
+	both, err := ListSCIMUsers(ctx, repo, `externalId eq "hr-bob" and active eq true`, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, both.TotalResults)
+
+	zero := 0
+	counted, err := ListSCIMUsers(ctx, repo, "", 1, &zero)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, counted.TotalResults)
+	assert.Empty(t, counted.Resources)
+
+	conflicting, err := ListSCIMUsers(ctx, repo, `userName eq "alice" and userName eq "bob"`, 1, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, conflicting.TotalResults)
+	assert.NotNil(t, conflicting.Resources)
+
+	none, err := ListSCIMUsers(ctx, repo, `userName eq "dave"`, 1, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, none.TotalResults)
+	assert.NotNil(t, none.Resources)
+
+	_, err = ListSCIMUsers(ctx, repo, `userName sw "a"`, 1, nil)
+	assert.ErrorIs(t, err, model.ErrInvalidFilter)
+}
+
+func TestPatchSCIMUser_DeactivationSettlesBalance(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	assert.NoError(t, EnsureShopAccount(ctx, repo))
+	created, err := CreateSCIMUser(ctx, repo, scim.User{UserName: "alice", DisplayName: "Alice"})
+	assert.NoError(t, err)
+
+	patched, err := PatchSCIMUser(ctx, repo, created.ID, []scim.PatchOperation{
+		{Op: "replace", Value: json.RawMessage(`{"active": false, "displayName": "Alice Liddell"}`)},
+	})
+	assert.NoError(t, err)
+	assert.False(t, *patched.Active)
+	assert.Equal(t, "Alice Liddell", patched.DisplayName)
+
+	user, err := repo.GetUserByUsername(ctx, "alice")
+	assert.NoError(t, err)
+	assert.False(t, user.Active)
+	assert.Equal(t, "Alice Liddell", user.DisplayName)
+	assert.Zero(t, user.Coins)
+
+	circulation, err := repo.GetCoinsInCirculation(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, circulation)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	StatementFormatCSV   = "csv"
+	StatementFormatJSONL = "jsonl"
+)
+
+var statementCSVHeader = []string{
+	"kind", "user_id", "username", "transaction_id", "type", "direction",
+	"amount", "counterparty", "reason", "time", "balance",
+}
+
+// StatementEncoder пишет строки выписки в поток в одном из поддерживаемых форматов.
+type StatementEncoder interface {
+	Encode(row *model.StatementRow) error
+	Flush() error
+}
+
+// NewStatementEncoder возвращает кодировщик для формата csv или jsonl.
+func NewStatementEncoder(w io.Writer, format string) (StatementEncoder, error) {
+	switch format {
+	case StatementFormatCSV:
+		return &csvStatementEncoder{w: csv.NewWriter(w)}, nil
+	case StatementFormatJSONL:
+		return &jsonlStatementEncoder{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, model.ErrInvalidFormat
+	}
+}
+
+type csvStatementEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvStatementEncoder) Encode(row *model.StatementRow) error {
+	if !e.headerWritten {
+		if err := e.w.Write(statementCSVHeader); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+	var txID string
+	if row.TransactionID != 0 {
+		txID = strconv.FormatInt(row.TransactionID, 10)
+	}
+	return e.w.Write([]string{
+		row.Kind,
+		strconv.FormatInt(row.UserID, 10),
+		row.Username,
+		txID,
+		row.Type,
+		row.Direction,
+		strconv.Itoa(row.Amount),
+		row.Counterparty,
+		row.Reason,
+		row.Time.UTC().Format(time.RFC3339),
+		strconv.Itoa(row.Balance),
+	})
+}
+
+func (e *csvStatementEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlStatementEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlStatementEncoder) Encode(row *model.StatementRow) error {
+	return e.enc.Encode(row)
+}
+
+func (e *jsonlStatementEncoder) Flush() error {
+	return nil
+}
+
+// WriteStatement пишет выписку пользователя за период [from, to): входящий
+// остаток, все движения с текущим остатком после каждого и исходящий остаток.
+// Движения читаются из репозитория потоком и сразу уходят в enc.
+func WriteStatement(ctx context.Context, repo repository.Repository, enc StatementEncoder, userID int64, from, to time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "service.WriteStatement", attribute.Int64("user_id", userID))
+	defer tracing.End(span, &err)
+
+	if !from.Before(to) {
+		return model.ErrInvalidDateRange
+	}
+	user, err := repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := writeUserStatement(ctx, repo, enc, user, from, to); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// WriteAllStatements пишет выписки всех пользователей подряд в порядке их ID.
+func WriteAllStatements(ctx context.Context, repo repository.Repository, enc StatementEncoder, from, to time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "service.WriteAllStatements")
+	defer tracing.End(span, &err)
+
+	if !from.Before(to) {
+		return model.ErrInvalidDateRange
+	}
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := writeUserStatement(ctx, repo, enc, user, from, to); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
+
+func writeUserStatement(ctx context.Context, repo repository.Repository, enc StatementEncoder, user *model.User, from, to time.Time) error {
+	balance, err := repo.GetBalanceAt(ctx, user.ID, from)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(&model.StatementRow{
+		Kind:     model.StatementRowOpening,
+		UserID:   user.ID,
+		Username: user.Username,
+		Time:     from,
+		Balance:  balance,
+	}); err != nil {
+		return err
+	}
+
+	err = repo.StreamLedger(ctx, user.ID, from, to, func(e *model.LedgerEntry) error {
+		if e.Direction == model.DirectionOut {
+			balance -= e.Amount
+		} else {
+			balance += e.Amount
+		}
+		return enc.Encode(&model.StatementRow{
+			Kind:          model.StatementRowEntry,
+			UserID:        user.ID,
+			Username:      user.Username,
+			TransactionID: e.ID,
+			Type:          e.Type,
+			Direction:     e.Direction,
+			Amount:        e.Amount,
+			Counterparty:  e.Counterparty,
+			Reason:        e.Reason,
+			Time:          e.CreatedAt,
+			Balance:       balance,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.Encode(&model.StatementRow{
+		Kind:     model.StatementRowClosing,
+		UserID:   user.ID,
+		Username: user.Username,
+		Time:     to,
+		Balance:  balance,
+	})
+}
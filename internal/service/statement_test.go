@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStatementRepository отдаёт заранее заданный входящий остаток и движения.
+type fakeStatementRepository struct {
+	repository.Repository
+	opening map[int64]int
+	entries map[int64][]*model.LedgerEntry
+}
+
+func (r *fakeStatementRepository) GetBalanceAt(ctx context.Context, userID int64, at time.Time) (int, error) {
+	return r.opening[userID], nil
+}
+
+func (r *fakeStatementRepository) StreamLedger(ctx context.Context, userID int64, from, to time.Time, fn func(*model.LedgerEntry) error) error {
+	for _, e := range r.entries[userID] {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newFakeStatementRepository(t *testing.T) *fakeStatementRepository {
+	repo := &fakeStatementRepository{
+		Repository: repository.NewMemoryRepository(),
+		opening:    map[int64]int{1: 1000, 2: 500},
+		entries:    make(map[int64][]*model.LedgerEntry),
+	}
+	for _, user := range []*model.User{{Username: "alice", Coins: 870}, {Username: "bob", Coins: 550}} {
+		assert.NoError(t, repo.CreateUser(context.Background(), user))
+	}
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	repo.entries[1] = []*model.LedgerEntry{
+		{ID: 10, Type: model.TransactionTypeTransfer, Direction: model.DirectionOut, Amount: 50, Counterparty: "bob", CreatedAt: at},
+		{ID: 11, Type: model.TransactionTypePurchase, Direction: model.DirectionOut, Amount: 80, Reason: "t-shirt", CreatedAt: at.Add(time.Hour)},
+	}
+	repo.entries[2] = []*model.LedgerEntry{
+		{ID: 10, Type: model.TransactionTypeTransfer, Direction: model.DirectionIn, Amount: 50, Counterparty: "alice", CreatedAt: at},
+	}
+	return repo
+}
+
+func TestWriteStatement_JSONL(t *testing.T) {
+	repo := newFakeStatementRepository(t)
+	var buf bytes.Buffer
+	enc, err := NewStatementEncoder(&buf, StatementFormatJSONL)
+	assert.NoError(t, err)
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	err = WriteStatement(context.Background(), repo, enc, 1, from, to)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	var rows []model.StatementRow
+	for _, line := range lines {
+		var row model.StatementRow
+		assert.NoError(t, json.Unmarshal([]byte(line), &row))
+		rows = append(rows, row)
+	}
+	assert.Equal(t, model.StatementRowOpening, rows[0].Kind)
+	assert.Equal(t, 1000, rows[0].Balance)
+	assert.Equal(t, 950, rows[1].Balance)
+	assert.Equal(t, "bob", rows[1].Counterparty)
+	assert.Equal(t, 870, rows[2].Balance)
+	assert.Equal(t, "t-shirt", rows[2].Reason)
+	assert.Equal(t, model.StatementRowClosing, rows[3].Kind)
+	assert.Equal(t, 870, rows[3].Balance)
+	assert.Equal(t, to, rows[3].Time)
+}
+
+func TestWriteAllStatements_CSV(t *testing.T) {
+	repo := newFakeStatementRepository(t)
+	var buf bytes.Buffer
+	enc, err := NewStatementEncoder(&buf, StatementFormatCSV)
+	assert.NoError(t, err)
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	err = WriteAllStatements(context.Background(), repo, enc, from, to)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 8)
+	assert.Equal(t, strings.Join(statementCSVHeader, ","), lines[0])
+	assert.Equal(t, "opening,1,alice,,,,0,,,2026-03-01T00:00:00Z,1000", lines[1])
+	assert.Equal(t, "entry,1,alice,10,transfer,out,50,bob,,2026-03-10T12:00:00Z,950", lines[2])
+	assert.Equal(t, "closing,1,alice,,,,0,,,2026-04-01T00:00:00Z,870", lines[4])
+	assert.Equal(t, "entry,2,bob,10,transfer,in,50,alice,,2026-03-10T12:00:00Z,550", lines[6])
+	assert.Equal(t, "closing,2,bob,,,,0,,,2026-04-01T00:00:00Z,550", lines[7])
+}
+
+func TestWriteStatement_SelfTransfer(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository()
+	alice := repo.createUser(t, "alice", 90)
+	for _, tx := range []*model.Transaction{
+		{ToUserID: alice.ID, Amount: 100, Type: model.TransactionTypeGrant},
+		// Перевод самому себе от версии без проверки получателя.
+		{FromUserID: &alice.ID, ToUserID: alice.ID, Amount: 30, Type: model.TransactionTypeTransfer},
+		{ToUserID: alice.ID, Amount: 10, Type: model.TransactionTypePurchase, Reason: "pen"},
+	} {
+		assert.NoError(t, repo.CreateTransaction(ctx, tx))
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewStatementEncoder(&buf, StatementFormatJSONL)
+	assert.NoError(t, err)
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	assert.NoError(t, WriteStatement(ctx, repo, enc, alice.ID, from, to))
+
+	var balances []int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var row model.StatementRow
+		assert.NoError(t, json.Unmarshal([]byte(line), &row))
+		balances = append(balances, row.Balance)
+	}
+	assert.Equal(t, []int{0, 100, 70, 100, 90, 90}, balances)
+	assert.Equal(t, repo.coins(t, "alice"), balances[len(balances)-1])
+}
+
+func TestWriteStatement_InvalidParams(t *testing.T) {
+	repo := newFakeStatementRepository(t)
+	_, err := NewStatementEncoder(&bytes.Buffer{}, "xml")
+	assert.EqualError(t, err, "invalid format")
+
+	enc, _ := NewStatementEncoder(&bytes.Buffer{}, StatementFormatCSV)
+	now := time.Now()
+	err = WriteStatement(context.Background(), repo, enc, 1, now, now.Add(-time.Hour))
+	assert.EqualError(t, err, "invalid date range")
+}
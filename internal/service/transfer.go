@@ -1,47 +1,89 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"time"
 
+	"merch-shop/internal/logging"
+	"merch-shop/internal/metrics"
 	"merch-shop/internal/model"
 	"merch-shop/internal/repository"
+	"merch-shop/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func TransferCoins(repo repository.Repository, senderUsername, recipientUsername string, amount int) error {
-	sender, err := repo.GetUserByUsername(senderUsername)
-	if err != nil {
-		return err
+// TransferCoins переводит amount монет от одного пользователя другому. Списание,
+// зачисление, перенос партий и запись в журнал выполняются в одной транзакции.
+func TransferCoins(ctx context.Context, repo repository.Repository, senderUsername, recipientUsername string, amount int) (err error) {
+	ctx, span := tracing.Start(ctx, "service.TransferCoins", attribute.Int("amount", amount))
+	defer tracing.End(span, &err)
+
+	if amount <= 0 {
+		return model.ErrInvalidAmount
 	}
-	if sender.Coins < amount {
-		return errors.New("insufficient coins")
+	if senderUsername == recipientUsername {
+		return model.ErrSelfTransfer
 	}
 
-	recipient, err := repo.GetUserByUsername(recipientUsername)
-	if err != nil {
-		return err
+	var sender, recipient *model.User
+	tx := &model.Transaction{
+		Amount: amount,
+		Type:   "transfer",
 	}
+	err = repo.WithTx(ctx, func(repo repository.Repository) error {
+		var err error
+		sender, err = repo.GetUserByUsername(ctx, senderUsername)
+		if err != nil {
+			return err
+		}
+		recipient, err = repo.GetUserByUsername(ctx, recipientUsername)
+		if err != nil {
+			return err
+		}
+		if !recipient.Active {
+			return model.ErrRecipientInactive
+		}
 
-	sender.Coins -= amount
-	recipient.Coins += amount
+		if err := moveCoins(ctx, repo, sender.ID, recipient.ID, amount); err != nil {
+			return err
+		}
+		portions, err := consumeCoinLots(ctx, repo, sender.ID, amount)
+		if err != nil {
+			return err
+		}
+		if err := moveCoinLots(ctx, repo, portions, recipient.ID, time.Now()); err != nil {
+			return err
+		}
 
-	if err := repo.UpdateUser(sender); err != nil {
-		return err
-	}
-	if err := repo.UpdateUser(recipient); err != nil {
+		tx.FromUserID = &sender.ID
+		tx.ToUserID = recipient.ID
+		tx.CreatedAt = time.Now()
+		return repo.CreateTransaction(ctx, tx)
+	})
+	if err != nil {
 		return err
 	}
 
-	tx := &model.Transaction{
-		FromUserID: &sender.ID,
-		ToUserID:   recipient.ID,
-		Amount:     amount,
-		Type:       "transfer",
-		CreatedAt:  time.Now(),
+	metrics.CoinsTransferred.Add(float64(amount))
+	logging.FromContext(ctx).Info("coins transferred",
+		"from", sender.Username, "to", recipient.Username, "amount", amount,
+		"sender_balance", sender.Coins-amount, "transaction_id", tx.ID)
+	return nil
+}
+
+// moveCoins списывает amount монет у fromID и зачисляет их toID. Строки
+// пользователей изменяются в порядке возрастания ID, чтобы встречные переводы
+// не взаимоблокировались.
+func moveCoins(ctx context.Context, repo repository.Repository, fromID, toID int64, amount int) error {
+	if fromID < toID {
+		if err := repo.DebitCoins(ctx, fromID, amount); err != nil {
+			return err
+		}
+		return repo.AddCoins(ctx, toID, amount)
 	}
-	if err := repo.CreateTransaction(tx); err != nil {
+	if err := repo.AddCoins(ctx, toID, amount); err != nil {
 		return err
 	}
-
-	return nil
+	return repo.DebitCoins(ctx, fromID, amount)
 }
@@ -1,117 +1,169 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"testing"
-	"time"
 
 	"merch-shop/internal/model"
+	"merch-shop/internal/repository"
 
 	"github.com/stretchr/testify/assert"
 )
 
-type fakeRepository struct {
-	users        map[string]*model.User
-	transactions []*model.Transaction
-	purchases    []*model.Purchase
+// testRepository — хранилище в памяти, которое дополнительно запоминает записи
+// аудита: прочитать их обратно через Repository нельзя.
+type testRepository struct {
+	repository.Repository
+	audits []*model.AuditEntry
 }
 
-func newFakeRepository() *fakeRepository {
-	return &fakeRepository{
-		users:        make(map[string]*model.User),
-		transactions: []*model.Transaction{},
-		purchases:    []*model.Purchase{},
-	}
+func newTestRepository() *testRepository {
+	return &testRepository{Repository: repository.NewMemoryRepository()}
 }
 
-func (r *fakeRepository) GetUserByUsername(username string) (*model.User, error) {
-	user, exists := r.users[username]
-	if !exists {
-		return nil, errors.New("user not found")
+func (r *testRepository) CreateAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	if err := r.Repository.CreateAuditEntry(ctx, e); err != nil {
+		return err
 	}
-	return user, nil
-}
-
-func (r *fakeRepository) CreatePurchase(p *model.Purchase) error {
-	p.ID = int64(len(r.purchases) + 1)
-	p.CreatedAt = time.Now()
-	r.purchases = append(r.purchases, p)
+	r.audits = append(r.audits, e)
 	return nil
 }
 
-func (r *fakeRepository) UpdateUser(user *model.User) error {
-	r.users[user.Username] = user
-	return nil
+// WithTx передаёт в fn хранилище транзакции, которое тоже запоминает записи
+// аудита; они сохраняются, только если транзакция зафиксирована.
+func (r *testRepository) WithTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	var audits []*model.AuditEntry
+	err := r.Repository.WithTx(ctx, func(tx repository.Repository) error {
+		view := &testRepository{Repository: tx}
+		err := fn(view)
+		audits = view.audits
+		return err
+	})
+	if err == nil {
+		r.audits = append(r.audits, audits...)
+	}
+	return err
 }
 
-func (r *fakeRepository) CreateTransaction(t *model.Transaction) error {
-	t.ID = int64(len(r.transactions) + 1)
-	t.CreatedAt = time.Now()
-	r.transactions = append(r.transactions, t)
-	return nil
+// createUser заводит активного пользователя с балансом coins без записей в журнале.
+func (r *testRepository) createUser(t *testing.T, username string, coins int) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Password: "pass", Coins: coins}
+	assert.NoError(t, r.CreateUser(context.Background(), user))
+	return user
 }
 
-func (r *fakeRepository) CreateUser(user *model.User) error {
-	return nil
+// deactivate отключает пользователя в обход сервиса, без расчёта по балансу.
+func (r *testRepository) deactivate(t *testing.T, user *model.User) {
+	t.Helper()
+	user.Active = false
+	assert.NoError(t, r.UpdateUserProfile(context.Background(), user))
 }
 
-func (r *fakeRepository) GetUserByID(userID int64) (*model.User, error) {
-	return nil, nil
+// coins возвращает текущий баланс пользователя.
+func (r *testRepository) coins(t *testing.T, username string) int {
+	t.Helper()
+	user, err := r.GetUserByUsername(context.Background(), username)
+	assert.NoError(t, err)
+	if user == nil {
+		return 0
+	}
+	return user.Coins
 }
 
-func (r *fakeRepository) GetPurchasesByUserID(userID int64) ([]*model.Purchase, error) {
-	return nil, nil
-}
-func (r *fakeRepository) GetTransactionsReceivedByUserID(userID int64) ([]*model.Transaction, error) {
-	return nil, nil
-}
-func (r *fakeRepository) GetTransactionsSentByUserID(userID int64) ([]*model.Transaction, error) {
-	return nil, nil
+// ledger возвращает движения по счёту пользователя от новых к старым.
+func (r *testRepository) ledger(t *testing.T, username string) []*model.LedgerEntry {
+	t.Helper()
+	user, err := r.GetUserByUsername(context.Background(), username)
+	assert.NoError(t, err)
+	if user == nil {
+		return nil
+	}
+	entries, err := r.GetHistory(context.Background(), model.HistoryFilter{UserID: user.ID})
+	assert.NoError(t, err)
+	return entries
 }
+
 func TestTransferCoins_Success(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["sender"] = &model.User{ID: 1, Username: "sender", Password: "pass", Coins: 1000}
-	repo.users["recipient"] = &model.User{ID: 2, Username: "recipient", Password: "pass", Coins: 1000}
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
+	repo.createUser(t, "recipient", 1000)
 
-	err := TransferCoins(repo, "sender", "recipient", 100)
+	err := TransferCoins(context.Background(), repo, "sender", "recipient", 100)
 	assert.NoError(t, err, "перевод монет должен пройти успешно")
 
-	sender, _ := repo.GetUserByUsername("sender")
-	recipient, _ := repo.GetUserByUsername("recipient")
-	assert.Equal(t, 900, sender.Coins)
-	assert.Equal(t, 1100, recipient.Coins)
-
-	assert.Len(t, repo.transactions, 1)
-	tx := repo.transactions[0]
-	assert.Equal(t, "transfer", tx.Type)
-	assert.Equal(t, 100, tx.Amount)
-	assert.NotNil(t, tx.FromUserID)
-	assert.Equal(t, int64(1), *tx.FromUserID)
-	assert.Equal(t, int64(2), tx.ToUserID)
+	assert.Equal(t, 900, repo.coins(t, "sender"))
+	assert.Equal(t, 1100, repo.coins(t, "recipient"))
+
+	sent := repo.ledger(t, "sender")
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, "transfer", sent[0].Type)
+		assert.Equal(t, model.DirectionOut, sent[0].Direction)
+		assert.Equal(t, 100, sent[0].Amount)
+		assert.Equal(t, "recipient", sent[0].Counterparty)
+	}
+	received := repo.ledger(t, "recipient")
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, model.DirectionIn, received[0].Direction)
+		assert.Equal(t, "sender", received[0].Counterparty)
+	}
 }
 
 func TestTransferCoins_InsufficientFunds(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["sender"] = &model.User{ID: 1, Username: "sender", Password: "pass", Coins: 50}
-	repo.users["recipient"] = &model.User{ID: 2, Username: "recipient", Password: "pass", Coins: 1000}
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 50)
+	repo.createUser(t, "recipient", 1000)
 
-	err := TransferCoins(repo, "sender", "recipient", 100)
-	assert.Error(t, err)
+	err := TransferCoins(context.Background(), repo, "sender", "recipient", 100)
+	assert.ErrorIs(t, err, model.ErrInsufficientCoins)
 	assert.Equal(t, "insufficient coins", err.Error())
 
-	sender, _ := repo.GetUserByUsername("sender")
-	recipient, _ := repo.GetUserByUsername("recipient")
-	assert.Equal(t, 50, sender.Coins)
-	assert.Equal(t, 1000, recipient.Coins)
-
-	assert.Len(t, repo.transactions, 0)
+	assert.Equal(t, 50, repo.coins(t, "sender"))
+	assert.Equal(t, 1000, repo.coins(t, "recipient"))
+	assert.Empty(t, repo.ledger(t, "sender"))
 }
 
 func TestTransferCoins_RecipientNotFound(t *testing.T) {
-	repo := newFakeRepository()
-	repo.users["sender"] = &model.User{ID: 1, Username: "sender", Password: "pass", Coins: 1000}
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
 
-	err := TransferCoins(repo, "sender", "nonexistent", 100)
-	assert.Error(t, err)
+	err := TransferCoins(context.Background(), repo, "sender", "nonexistent", 100)
+	assert.ErrorIs(t, err, model.ErrUserNotFound)
 	assert.Equal(t, "user not found", err.Error())
 }
+
+func TestTransferCoins_InvalidAmount(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
+	repo.createUser(t, "recipient", 1000)
+
+	for _, amount := range []int{0, -100} {
+		err := TransferCoins(context.Background(), repo, "sender", "recipient", amount)
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+	}
+	assert.Equal(t, 1000, repo.coins(t, "sender"))
+	assert.Equal(t, 1000, repo.coins(t, "recipient"))
+	assert.Empty(t, repo.ledger(t, "sender"))
+}
+
+func TestTransferCoins_InactiveRecipient(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
+	repo.deactivate(t, repo.createUser(t, "leaver", 1000))
+
+	err := TransferCoins(context.Background(), repo, "sender", "leaver", 100)
+	assert.ErrorIs(t, err, model.ErrRecipientInactive)
+	assert.Equal(t, 1000, repo.coins(t, "sender"))
+	assert.Equal(t, 1000, repo.coins(t, "leaver"))
+	assert.Empty(t, repo.ledger(t, "sender"))
+}
+
+func TestTransferCoins_Self(t *testing.T) {
+	repo := newTestRepository()
+	repo.createUser(t, "sender", 1000)
+
+	err := TransferCoins(context.Background(), repo, "sender", "sender", 100)
+	assert.ErrorIs(t, err, model.ErrSelfTransfer)
+	assert.Equal(t, 1000, repo.coins(t, "sender"))
+	assert.Empty(t, repo.ledger(t, "sender"))
+}
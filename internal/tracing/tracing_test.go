@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"merch-shop/internal/config"
+	"merch-shop/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func record(t *testing.T, fn func(ctx context.Context) error) sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	func() (err error) {
+		ctx, span := Start(context.Background(), "test", attribute.String("key", "value"))
+		defer End(span, &err)
+		return fn(ctx)
+	}()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	return spans[0]
+}
+
+func TestEnd_OK(t *testing.T) {
+	span := record(t, func(context.Context) error { return nil })
+
+	assert.Equal(t, "test", span.Name())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.String("key", "value"))
+}
+
+func TestEnd_DomainError(t *testing.T) {
+	span := record(t, func(context.Context) error { return model.ErrInsufficientCoins })
+
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.String("error.code", model.ErrInsufficientCoins.Code))
+	assert.Empty(t, span.Events())
+}
+
+func TestEnd_InternalError(t *testing.T) {
+	span := record(t, func(context.Context) error { return errors.New("connection refused") })
+
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "connection refused", span.Status().Description)
+	require.Len(t, span.Events(), 1)
+	assert.Equal(t, "exception", span.Events()[0].Name)
+}
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{Exporter: "none"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"})
+	assert.Error(t, err)
+}